@@ -0,0 +1,80 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+)
+
+// maybeCompact compacts the storage when a segment was rolled over since the last check
+// and more than half of the records are dead.
+func (s *BitcaskStorage) maybeCompact() error {
+	if !s.rolled {
+		return nil
+	}
+	s.rolled = false
+	if s.dead*2 <= s.total {
+		return nil
+	}
+	return s.compact()
+}
+
+// Compact rewrites the live records into new segments, and removes the old ones,
+// so the space of the overwritten and deleted records is reclaimed.
+func (s *BitcaskStorage) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.compact()
+}
+
+// compact copies the live records after the current segments, syncs them, then removes the old segments.
+// A crash in the middle leaves both copies of a record, the later one wins when the segments are replayed,
+// and the old segments are removed from the oldest, so a tombstone never outlives the record it deletes.
+// A corrupted record is quarantined instead of being copied.
+func (s *BitcaskStorage) compact() error {
+	oldIDs := s.ids
+	if err := s.rollover(); err != nil {
+		return err
+	}
+
+	index := make(map[string]*entry, len(s.index))
+	s.total, s.dead = 0, 0
+	for fileKey, position := range s.index {
+		seg := s.segments[position.segment]
+		buf, err := readRecord(seg.file, position.offset, position.size)
+		if err == errInvalidRecord {
+			s.quarantined[fileKey] = struct{}{}
+			s.ring.Remove(fileKey)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		moved, err := s.write(buf)
+		if err != nil {
+			return err
+		}
+		moved.meta = position.meta
+		index[fileKey] = moved
+	}
+	s.rolled = false
+
+	if err := s.active().file.Sync(); err != nil {
+		return fmt.Errorf("error syncing segment: %w", err)
+	}
+	s.index = index
+
+	for _, id := range oldIDs {
+		s.segments[id].file.Close()
+		delete(s.segments, id)
+		if err := os.Remove(s.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing segment: %w", err)
+		}
+	}
+	s.ids = s.ids[len(oldIDs):]
+
+	if err := s.storeQuarantine(); err != nil {
+		return err
+	}
+	return syncDir(s.storagePath)
+}
@@ -0,0 +1,25 @@
+package bitcask
+
+import (
+	"os"
+	"testing"
+
+	"github.com/chord-dht/chord-core/storage"
+	"github.com/chord-dht/chord-core/storagetest"
+)
+
+// corrupt flips the last byte of the record of the file in its segment.
+func corrupt(s storage.Storage, fileKey string) error {
+	ss := s.(*BitcaskStorage)
+	position := ss.index[fileKey]
+	data, err := os.ReadFile(ss.segmentPath(position.segment))
+	if err != nil {
+		return err
+	}
+	data[position.offset+position.size-1] ^= 0xff
+	return os.WriteFile(ss.segmentPath(position.segment), data, 0644)
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.RunWithOptions(t, BitcaskStorageFactory, storagetest.Options{Persistent: true, Corrupt: corrupt})
+}
@@ -0,0 +1,16 @@
+package bitcask
+
+import (
+	"fmt"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// BitcaskStorageFactory is an implementation of StorageFactory using NewStorage.
+func BitcaskStorageFactory(path string) (storage.Storage, error) {
+	storage, err := NewStorage(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating storage at %s: %w", path, err)
+	}
+	return storage, nil
+}
@@ -0,0 +1,103 @@
+package bitcask
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// quarantineFileName is the file (in the storage directory) listing the quarantined keys.
+const quarantineFileName = "quarantine.json"
+
+// quarantine drops the corrupted file: a tombstone is appended, so it stays dropped after a restart,
+// and the key is listed in the quarantine until it is stored again.
+func (s *BitcaskStorage) quarantine(fileKey string) error {
+	if err := s.deleteFile(fileKey); err != nil {
+		return err
+	}
+	s.quarantined[fileKey] = struct{}{}
+	return s.storeQuarantine()
+}
+
+// storeQuarantine writes the quarantined keys to disk, through a temporary file and a rename.
+func (s *BitcaskStorage) storeQuarantine() error {
+	keys := make([]string, 0, len(s.quarantined))
+	for key := range s.quarantined {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("error encoding quarantine: %w", err)
+	}
+
+	filePath := filepath.Join(s.storagePath, quarantineFileName)
+	tempPath := filePath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("error writing quarantine: %w", err)
+	}
+	if err := os.Rename(tempPath, filePath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("error renaming quarantine: %w", err)
+	}
+	return nil
+}
+
+// loadQuarantine reads the quarantined keys from disk, it is fine if there are none.
+func (s *BitcaskStorage) loadQuarantine() error {
+	data, err := os.ReadFile(filepath.Join(s.storagePath, quarantineFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading quarantine: %w", err)
+	}
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("error decoding quarantine: %w", err)
+	}
+	for _, key := range keys {
+		s.quarantined[key] = struct{}{}
+	}
+	return nil
+}
+
+// Scrub reads every file and verifies it, the corrupted files are quarantined and their keys are returned.
+func (s *BitcaskStorage) Scrub() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var corrupted []string
+	var errs []error
+
+	for fileKey, position := range s.index {
+		if _, err := s.readValue(fileKey, position); err != nil {
+			if storage.IsCorrupted(err) {
+				corrupted = append(corrupted, fileKey)
+			} else {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return corrupted, fmt.Errorf("encountered errors: %v", len(errs))
+	}
+	return corrupted, nil
+}
+
+// Quarantined lists the keys of the quarantined files.
+func (s *BitcaskStorage) Quarantined() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.quarantined))
+	for key := range s.quarantined {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,163 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+/*
+ * Record format, appended to the segment files:
+ *
+ *	crc (4) | flags (1) | key length (4) | meta length (4) | value length (4) | key | meta | value
+ *
+ * The CRC-32 covers everything after it, a record whose CRC doesn't match (a torn write, or bit rot) is invalid.
+ * The meta is the JSON of recordMeta, the value is the file content. A tombstone (flags & flagTombstone) deletes the
+ * key, it has no meta and no value.
+ */
+
+const headerSize = 4 + 1 + 4 + 4 + 4
+
+const flagTombstone = 1
+
+// errInvalidRecord is returned when a record is truncated or its CRC doesn't match.
+var errInvalidRecord = errors.New("invalid record")
+
+// recordMeta is the metadata of a file, kept in the record and in the in-memory index.
+type recordMeta struct {
+	Version     storage.Version `json:"version"`
+	ExpireAt    time.Time       `json:"expireAt"`
+	Owner       string          `json:"owner"`
+	Checksum    string          `json:"checksum"`
+	ContentType string          `json:"contentType"`
+	Size        int64           `json:"size"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	ModifiedAt  time.Time       `json:"modifiedAt"`
+}
+
+// expired checks if the file has expired at the given time.
+func (meta *recordMeta) expired(now time.Time) bool {
+	return !meta.ExpireAt.IsZero() && !now.Before(meta.ExpireAt)
+}
+
+// file builds the File from the metadata and the value.
+func (meta *recordMeta) file(fileKey string, value []byte) *storage.File {
+	return &storage.File{
+		Key:      fileKey,
+		Value:    value,
+		Version:  meta.Version,
+		ExpireAt: meta.ExpireAt,
+		Owner:    meta.Owner,
+		Checksum: meta.Checksum,
+	}
+}
+
+// info builds the FileInfo from the metadata.
+func (meta *recordMeta) info(fileKey string) *storage.FileInfo {
+	return &storage.FileInfo{
+		Key:         fileKey,
+		Size:        meta.Size,
+		Checksum:    meta.Checksum,
+		ContentType: meta.ContentType,
+		CreatedAt:   meta.CreatedAt,
+		ModifiedAt:  meta.ModifiedAt,
+		Owner:       meta.Owner,
+		Version:     meta.Version,
+		ExpireAt:    meta.ExpireAt,
+	}
+}
+
+// record is a decoded record.
+type record struct {
+	key       string
+	meta      *recordMeta
+	value     []byte
+	tombstone bool
+}
+
+// encodeRecord encodes the record with its header.
+func encodeRecord(rec *record) ([]byte, error) {
+	var metaData []byte
+	var flags byte
+	if rec.tombstone {
+		flags |= flagTombstone
+	} else {
+		data, err := json.Marshal(rec.meta)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding metadata: %w", err)
+		}
+		metaData = data
+	}
+
+	buf := make([]byte, headerSize+len(rec.key)+len(metaData)+len(rec.value))
+	buf[4] = flags
+	binary.BigEndian.PutUint32(buf[5:], uint32(len(rec.key)))
+	binary.BigEndian.PutUint32(buf[9:], uint32(len(metaData)))
+	binary.BigEndian.PutUint32(buf[13:], uint32(len(rec.value)))
+	n := headerSize
+	n += copy(buf[n:], rec.key)
+	n += copy(buf[n:], metaData)
+	copy(buf[n:], rec.value)
+	binary.BigEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	return buf, nil
+}
+
+// recordSize reads the header at the offset, and returns the size of the whole record.
+// It returns io.EOF at the end of the file, and errInvalidRecord for a truncated header.
+func recordSize(file *os.File, offset int64) (int64, error) {
+	header := make([]byte, headerSize)
+	n, err := file.ReadAt(header, offset)
+	if n == 0 && err == io.EOF {
+		return 0, io.EOF
+	}
+	if n < headerSize {
+		return 0, errInvalidRecord
+	}
+	keyLength := int64(binary.BigEndian.Uint32(header[5:]))
+	metaLength := int64(binary.BigEndian.Uint32(header[9:]))
+	valueLength := int64(binary.BigEndian.Uint32(header[13:]))
+	return headerSize + keyLength + metaLength + valueLength, nil
+}
+
+// readRecord reads the raw record of the given size at the offset, and checks its CRC.
+func readRecord(file *os.File, offset int64, size int64) ([]byte, error) {
+	buf := make([]byte, size)
+	if _, err := file.ReadAt(buf, offset); err != nil {
+		if err == io.EOF {
+			return nil, errInvalidRecord
+		}
+		return nil, fmt.Errorf("error reading record: %w", err)
+	}
+	if size < headerSize || binary.BigEndian.Uint32(buf) != crc32.ChecksumIEEE(buf[4:]) {
+		return nil, errInvalidRecord
+	}
+	return buf, nil
+}
+
+// decodeRecord decodes a raw record read by readRecord.
+func decodeRecord(buf []byte) (*record, error) {
+	keyLength := int(binary.BigEndian.Uint32(buf[5:]))
+	metaLength := int(binary.BigEndian.Uint32(buf[9:]))
+	n := headerSize
+	rec := &record{
+		key:       string(buf[n : n+keyLength]),
+		tombstone: buf[4]&flagTombstone != 0,
+	}
+	n += keyLength
+	if !rec.tombstone {
+		rec.meta = &recordMeta{}
+		if err := json.Unmarshal(buf[n:n+metaLength], rec.meta); err != nil {
+			return nil, errInvalidRecord
+		}
+	}
+	n += metaLength
+	rec.value = buf[n:]
+	return rec, nil
+}
@@ -0,0 +1,196 @@
+package bitcask
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// segmentSuffix is the suffix of the segment files, named after their id: 0000000001.data.
+const segmentSuffix = ".data"
+
+// segment is a log file, only the last one (the active segment) is written.
+type segment struct {
+	id   uint64
+	file *os.File
+	size int64
+}
+
+// segmentPath returns the path of the segment file.
+func (s *BitcaskStorage) segmentPath(id uint64) string {
+	return filepath.Join(s.storagePath, fmt.Sprintf("%010d%s", id, segmentSuffix))
+}
+
+// segmentIDs lists the ids of the segment files in the storage directory, in order.
+func (s *BitcaskStorage) segmentIDs() ([]uint64, error) {
+	entries, err := os.ReadDir(s.storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading storage directory: %w", err)
+	}
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// openSegment opens (or creates) the segment file.
+func (s *BitcaskStorage) openSegment(id uint64) (*segment, error) {
+	file, err := os.OpenFile(s.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening segment: %w", err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error getting segment info: %w", err)
+	}
+	return &segment{id: id, file: file, size: stat.Size()}, nil
+}
+
+// active returns the segment being written.
+func (s *BitcaskStorage) active() *segment {
+	return s.segments[s.ids[len(s.ids)-1]]
+}
+
+// rollover syncs the active segment and starts a new one.
+func (s *BitcaskStorage) rollover() error {
+	active := s.active()
+	if err := active.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing segment: %w", err)
+	}
+	next, err := s.openSegment(active.id + 1)
+	if err != nil {
+		return err
+	}
+	s.segments[next.id] = next
+	s.ids = append(s.ids, next.id)
+	return syncDir(s.storagePath)
+}
+
+// write appends the raw record to the active segment (after a rollover if it is full),
+// and returns its position.
+func (s *BitcaskStorage) write(buf []byte) (*entry, error) {
+	if active := s.active(); active.size > 0 && active.size+int64(len(buf)) > s.maxSegmentSize {
+		if err := s.rollover(); err != nil {
+			return nil, err
+		}
+		s.rolled = true
+	}
+	active := s.active()
+	if _, err := active.file.Write(buf); err != nil {
+		// drop the partial record, so the next record starts at the right offset
+		active.file.Truncate(active.size)
+		return nil, fmt.Errorf("error writing record: %w", err)
+	}
+	position := &entry{segment: active.id, offset: active.size, size: int64(len(buf))}
+	active.size += int64(len(buf))
+	s.total += int64(len(buf))
+	return position, nil
+}
+
+// load replays the segments to rebuild the index.
+// A torn record at the end of the last segment (a crash in the middle of a write) is truncated,
+// an invalid record elsewhere ends the replay of its segment, the records after it are lost.
+func (s *BitcaskStorage) load() error {
+	ids, err := s.segmentIDs()
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		ids = []uint64{1}
+	}
+
+	for i, id := range ids {
+		seg, err := s.openSegment(id)
+		if err != nil {
+			return err
+		}
+		s.segments[id] = seg
+		s.ids = append(s.ids, id)
+
+		var offset int64
+		for offset < seg.size {
+			size, err := recordSize(seg.file, offset)
+			if err == io.EOF {
+				break
+			}
+			var buf []byte
+			if err == nil {
+				buf, err = readRecord(seg.file, offset, size)
+			}
+			var rec *record
+			if err == nil {
+				rec, err = decodeRecord(buf)
+			}
+			if err != nil {
+				if i == len(ids)-1 {
+					if err := seg.file.Truncate(offset); err != nil {
+						return fmt.Errorf("error truncating segment: %w", err)
+					}
+					seg.size = offset
+				}
+				break
+			}
+			s.apply(rec, &entry{segment: id, offset: offset, size: size, meta: rec.meta})
+			s.total += size
+			offset += size
+		}
+	}
+	return nil
+}
+
+// apply updates the index with the record written at the position.
+func (s *BitcaskStorage) apply(rec *record, position *entry) {
+	if old, found := s.index[rec.key]; found {
+		s.dead += old.size
+	}
+	if rec.tombstone {
+		delete(s.index, rec.key)
+		s.ring.Remove(rec.key)
+		s.dead += position.size
+		return
+	}
+	s.index[rec.key] = position
+	s.ring.Add(rec.key)
+}
+
+// closeSegments closes all the segment files.
+func (s *BitcaskStorage) closeSegments() error {
+	var finalErr error
+	for _, seg := range s.segments {
+		if err := seg.file.Close(); err != nil {
+			finalErr = fmt.Errorf("error closing segment: %w", err)
+		}
+	}
+	s.segments = make(map[uint64]*segment)
+	s.ids = nil
+	return finalErr
+}
+
+// syncDir syncs the directory, so a new or removed file in it survives a crash.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("error opening directory: %w", err)
+	}
+	defer file.Close()
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("error syncing directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// keys returns the keys of the files that satisfy the filter, the callbacks of the iterations run on them
+// without the lock.
+func (s *BitcaskStorage) keys(filter func(string) bool) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	now := time.Now()
+	for fileKey, position := range s.index {
+		if !position.meta.expired(now) && filter(fileKey) {
+			keys = append(keys, fileKey)
+		}
+	}
+	return keys
+}
+
+// ForEachKey calls fn with the key of every file that satisfies the filter, the records are not read.
+func (s *BitcaskStorage) ForEachKey(filter func(string) bool, fn func(fileKey string) error) error {
+	for _, fileKey := range s.keys(filter) {
+		if err := fn(fileKey); err != nil {
+			if errors.Is(err, storage.ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachFile calls fn with the metadata and a reader of the value of every file that satisfies the filter.
+// A record is read at once, so only one value is in memory at a time.
+func (s *BitcaskStorage) ForEachFile(filter func(string) bool, fn func(info *storage.FileInfo, value io.Reader) error) error {
+	for _, fileKey := range s.keys(filter) {
+		file, info, err := s.readFile(fileKey)
+		if errors.Is(err, storage.ErrNotFound) || storage.IsCorrupted(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(info, bytes.NewReader(file.Value)); err != nil {
+			if storage.IsCorrupted(err) {
+				continue
+			}
+			if errors.Is(err, storage.ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readFile reads the file with its metadata, a corrupted file is quarantined by readValue.
+func (s *BitcaskStorage) readFile(fileKey string) (*storage.File, *storage.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	position, found := s.lookup(fileKey)
+	if !found {
+		return nil, nil, fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	value, err := s.readValue(fileKey, position)
+	if err != nil {
+		return nil, nil, err
+	}
+	return position.meta.file(fileKey, value), position.meta.info(fileKey), nil
+}
+
+// GetStream writes the value of the file to the writer, and returns its metadata.
+func (s *BitcaskStorage) GetStream(fileKey string, w io.Writer) (*storage.FileInfo, error) {
+	file, info, err := s.readFile(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(file.Value); err != nil {
+		return nil, fmt.Errorf("error writing value of %s: %w", fileKey, err)
+	}
+	return info, nil
+}
+
+// PutStream stores the file with the value read from the reader.
+// The length of the value is in the header of its record, so the value is read in memory first.
+func (s *BitcaskStorage) PutStream(file *storage.File, value io.Reader) error {
+	read, err := storage.ReadFile(file, value)
+	if err != nil {
+		return err
+	}
+	return s.PutFile(read)
+}
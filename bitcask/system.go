@@ -0,0 +1,544 @@
+package bitcask
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// BitcaskStorage is a storage keeping all the files in a few append-only log files (segments),
+// with an in-memory index from the key to the position of its latest record (bitcask).
+// A write appends a record, a delete appends a tombstone, and the space of the overwritten and deleted records
+// is reclaimed by the compaction. It suits many small files, which would waste an inode and an fsync each as
+// separate files.
+type BitcaskStorage struct {
+	storagePath    string // Path of the directory keeping the segments
+	maxSegmentSize int64  // The active segment is rolled over when it reaches this size
+	syncWrites     bool   // Sync the active segment after every write (a batch of PutFiles is synced once)
+
+	segments map[uint64]*segment // The open segments by id
+	ids      []uint64            // The ids of the segments in order, the last one is the active segment
+	index    map[string]*entry   // The position and metadata of the latest record of every key
+	ring     *storage.KeyIndex   // The keys of the index sorted by identifier, for GetRange and ExtractRange
+	total    int64               // The size of all the records in the segments
+	dead     int64               // The size of the records overwritten or deleted, reclaimed by the compaction
+	rolled   bool                // A segment was rolled over since the last compaction check
+
+	quarantined map[string]struct{}  // The keys of the corrupted files, until they are stored again
+	transfers   *storage.TransferLog // Pending transfers of the files, see BeginTransfer
+
+	mu sync.Mutex // Mutex to ensure thread safety
+}
+
+// entry is the position of a record in the segments, with the metadata of the file.
+type entry struct {
+	segment uint64
+	offset  int64
+	size    int64
+	meta    *recordMeta
+}
+
+// NewStorage opens the storage at storagePath with default settings, the existing segments are replayed.
+func NewStorage(storagePath string) (*BitcaskStorage, error) {
+	defaultMaxSegmentSize := int64(64 * 1024 * 1024) // 64MB
+	return NewStorageWithSetting(storagePath, defaultMaxSegmentSize, true)
+}
+
+// NewStorageWithSetting opens the storage at storagePath with a max segment size and the sync policy.
+func NewStorageWithSetting(storagePath string, maxSegmentSize int64, syncWrites bool) (*BitcaskStorage, error) {
+	if err := os.MkdirAll(storagePath, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("error creating directory: %w", err)
+	}
+
+	s := &BitcaskStorage{
+		storagePath:    storagePath,
+		maxSegmentSize: maxSegmentSize,
+		syncWrites:     syncWrites,
+		segments:       make(map[uint64]*segment),
+		index:          make(map[string]*entry),
+		ring:           storage.NewKeyIndex(),
+		quarantined:    make(map[string]struct{}),
+	}
+	if err := s.load(); err != nil {
+		s.closeSegments()
+		return nil, err
+	}
+	if err := s.loadQuarantine(); err != nil {
+		s.closeSegments()
+		return nil, err
+	}
+	transfers, err := storage.OpenTransferLog(filepath.Join(storagePath, transferFileName))
+	if err != nil {
+		s.closeSegments()
+		return nil, err
+	}
+	s.transfers = transfers
+	return s, nil
+}
+
+// Close closes the segment files, the storage can't be used after it.
+func (s *BitcaskStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closeSegments()
+}
+
+// lookup finds the entry of a file which is not expired.
+func (s *BitcaskStorage) lookup(fileKey string) (*entry, bool) {
+	position, found := s.index[fileKey]
+	if !found || position.meta.expired(time.Now()) {
+		return nil, false
+	}
+	return position, true
+}
+
+// newMeta builds the metadata of the file, the creation time is kept if the fileKey is already stored.
+func (s *BitcaskStorage) newMeta(file *storage.File) *recordMeta {
+	now := time.Now()
+	meta := &recordMeta{
+		Version:     file.Version,
+		ExpireAt:    file.ExpireAt,
+		Owner:       file.Owner,
+		Checksum:    storage.Checksum(file.Value),
+		ContentType: storage.ContentType(file.Key, file.Value),
+		Size:        int64(len(file.Value)),
+		CreatedAt:   now,
+		ModifiedAt:  now,
+	}
+	if old, found := s.lookup(file.Key); found {
+		meta.CreatedAt = old.meta.CreatedAt
+	}
+	return meta
+}
+
+// validate checks if the files can be stored: their keys are not empty, and their checksums are right.
+func validate(files storage.FileList) error {
+	for _, file := range files {
+		if file.Key == "" {
+			return fmt.Errorf("%w: empty key", storage.ErrInvalidKey)
+		}
+		if err := file.Verify(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putFiles appends the records of the files, and syncs them once.
+// A list with an invalid key or a wrong checksum is rejected as a whole.
+func (s *BitcaskStorage) putFiles(files storage.FileList) error {
+	if err := validate(files); err != nil {
+		return err
+	}
+
+	var finalErr error
+	for _, file := range files {
+		rec := &record{key: file.Key, meta: s.newMeta(file), value: file.Value}
+		if err := s.append(rec); err != nil {
+			finalErr = err
+			break
+		}
+		delete(s.quarantined, file.Key)
+	}
+
+	if err := s.sync(); err != nil && finalErr == nil {
+		finalErr = err
+	}
+	if err := s.storeQuarantine(); err != nil && finalErr == nil {
+		finalErr = err
+	}
+	if finalErr == nil {
+		finalErr = s.maybeCompact()
+	}
+	return finalErr
+}
+
+// deleteFile appends the tombstone of the file, and syncs it.
+func (s *BitcaskStorage) deleteFile(fileKey string) error {
+	if err := s.append(&record{key: fileKey, tombstone: true}); err != nil {
+		return err
+	}
+	return s.sync()
+}
+
+// append writes the record and updates the index, it is not synced.
+func (s *BitcaskStorage) append(rec *record) error {
+	buf, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+	position, err := s.write(buf)
+	if err != nil {
+		return err
+	}
+	position.meta = rec.meta
+	s.apply(rec, position)
+	return nil
+}
+
+// sync syncs the active segment if syncWrites is set.
+func (s *BitcaskStorage) sync() error {
+	if !s.syncWrites {
+		return nil
+	}
+	if err := s.active().file.Sync(); err != nil {
+		return fmt.Errorf("error syncing segment: %w", err)
+	}
+	return nil
+}
+
+// readValue reads the value of the file, and verifies it against its CRC and checksum.
+// A corrupted file is quarantined and ErrCorrupted is returned.
+func (s *BitcaskStorage) readValue(fileKey string, position *entry) ([]byte, error) {
+	seg, found := s.segments[position.segment]
+	if !found {
+		return nil, fmt.Errorf("segment %d of %s is missing", position.segment, fileKey)
+	}
+	buf, err := readRecord(seg.file, position.offset, position.size)
+	var rec *record
+	if err == nil {
+		rec, err = decodeRecord(buf)
+	}
+	if err == errInvalidRecord || err == nil && storage.Checksum(rec.value) != position.meta.Checksum {
+		if err := s.quarantine(fileKey); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", storage.ErrCorrupted, fileKey, err)
+		}
+		return nil, fmt.Errorf("%w: %s", storage.ErrCorrupted, fileKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec.value, nil
+}
+
+// CheckFiles checks if the segments of the indexed files still exist on disk.
+func (s *BitcaskStorage) CheckFiles() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, seg := range s.segments {
+		if _, err := os.Stat(s.segmentPath(id)); !os.IsNotExist(err) {
+			continue
+		}
+		for fileKey, position := range s.index {
+			if position.segment == seg.id {
+				delete(s.index, fileKey)
+				s.ring.Remove(fileKey)
+			}
+		}
+	}
+}
+
+func (s *BitcaskStorage) GetFilesName() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.index))
+	for key, position := range s.index {
+		if position.meta.expired(now) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Get retrieves the value associated with the given fileKey.
+func (s *BitcaskStorage) Get(fileKey string) ([]byte, error) {
+	file, err := s.GetFile(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return file.Value, nil
+}
+
+// GetFile retrieves the file associated with the given fileKey, with its version.
+func (s *BitcaskStorage) GetFile(fileKey string) (*storage.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	position, found := s.lookup(fileKey)
+	if !found {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	value, err := s.readValue(fileKey, position)
+	if err != nil {
+		return nil, err
+	}
+	return position.meta.file(fileKey, value), nil
+}
+
+// Stat returns the metadata of the file, without reading its value.
+func (s *BitcaskStorage) Stat(fileKey string) (*storage.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	position, found := s.lookup(fileKey)
+	if !found {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	return position.meta.info(fileKey), nil
+}
+
+// Put stores the value associated with the given fileKey, with the zero version.
+func (s *BitcaskStorage) Put(fileKey string, value []byte) error {
+	return s.PutFile(&storage.File{Key: fileKey, Value: value})
+}
+
+// PutFile stores the file together with its version and expiry time.
+func (s *BitcaskStorage) PutFile(file *storage.File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.putFiles(storage.FileList{file})
+}
+
+// PutWithTTL stores the value associated with the given fileKey, with the zero version,
+// the file expires after ttl.
+func (s *BitcaskStorage) PutWithTTL(fileKey string, value []byte, ttl time.Duration) error {
+	return s.PutFile(&storage.File{Key: fileKey, Value: value, ExpireAt: time.Now().Add(ttl)})
+}
+
+// Update updates the value associated with the given fileKey, with the zero version.
+func (s *BitcaskStorage) Update(fileKey string, newValue []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.lookup(fileKey); !found {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	return s.putFiles(storage.FileList{{Key: fileKey, Value: newValue}})
+}
+
+// Delete removes the file associated with the given fileKey.
+func (s *BitcaskStorage) Delete(fileKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.index[fileKey]; !found {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	return s.deleteFile(fileKey)
+}
+
+// PutIfAbsent stores the file only if the fileKey is not in the storage yet.
+func (s *BitcaskStorage) PutIfAbsent(file *storage.File) (storage.Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if position, found := s.lookup(file.Key); found {
+		return position.meta.Version, fmt.Errorf("%w: %s", storage.ErrExists, file.Key)
+	}
+	if err := s.putFiles(storage.FileList{file}); err != nil {
+		return storage.Version{}, err
+	}
+	return file.Version, nil
+}
+
+// CompareAndSwap stores the file only if the current version of the fileKey is the expected one.
+func (s *BitcaskStorage) CompareAndSwap(file *storage.File, expected storage.Version) (storage.Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	position, found := s.lookup(file.Key)
+	if !found {
+		return storage.Version{}, fmt.Errorf("%w: %s", storage.ErrNotFound, file.Key)
+	}
+	if position.meta.Version != expected {
+		return position.meta.Version, fmt.Errorf("%w: %s", storage.ErrVersionMismatch, file.Key)
+	}
+	version := position.meta.Version
+	if err := s.putFiles(storage.FileList{file}); err != nil {
+		return version, err
+	}
+	return file.Version, nil
+}
+
+// DeleteIfVersion removes the file only if its current version is the expected one.
+func (s *BitcaskStorage) DeleteIfVersion(fileKey string, expected storage.Version) (storage.Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	position, found := s.lookup(fileKey)
+	if !found {
+		return storage.Version{}, fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	if position.meta.Version != expected {
+		return position.meta.Version, fmt.Errorf("%w: %s", storage.ErrVersionMismatch, fileKey)
+	}
+	version := position.meta.Version
+	if err := s.deleteFile(fileKey); err != nil {
+		return version, err
+	}
+	return storage.Version{}, nil
+}
+
+// GetFilesByFilter gets the files that satisfy the filter, the corrupted files are quarantined and skipped.
+func (s *BitcaskStorage) GetFilesByFilter(filter func(string) bool) (storage.FileList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.filesByFilter(filter)
+}
+
+// GetRange gets the files with an identifier in (lo, hi], the corrupted files are quarantined and skipped.
+func (s *BitcaskStorage) GetRange(lo, hi *big.Int) (storage.FileList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.readFiles(s.ring.Range(lo, hi))
+}
+
+// filesByFilter reads the files that satisfy the filter.
+func (s *BitcaskStorage) filesByFilter(filter func(string) bool) (storage.FileList, error) {
+	var keys []string
+	for fileKey := range s.index {
+		if filter(fileKey) {
+			keys = append(keys, fileKey)
+		}
+	}
+	return s.readFiles(keys)
+}
+
+// readFiles reads the files of the keys, the expired and missing ones are skipped.
+func (s *BitcaskStorage) readFiles(keys []string) (storage.FileList, error) {
+	var files storage.FileList
+	now := time.Now()
+	for _, fileKey := range keys {
+		position, found := s.index[fileKey]
+		if !found || position.meta.expired(now) {
+			continue
+		}
+		value, err := s.readValue(fileKey, position)
+		if storage.IsCorrupted(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, position.meta.file(fileKey, value))
+	}
+	return files, nil
+}
+
+// PutFiles stores the given files, they are synced once.
+func (s *BitcaskStorage) PutFiles(files storage.FileList) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.putFiles(files)
+}
+
+// PutFilesIfNewer stores the given files, except those the storage has a newer version of.
+// The list is validated as a whole first, see PutFiles.
+func (s *BitcaskStorage) PutFilesIfNewer(files storage.FileList) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := validate(files); err != nil {
+		return err
+	}
+	var newer storage.FileList
+	for _, file := range files {
+		if position, found := s.lookup(file.Key); found && position.meta.Version.After(file.Version) {
+			continue
+		}
+		newer = append(newer, file)
+	}
+	if len(newer) == 0 {
+		return nil
+	}
+	return s.putFiles(newer)
+}
+
+// GetAllFiles retrieves all files from the storage.
+func (s *BitcaskStorage) GetAllFiles() (storage.FileList, error) {
+	return s.GetFilesByFilter(func(string) bool { return true })
+}
+
+// Clear removes all the files, the segments are removed and a new one is started.
+func (s *BitcaskStorage) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.closeSegments(); err != nil {
+		return err
+	}
+	s.index = make(map[string]*entry)
+	s.ring.Clear()
+	s.quarantined = make(map[string]struct{})
+	s.total, s.dead = 0, 0
+
+	if err := os.RemoveAll(s.storagePath); err != nil {
+		return fmt.Errorf("error clearing storage directory: %w", err)
+	}
+	if err := os.MkdirAll(s.storagePath, os.ModePerm); err != nil {
+		return fmt.Errorf("error recreating storage directory: %w", err)
+	}
+	if err := s.transfers.Clear(); err != nil {
+		return err
+	}
+	return s.load()
+}
+
+// ExtractFilesByFilter extracts the files that match the filter and returns them as a FileList.
+// It also removes the files from the storage, the tombstones are synced once.
+func (s *BitcaskStorage) ExtractFilesByFilter(filter func(string) bool) (storage.FileList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.filesByFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.removeFiles(files)
+}
+
+// ExtractRange extracts the files with an identifier in (lo, hi], see ExtractFilesByFilter.
+func (s *BitcaskStorage) ExtractRange(lo, hi *big.Int) (storage.FileList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.readFiles(s.ring.Range(lo, hi))
+	if err != nil {
+		return nil, err
+	}
+	return s.removeFiles(files)
+}
+
+// removeFiles appends the tombstones of the files read by an extraction, and syncs them once.
+func (s *BitcaskStorage) removeFiles(files storage.FileList) (storage.FileList, error) {
+	for i, file := range files {
+		if err := s.append(&record{key: file.Key, tombstone: true}); err != nil {
+			// the files not removed are still in the storage, so they are not returned
+			return files[:i], err
+		}
+	}
+	return files, s.sync()
+}
+
+// RemoveExpired removes the expired files, and returns their keys.
+func (s *BitcaskStorage) RemoveExpired() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed []string
+	now := time.Now()
+	for fileKey, position := range s.index {
+		if !position.meta.expired(now) {
+			continue
+		}
+		if err := s.append(&record{key: fileKey, tombstone: true}); err != nil {
+			return removed, err
+		}
+		removed = append(removed, fileKey)
+	}
+	return removed, s.sync()
+}
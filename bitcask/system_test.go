@@ -0,0 +1,275 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+func setupTestStorageSystem(t *testing.T) *BitcaskStorage {
+	storagePath := "./test_storage"
+
+	// Clean up before starting the test
+	os.RemoveAll(storagePath)
+
+	ss, err := NewStorage(storagePath)
+	if err != nil {
+		t.Fatalf("Failed to create storage system: %v", err)
+	}
+
+	return ss
+}
+
+// teardown closes the storage and removes its directory.
+func teardown(ss *BitcaskStorage) {
+	ss.Close()
+	os.RemoveAll(ss.storagePath)
+}
+
+// reopen closes the storage and opens it again, as after a restart.
+func reopen(t *testing.T, ss *BitcaskStorage) *BitcaskStorage {
+	ss.Close()
+	reopened, err := NewStorageWithSetting(ss.storagePath, ss.maxSegmentSize, ss.syncWrites)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage system: %v", err)
+	}
+	return reopened
+}
+
+func TestCorruptionQuarantine(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer teardown(ss)
+
+	ss.Put("healthy", []byte("healthy"))
+	ss.Put("corrupted", []byte("corrupted"))
+
+	// flip the last byte of the value behind the storage's back
+	position := ss.index["corrupted"]
+	data, _ := os.ReadFile(ss.segmentPath(position.segment))
+	data[position.offset+position.size-1] ^= 0xff
+	os.WriteFile(ss.segmentPath(position.segment), data, 0644)
+
+	corrupted, err := ss.Scrub()
+	if err != nil || len(corrupted) != 1 || corrupted[0] != "corrupted" {
+		t.Fatalf("Expected [corrupted], got %v, %v", corrupted, err)
+	}
+	if _, err := ss.Get("corrupted"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected quarantined file to be absent, got %v", err)
+	}
+
+	// the quarantine survives a restart, until the file is stored again
+	ss = reopen(t, ss)
+	if quarantined := ss.Quarantined(); len(quarantined) != 1 || quarantined[0] != "corrupted" {
+		t.Fatalf("Expected [corrupted] in quarantine, got %v", quarantined)
+	}
+	ss.Put("corrupted", []byte("corrupted"))
+	if quarantined := ss.Quarantined(); len(quarantined) != 0 {
+		t.Fatalf("Expected empty quarantine, got %v", quarantined)
+	}
+	if value, err := ss.Get("healthy"); err != nil || !bytes.Equal(value, []byte("healthy")) {
+		t.Fatalf("Expected healthy file to be kept, got %s, %v", value, err)
+	}
+}
+
+func TestTornWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		cut  func(position *entry) int64 // the size left of the segment
+	}{
+		{"TornValue", func(position *entry) int64 { return position.offset + position.size - 3 }},
+		{"TornHeader", func(position *entry) int64 { return position.offset + headerSize/2 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := setupTestStorageSystem(t)
+			defer teardown(ss)
+
+			ss.Put("testfile1", []byte("testdata1"))
+			ss.Put("testfile2", []byte("testdata2"))
+
+			// a crash in the middle of the second write leaves a part of its record
+			position := ss.index["testfile2"]
+			ss.Close()
+			os.Truncate(ss.segmentPath(position.segment), tt.cut(position))
+
+			ss = reopen(t, ss)
+			if value, err := ss.Get("testfile1"); err != nil || !bytes.Equal(value, []byte("testdata1")) {
+				t.Fatalf("Expected testfile1 to be kept, got %s, %v", value, err)
+			}
+			if _, err := ss.Get("testfile2"); !errors.Is(err, storage.ErrNotFound) {
+				t.Fatalf("Expected the torn record to be dropped, got %v", err)
+			}
+
+			// the torn tail is truncated, so the next record is readable after a restart
+			ss.Put("testfile3", []byte("testdata3"))
+			ss = reopen(t, ss)
+			if value, err := ss.Get("testfile3"); err != nil || !bytes.Equal(value, []byte("testdata3")) {
+				t.Fatalf("Expected testfile3 after restart, got %s, %v", value, err)
+			}
+		})
+	}
+}
+
+func TestCorruptionEndsSegmentReplay(t *testing.T) {
+	os.RemoveAll("./test_storage")
+	ss, err := NewStorageWithSetting("./test_storage", 4096, true)
+	if err != nil {
+		t.Fatalf("Failed to create storage system: %v", err)
+	}
+	defer teardown(ss)
+
+	ss.Put("before", []byte("before"))
+	ss.Put("corrupted", []byte("corrupted"))
+	ss.Put("after", []byte("after"))
+	for i := 0; ss.index["after"].segment == ss.active().id; i++ {
+		ss.Put(fmt.Sprintf("filler%d", i), []byte("filler"))
+	}
+	if ss.index["before"].segment != ss.index["after"].segment {
+		t.Fatal("Expected the three files in the same segment")
+	}
+
+	// an invalid record which is not at the end of the last segment is not a torn write
+	position := ss.index["corrupted"]
+	ss.Close()
+	data, _ := os.ReadFile(ss.segmentPath(position.segment))
+	data[position.offset+position.size-1] ^= 0xff
+	os.WriteFile(ss.segmentPath(position.segment), data, 0644)
+	size := int64(len(data))
+
+	ss = reopen(t, ss)
+	if value, err := ss.Get("before"); err != nil || !bytes.Equal(value, []byte("before")) {
+		t.Fatalf("Expected the file before the corrupted record to be kept, got %s, %v", value, err)
+	}
+	for _, key := range []string{"corrupted", "after"} {
+		if _, err := ss.Get(key); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("Expected %s to be lost, got %v", key, err)
+		}
+	}
+	if stat, err := os.Stat(ss.segmentPath(position.segment)); err != nil || stat.Size() != size {
+		t.Fatalf("Expected the segment not to be truncated, got %v, %v", stat, err)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	os.RemoveAll("./test_storage")
+	ss, err := NewStorageWithSetting("./test_storage", 256, true)
+	if err != nil {
+		t.Fatalf("Failed to create storage system: %v", err)
+	}
+	defer teardown(ss)
+
+	// overwrite the same keys many times, so most of the records are dead
+	for i := 0; i < 50; i++ {
+		for _, key := range []string{"testfile1", "testfile2"} {
+			if err := ss.Put(key, []byte(key+"-"+string(rune('a'+i%26)))); err != nil {
+				t.Fatalf("Failed to put file: %v", err)
+			}
+		}
+	}
+	ss.Put("deleted", []byte("deleted"))
+	ss.Delete("deleted")
+
+	if err := ss.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if ss.dead != 0 {
+		t.Fatalf("Expected no dead record after compaction, got %d bytes", ss.dead)
+	}
+	ids, _ := ss.segmentIDs()
+	if len(ids) > 2 {
+		t.Fatalf("Expected the segments to be reclaimed, got %d", len(ids))
+	}
+
+	ss = reopen(t, ss)
+	for _, key := range []string{"testfile1", "testfile2"} {
+		value, err := ss.Get(key)
+		if err != nil || !bytes.Equal(value, []byte(key+"-x")) {
+			t.Fatalf("Expected %s-x, got %s, %v", key, value, err)
+		}
+	}
+	if _, err := ss.Get("deleted"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected deleted file to stay deleted, got %v", err)
+	}
+}
+
+func TestMaybeCompact(t *testing.T) {
+	os.RemoveAll("./test_storage")
+	ss, err := NewStorageWithSetting("./test_storage", 256, true)
+	if err != nil {
+		t.Fatalf("Failed to create storage system: %v", err)
+	}
+	defer teardown(ss)
+
+	// live records only: the segments roll over, but nothing is worth compacting
+	for i := 0; i < 20; i++ {
+		ss.Put(fmt.Sprintf("testfile%d", i), []byte("testdata"))
+	}
+	// a quarter of dead records is below the threshold
+	for i := 0; i < 5; i++ {
+		ss.Put(fmt.Sprintf("testfile%d", i), []byte("testdata"))
+	}
+	if len(ss.ids) < 2 || ss.ids[0] != 1 {
+		t.Fatalf("Expected no compaction below half of dead records, got segments %v", ss.ids)
+	}
+
+	// more than half of dead records, the next rollover compacts
+	for i := 0; i < 100 && ss.ids[0] == 1; i++ {
+		ss.Put("testfile0", []byte("testdata"))
+	}
+	if ss.ids[0] == 1 {
+		t.Fatalf("Expected a compaction above half of dead records, got segments %v, %d/%d dead", ss.ids, ss.dead, ss.total)
+	}
+	if ss.dead*2 > ss.total {
+		t.Fatalf("Expected the dead records to be reclaimed, got %d/%d dead", ss.dead, ss.total)
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := ss.Get(fmt.Sprintf("testfile%d", i)); err != nil {
+			t.Fatalf("Expected testfile%d to be kept, got %v", i, err)
+		}
+	}
+}
+
+func TestCompactionCrash(t *testing.T) {
+	os.RemoveAll("./test_storage")
+	ss, err := NewStorageWithSetting("./test_storage", 256, true)
+	if err != nil {
+		t.Fatalf("Failed to create storage system: %v", err)
+	}
+	defer teardown(ss)
+
+	for i := 0; i < 10; i++ {
+		ss.Put("testfile", []byte(fmt.Sprintf("testdata%d", i)))
+	}
+	ss.Put("deleted", []byte("deleted"))
+	ss.Delete("deleted")
+
+	// keep the old segments, as if the crash happened after the copy but before their removal
+	old := make(map[uint64][]byte)
+	for _, id := range ss.ids {
+		data, err := os.ReadFile(ss.segmentPath(id))
+		if err != nil {
+			t.Fatalf("Failed to read segment: %v", err)
+		}
+		old[id] = data
+	}
+	if err := ss.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	ss.Close()
+	for id, data := range old {
+		os.WriteFile(ss.segmentPath(id), data, 0644)
+	}
+
+	// the copies come after the old records, so the replay ends on the same files
+	ss = reopen(t, ss)
+	if value, err := ss.Get("testfile"); err != nil || !bytes.Equal(value, []byte("testdata9")) {
+		t.Fatalf("Expected testdata9, got %s, %v", value, err)
+	}
+	if _, err := ss.Get("deleted"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected deleted file to stay deleted, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package bitcask
+
+import (
+	"math/big"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// transferFileName is the file (in the storage directory) keeping the log of the pending transfers.
+const transferFileName = "transfers.json"
+
+// BeginTransfer starts a transfer of the files in (lo, hi] to the target,
+// they stay in the storage until CommitTransfer.
+func (s *BitcaskStorage) BeginTransfer(lo, hi *big.Int, target string) (string, storage.FileList, error) {
+	return storage.BeginTransfer(s, s.transfers, lo, hi, target)
+}
+
+// BeginTransferFiles starts a transfer of the files to the target, the ones already in a pending transfer are
+// left out, they stay in the storage until CommitTransfer.
+func (s *BitcaskStorage) BeginTransferFiles(files storage.FileList, target string) (string, storage.FileList, error) {
+	return s.transfers.Begin(files, target)
+}
+
+// CommitTransfer removes the delivered files of the transfer, unless they changed since it began, and ends it.
+func (s *BitcaskStorage) CommitTransfer(id string, delivered []string) error {
+	return storage.CommitTransfer(s, s.transfers, id, delivered)
+}
+
+// AbortTransfer ends the transfer, its files are kept.
+func (s *BitcaskStorage) AbortTransfer(id string) error {
+	return s.transfers.End(id)
+}
+
+// PendingTransfers returns the transfers not committed or aborted yet, including the ones from before a restart.
+func (s *BitcaskStorage) PendingTransfers() []*storage.Transfer {
+	return s.transfers.Pending()
+}
@@ -0,0 +1,164 @@
+package storage
+
+// arcCache is an adaptive replacement cache (ARC), sized in bytes.
+// The cached values are split in t1 (used once recently) and t2 (used at least twice),
+// and the ghost lists b1 and b2 remember the keys recently evicted from them, without the values.
+// A miss on a ghost key of b1 means t1 was too small, so its target size p grows, and a miss on b2 shrinks it.
+type arcCache struct {
+	capacity int64
+	p        int64 // the target size of t1
+	t1, t2   *cacheList
+	b1, b2   *cacheList
+	onEvict  func(string)
+}
+
+func newARCCache(capacity int64, onEvict func(string)) *arcCache {
+	return &arcCache{
+		capacity: capacity,
+		t1:       newCacheList(),
+		t2:       newCacheList(),
+		b1:       newCacheList(),
+		b2:       newCacheList(),
+		onEvict:  onEvict,
+	}
+}
+
+// find gets the cached entry of the key, and the list keeping it.
+func (c *arcCache) find(key string) (*cacheEntry, *cacheList) {
+	if entry, found := c.t1.find(key); found {
+		return entry, c.t1
+	}
+	if entry, found := c.t2.find(key); found {
+		return entry, c.t2
+	}
+	return nil, nil
+}
+
+func (c *arcCache) get(key string) ([]byte, bool) {
+	entry, owner := c.find(key)
+	if entry == nil {
+		return nil, false
+	}
+	// a value used again moves to t2
+	owner.remove(key)
+	c.t2.pushFront(entry)
+	return entry.value, true
+}
+
+func (c *arcCache) peek(key string) ([]byte, bool) {
+	entry, _ := c.find(key)
+	if entry == nil {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *arcCache) add(key string, value []byte) {
+	size := entrySize(key, value)
+
+	if entry, owner := c.find(key); entry != nil {
+		owner.remove(key)
+		entry.value, entry.size = value, size
+		c.t2.pushFront(entry)
+		c.replace(key, false)
+		return
+	}
+
+	entry := &cacheEntry{key: key, value: value, size: size}
+	if ghost, found := c.b1.remove(key); found {
+		// t1 was too small for this key
+		c.p = min(c.capacity, c.p+ghost.size*max(1, c.b2.size/(c.b1.size+ghost.size)))
+		c.t2.pushFront(entry)
+		c.replace(key, false)
+		return
+	}
+	if ghost, found := c.b2.remove(key); found {
+		// t2 was too small for this key
+		c.p = max(0, c.p-ghost.size*max(1, c.b1.size/(c.b2.size+ghost.size)))
+		c.t2.pushFront(entry)
+		c.replace(key, true)
+		return
+	}
+
+	c.t1.pushFront(entry)
+	c.replace(key, false)
+}
+
+// replace evicts the values until the cached ones fit in the budget, the value of keep is never evicted.
+// t1 gives up its values while it is over its target size, and the evicted keys move to the ghost lists.
+// The ghost lists are then trimmed, so t1+b1 and the whole directory stay within one and two budgets.
+func (c *arcCache) replace(keep string, fromB2 bool) {
+	for c.t1.size+c.t2.size > c.capacity {
+		var evicted *cacheEntry
+		fromT1 := c.t1.size > 0 && (c.t1.size > c.p || fromB2 && c.t1.size == c.p) || c.t2.size == 0
+		if fromT1 {
+			evicted = c.evictFrom(c.t1, keep)
+		} else {
+			evicted = c.evictFrom(c.t2, keep)
+		}
+		if evicted == nil {
+			// only the kept value is left in the chosen list, take from the other one
+			if fromT1 {
+				evicted = c.evictFrom(c.t2, keep)
+			} else {
+				evicted = c.evictFrom(c.t1, keep)
+			}
+		}
+		if evicted == nil {
+			break
+		}
+	}
+
+	for c.t1.size+c.b1.size > c.capacity && c.b1.len() > 0 {
+		c.b1.removeBack()
+	}
+	for c.t1.size+c.t2.size+c.b1.size+c.b2.size > 2*c.capacity && c.b2.len() > 0 {
+		c.b2.removeBack()
+	}
+}
+
+// evictFrom evicts the least recently used value of t1 or t2 (except keep) to its ghost list.
+func (c *arcCache) evictFrom(l *cacheList, keep string) *cacheEntry {
+	entry := l.back()
+	if entry != nil && entry.key == keep {
+		entry = nil
+		if element := l.items[keep].Prev(); element != nil {
+			entry = element.Value.(*cacheEntry)
+		}
+	}
+	if entry == nil {
+		return nil
+	}
+	l.remove(entry.key)
+	ghost := &cacheEntry{key: entry.key, size: entry.size}
+	if l == c.t1 {
+		c.b1.pushFront(ghost)
+	} else {
+		c.b2.pushFront(ghost)
+	}
+	c.onEvict(entry.key)
+	return entry
+}
+
+func (c *arcCache) remove(key string) {
+	c.t1.remove(key)
+	c.t2.remove(key)
+	c.b1.remove(key)
+	c.b2.remove(key)
+}
+
+func (c *arcCache) clear() {
+	c.t1.clear()
+	c.t2.clear()
+	c.b1.clear()
+	c.b2.clear()
+	c.p = 0
+}
+
+func (c *arcCache) bytes() int64 {
+	return c.t1.size + c.t2.size
+}
+
+func (c *arcCache) len() int {
+	return c.t1.len() + c.t2.len()
+}
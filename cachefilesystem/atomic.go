@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// tempDirName is the directory (under storagePath) keeping the files being written.
+// It is on the same file system as the storage, so the rename is atomic.
+const tempDirName = ".tmp"
+
+// writeFileAtomic writes the data to the path: the data is written to a temporary file and synced,
+// then the temporary file is renamed to the path and the directory is synced.
+// A crash leaves either the old or the new file at the path, never a partial one, and a temporary file
+// which is removed by cleanTemp at startup.
+func (s *CacheStorageSystem) writeFileAtomic(path string, data []byte) error {
+	return s.writeStreamAtomic(path, bytes.NewReader(data), nil)
+}
+
+// writeStreamAtomic is writeFileAtomic for the data read from the reader, it is never fully in memory.
+// If check is not nil, it is called once the data is written, and the file is only renamed if it returns nil.
+func (s *CacheStorageSystem) writeStreamAtomic(path string, reader io.Reader, check func() error) error {
+	tempDir := filepath.Join(s.storagePath, tempDirName)
+	if err := os.MkdirAll(tempDir, os.ModePerm); err != nil {
+		return fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("error creating directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(tempDir, filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+	tempPath := file.Name()
+
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("error writing to file: %w", err)
+	}
+	if check != nil {
+		if err := check(); err != nil {
+			file.Close()
+			os.Remove(tempPath)
+			return err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("error syncing file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("error closing file: %w", err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("error renaming file: %w", err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir syncs the directory, so a rename or a new entry in it survives a crash.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("error opening directory: %w", err)
+	}
+	defer file.Close()
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("error syncing directory: %w", err)
+	}
+	return nil
+}
+
+// cleanTemp removes the temporary files left by the writes interrupted by a crash.
+// They were never renamed, so the files at their final paths are still the old ones.
+func (s *CacheStorageSystem) cleanTemp() error {
+	if err := os.RemoveAll(filepath.Join(s.storagePath, tempDirName)); err != nil {
+		return fmt.Errorf("error removing temporary files: %w", err)
+	}
+	return nil
+}
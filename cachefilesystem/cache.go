@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// The cache policies, deciding which values are kept in the cache when it is full.
+const (
+	CacheLRU     = "lru"      // evicts the least recently used value
+	CacheLFU     = "lfu"      // evicts the least frequently used value, the least recently used one among ties
+	CacheARC     = "arc"      // balances recency and frequency, adapting to the recent misses (adaptive replacement cache)
+	CacheTinyLFU = "wtinylfu" // admits a value only if it is used more often than the one it would evict (W-TinyLFU)
+)
+
+// CacheStats are the statistics of the cache of a storage.
+type CacheStats struct {
+	Policy    string
+	Capacity  int64 // the byte budget of the cache
+	Bytes     int64 // the bytes of the cached keys and values
+	Entries   int
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64 // the values evicted (or not admitted) to stay within the budget
+}
+
+// HitRatio returns the ratio of the reads served by the cache, 0 if there is no read yet.
+func (stats CacheStats) HitRatio() float64 {
+	if stats.Hits+stats.Misses == 0 {
+		return 0
+	}
+	return float64(stats.Hits) / float64(stats.Hits+stats.Misses)
+}
+
+// cachePolicy keeps the cached values within a byte budget, the size of a value is entrySize.
+// get and add count as uses of the key (peek doesn't), add replaces the cached value if the key is cached,
+// and the policy calls its onEvict for every value it evicts or doesn't admit.
+type cachePolicy interface {
+	get(key string) ([]byte, bool)
+	peek(key string) ([]byte, bool)
+	add(key string, value []byte)
+	remove(key string)
+	clear()
+	bytes() int64
+	len() int
+}
+
+// entrySize is the size of a cached value in the byte budget, its key and its value.
+func entrySize(key string, value []byte) int64 {
+	return int64(len(key) + len(value))
+}
+
+// valueCache is the cache of the storage, a cache policy with hit and miss statistics.
+// It is not thread safe, the storage holds its lock.
+type valueCache struct {
+	policyName string
+	capacity   int64
+	policy     cachePolicy
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// newValueCache creates a cache of capacity bytes with the policy.
+func newValueCache(capacity int64, policyName string) (*valueCache, error) {
+	if capacity < 0 {
+		return nil, fmt.Errorf("invalid cache capacity: %d", capacity)
+	}
+	c := &valueCache{policyName: policyName, capacity: capacity}
+	onEvict := func(string) { c.evictions++ }
+	switch policyName {
+	case CacheLRU:
+		c.policy = newLRUCache(capacity, onEvict)
+	case CacheLFU:
+		c.policy = newLFUCache(capacity, onEvict)
+	case CacheARC:
+		c.policy = newARCCache(capacity, onEvict)
+	case CacheTinyLFU:
+		c.policy = newTinyLFUCache(capacity, onEvict)
+	default:
+		return nil, fmt.Errorf("unknown cache policy: %s", policyName)
+	}
+	return c, nil
+}
+
+// get gets the cached value of the key, and counts the hit or the miss.
+func (c *valueCache) get(key string) ([]byte, bool) {
+	value, found := c.policy.get(key)
+	if found {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return value, found
+}
+
+// add caches the value of the key, a value larger than the whole budget is not cached.
+func (c *valueCache) add(key string, value []byte) {
+	if entrySize(key, value) > c.capacity {
+		c.policy.remove(key)
+		return
+	}
+	c.policy.add(key, value)
+}
+
+// contains checks if the key is cached, without counting it as a use.
+func (c *valueCache) contains(key string) bool {
+	_, found := c.peek(key)
+	return found
+}
+
+// peek gets the cached value of the key, without counting it as a use.
+func (c *valueCache) peek(key string) ([]byte, bool) {
+	return c.policy.peek(key)
+}
+
+func (c *valueCache) remove(key string) {
+	c.policy.remove(key)
+}
+
+func (c *valueCache) clear() {
+	c.policy.clear()
+}
+
+func (c *valueCache) len() int {
+	return c.policy.len()
+}
+
+// stats returns the statistics of the cache.
+func (c *valueCache) stats() CacheStats {
+	return CacheStats{
+		Policy:    c.policyName,
+		Capacity:  c.capacity,
+		Bytes:     c.policy.bytes(),
+		Entries:   c.policy.len(),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// newTestCache creates a cache of capacity bytes with the policy.
+func newTestCache(t *testing.T, capacity int64, policy string) *valueCache {
+	c, err := newValueCache(capacity, policy)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	return c
+}
+
+// value returns a value of size bytes.
+func value(size int) []byte {
+	return make([]byte, size)
+}
+
+func TestCacheBudget(t *testing.T) {
+	for _, policy := range []string{CacheLRU, CacheLFU, CacheARC, CacheTinyLFU} {
+		t.Run(policy, func(t *testing.T) {
+			c := newTestCache(t, 1000, policy)
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("key%d", i%50)
+				if _, found := c.get(key); !found {
+					c.add(key, value(10+i%90))
+				}
+				if stats := c.stats(); stats.Bytes > stats.Capacity {
+					t.Fatalf("Expected at most %d bytes, got %d", stats.Capacity, stats.Bytes)
+				}
+			}
+
+			stats := c.stats()
+			if stats.Hits+stats.Misses != 500 || stats.Evictions == 0 {
+				t.Fatalf("Unexpected stats: %+v", stats)
+			}
+
+			// a value larger than the budget is not cached
+			c.add("huge", value(2000))
+			if c.contains("huge") {
+				t.Fatal("Expected a value larger than the budget not to be cached")
+			}
+
+			c.clear()
+			if stats := c.stats(); stats.Bytes != 0 || stats.Entries != 0 {
+				t.Fatalf("Expected an empty cache, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestCacheLRU(t *testing.T) {
+	c := newTestCache(t, 30, CacheLRU)
+	c.add("a", value(9))
+	c.add("b", value(9))
+	c.add("c", value(9))
+	c.get("a")
+	c.add("d", value(9))
+
+	if c.contains("b") {
+		t.Fatal("Expected the least recently used value to be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if !c.contains(key) {
+			t.Fatalf("Expected %s to be cached", key)
+		}
+	}
+}
+
+func TestCacheLFU(t *testing.T) {
+	c := newTestCache(t, 30, CacheLFU)
+	c.add("a", value(9))
+	c.add("b", value(9))
+	c.add("c", value(9))
+	c.get("a")
+	c.get("a")
+	c.get("b")
+	c.add("d", value(9))
+
+	if c.contains("c") {
+		t.Fatal("Expected the least frequently used value to be evicted")
+	}
+
+	// an update doesn't evict the updated value
+	c.add("d", value(19))
+	if !c.contains("d") || c.stats().Bytes > 30 {
+		t.Fatalf("Expected d to be cached within the budget, got %+v", c.stats())
+	}
+}
+
+func TestCacheARC(t *testing.T) {
+	c := newTestCache(t, 100, CacheARC)
+
+	// the values used twice survive a scan of values used once
+	for _, key := range []string{"a", "b", "c"} {
+		c.add(key, value(9))
+		c.get(key)
+	}
+	for i := 0; i < 50; i++ {
+		c.add(fmt.Sprintf("scan%d", i), value(9))
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if !c.contains(key) {
+			t.Fatalf("Expected %s to survive the scan", key)
+		}
+	}
+
+	// a miss on a recently evicted value grows the recency side
+	arc := c.policy.(*arcCache)
+	ghost := arc.b1.order.Front().Value.(*cacheEntry).key
+	before := arc.p
+	c.add(ghost, value(9))
+	if arc.p <= before {
+		t.Fatalf("Expected the target size of t1 to grow, got %d from %d", arc.p, before)
+	}
+}
+
+func TestCacheTinyLFU(t *testing.T) {
+	c := newTestCache(t, 1000, CacheTinyLFU)
+
+	// the popular values fill the main cache
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 9; i++ {
+			key := fmt.Sprintf("hot%d", i)
+			if _, found := c.get(key); !found {
+				c.add(key, value(96))
+			}
+		}
+	}
+
+	// a burst of values used once is not admitted over them
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("cold%d", i)
+		if _, found := c.get(key); !found {
+			c.add(key, value(96))
+		}
+	}
+	for i := 0; i < 9; i++ {
+		if key := fmt.Sprintf("hot%d", i); !c.contains(key) {
+			t.Fatalf("Expected %s to stay cached", key)
+		}
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	os.RemoveAll("./test_storage")
+	ss, err := NewStorageWithCache("./test_storage", 1024, 1024, CacheLRU)
+	if err != nil {
+		t.Fatalf("Failed to create storage system: %v", err)
+	}
+	defer os.RemoveAll(ss.storagePath)
+
+	ss.Put("testfile", []byte("testdata"))
+	ss.Get("testfile")
+	ss.Get("testfile")
+	ss.removeFromCache("testfile")
+	ss.Get("testfile")
+
+	stats := ss.CacheStats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.HitRatio() < 0.66 || stats.HitRatio() > 0.67 {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+	if stats.Policy != CacheLRU || stats.Entries != 1 || stats.Bytes != int64(len("testfile")+len("testdata")) {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+
+	if _, err := NewStorageWithCache("./test_storage", 1024, 1024, "random"); err == nil {
+		t.Fatal("Expected an error for an unknown cache policy")
+	}
+}
+
+func TestNewStorageWithSetting(t *testing.T) {
+	ss := NewStorageWithSetting(t.TempDir(), 4, 16)
+
+	stats := ss.CacheStats()
+	if stats.Policy != CacheLRU || stats.Capacity != 4*16 {
+		t.Fatalf("Expected an LRU cache of 64 bytes, got %+v", stats)
+	}
+
+	if err := ss.Put("testfile", []byte("testdata")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if value, err := ss.Get("testfile"); err != nil || string(value) != "testdata" {
+		t.Fatalf("Expected testdata, got %q, %v", value, err)
+	}
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"os"
+	"testing"
+
+	"github.com/chord-dht/chord-core/storage"
+	"github.com/chord-dht/chord-core/storagetest"
+)
+
+// corrupt rewrites the file on disk and drops it from the cache, so the next read sees it.
+func corrupt(s storage.Storage, fileKey string) error {
+	ss := s.(*CacheStorageSystem)
+	ss.removeFromCache(fileKey)
+	return os.WriteFile(ss.filePath(fileKey), []byte("corrupted"), 0644)
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.RunWithOptions(t, CacheStorageFactory, storagetest.Options{Persistent: true, Corrupt: corrupt})
+}
+
+func TestConformanceCachePolicies(t *testing.T) {
+	for _, policy := range []string{CacheLRU, CacheLFU, CacheARC, CacheTinyLFU} {
+		t.Run(policy, func(t *testing.T) {
+			// a small budget, so the policies evict during the suite
+			storagetest.RunWithOptions(t, CacheStorageFactoryWithCache(256, 1024, policy), storagetest.Options{Persistent: true, Corrupt: corrupt})
+		})
+	}
+}
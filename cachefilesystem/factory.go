@@ -14,3 +14,15 @@ func CacheStorageFactory(path string) (storage.Storage, error) {
 	}
 	return storage, nil
 }
+
+// CacheStorageFactoryWithCache returns an implementation of StorageFactory using NewStorageWithCache,
+// every storage created by it gets its own cache of cacheBytes.
+func CacheStorageFactoryWithCache(cacheBytes int64, maxFileSize int64, policy string) func(string) (storage.Storage, error) {
+	return func(path string) (storage.Storage, error) {
+		storage, err := NewStorageWithCache(path, cacheBytes, maxFileSize, policy)
+		if err != nil {
+			return nil, fmt.Errorf("error creating storage at %s: %w", path, err)
+		}
+		return storage, nil
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// rebuildIndex scans the shard directories and tracks the files found on disk, so the files survive a restart.
+// The files of the flat layout are moved into the shards first (see migrateFlatLayout).
+// Only the metadata is read, so a restart doesn't cost the size of the files: the values are verified when they
+// are read, or by Scrub.
+//   - The key of a file is decoded from its name, or read from its metadata if the name is hashed.
+//   - A file not at the path of its key (stored before the key encoding) is moved there.
+//   - A file without metadata (stored before the metadata existed) is read once to get new metadata.
+//   - The metadata left without its file (a crash in the middle of a delete) is removed.
+//   - A file which can't be read is not tracked.
+func (s *CacheStorageSystem) rebuildIndex() error {
+	if err := s.migrateFlatLayout(); err != nil {
+		return err
+	}
+
+	shardNames, err := shards(s.storagePath)
+	if err != nil {
+		return err
+	}
+	for _, shard := range shardNames {
+		entries, err := os.ReadDir(filepath.Join(s.storagePath, shard))
+		if err != nil {
+			return fmt.Errorf("error reading shard directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				s.indexFile(shard, entry)
+			}
+		}
+	}
+
+	// the metadata left without its file
+	metaShards, err := shards(filepath.Join(s.storagePath, metaDirName))
+	if err != nil {
+		return err
+	}
+	metas := s.snapshot(func(string) bool { return true }, true)
+	tracked := make(map[string]struct{}, len(metas))
+	for fileKey := range metas {
+		tracked[s.metaPath(fileKey)] = struct{}{}
+	}
+	for _, shard := range metaShards {
+		shardPath := filepath.Join(s.storagePath, metaDirName, shard)
+		entries, err := os.ReadDir(shardPath)
+		if err != nil {
+			return fmt.Errorf("error reading metadata directory: %w", err)
+		}
+		for _, entry := range entries {
+			metaPath := filepath.Join(shardPath, entry.Name())
+			if _, found := tracked[metaPath]; !found {
+				os.Remove(metaPath)
+			}
+		}
+	}
+	return nil
+}
+
+// indexFile tracks the file found in the shard directory, see rebuildIndex.
+func (s *CacheStorageSystem) indexFile(shard string, entry os.DirEntry) {
+	name := entry.Name()
+	filePath := filepath.Join(s.storagePath, shard, name)
+	metaPath := filepath.Join(s.storagePath, metaDirName, shard, name)
+
+	meta, err := readMeta(metaPath)
+	if err != nil {
+		return
+	}
+	fileKey := keyOf(name, meta)
+	if s.filePath(fileKey) != filePath {
+		if err := s.moveFile(filePath, metaPath, fileKey); err != nil {
+			return
+		}
+	}
+
+	if meta.Checksum == "" {
+		value, err := os.ReadFile(s.filePath(fileKey))
+		if err != nil {
+			return
+		}
+		meta = s.newMeta(&storage.File{Key: fileKey, Value: value, Version: meta.Version, ExpireAt: meta.ExpireAt})
+		if info, err := entry.Info(); err == nil {
+			meta.CreatedAt, meta.ModifiedAt = info.ModTime(), info.ModTime()
+		}
+		if err := s.persistMeta(fileKey, meta); err != nil {
+			return
+		}
+	}
+	meta.Key = fileKey
+	s.track(meta)
+}
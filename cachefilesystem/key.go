@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+/*
+ * Key encoding.
+ * A key is never used as a path directly: "../x" would escape the storage directory, "a/b" would need a directory,
+ * and "A" and "a" would collide on a case-insensitive file system. Every byte out of [a-z0-9._-] is escaped as %xx
+ * (lowercase hex), and so is a leading dot, so the name is safe on any file system and never hides among the
+ * storage's own directories (.meta, .quarantine, .tmp). A name too long for the file system is replaced by the
+ * SHA-256 of the key, and the original key is kept in the metadata.
+ */
+
+const (
+	maxKeyLength     = 4096 // the longest key accepted
+	maxEscapedLength = 200  // the longest escaped name, a longer one is hashed
+	hashedPrefix     = "~"  // the prefix of a hashed name, "~" is always escaped so it can't start an escaped name
+)
+
+// validateKey checks if the key can be stored.
+func validateKey(fileKey string) error {
+	if fileKey == "" {
+		return fmt.Errorf("%w: empty key", storage.ErrInvalidKey)
+	}
+	if len(fileKey) > maxKeyLength {
+		return fmt.Errorf("%w: key longer than %d bytes", storage.ErrInvalidKey, maxKeyLength)
+	}
+	return nil
+}
+
+// isSafe checks if the byte can be kept as it is in a name.
+func isSafe(c byte) bool {
+	return 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.'
+}
+
+// encodeKey returns the name of the file of the key on disk.
+func encodeKey(fileKey string) string {
+	var builder strings.Builder
+	for i := 0; i < len(fileKey); i++ {
+		c := fileKey[i]
+		if isSafe(c) && !(i == 0 && c == '.') {
+			builder.WriteByte(c)
+		} else {
+			fmt.Fprintf(&builder, "%%%02x", c)
+		}
+	}
+	if builder.Len() > maxEscapedLength {
+		sum := sha256.Sum256([]byte(fileKey))
+		return hashedPrefix + hex.EncodeToString(sum[:])
+	}
+	return builder.String()
+}
+
+// decodeKey recovers the key from an escaped name, it fails for a hashed name or a name not made by encodeKey.
+func decodeKey(name string) (string, bool) {
+	if strings.HasPrefix(name, hashedPrefix) {
+		return "", false
+	}
+	var builder strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '%' {
+			builder.WriteByte(name[i])
+			continue
+		}
+		if i+2 >= len(name) {
+			return "", false
+		}
+		decoded, err := hex.DecodeString(name[i+1 : i+3])
+		if err != nil {
+			return "", false
+		}
+		builder.WriteByte(decoded[0])
+		i += 2
+	}
+	fileKey := builder.String()
+	if fileKey == "" || encodeKey(fileKey) != name {
+		return "", false
+	}
+	return fileKey, true
+}
+
+// filePath returns the path of the file of the key on disk, in its shard directory.
+func (s *CacheStorageSystem) filePath(fileKey string) string {
+	return filepath.Join(s.storagePath, shardOf(fileKey), encodeKey(fileKey))
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+/*
+ * On-disk layout.
+ * The files are spread over 256 shard directories, named after the first byte (2 hex digits) of the SHA-1 of the key,
+ * the hash the identifier of the key is derived from: storagePath/<shard>/<name>, and their metadata in
+ * storagePath/.meta/<shard>/<name>, so no directory grows beyond a few thousand entries with millions of keys.
+ * The storages written before the sharding keep their files directly in storagePath (and .meta),
+ * they are moved into the shards by migrateFlatLayout at startup.
+ */
+
+// shardOf returns the shard directory of the key.
+func shardOf(fileKey string) string {
+	sum := sha1.Sum([]byte(fileKey))
+	return hex.EncodeToString(sum[:1])
+}
+
+// isShard checks if the directory name is a shard directory, 2 lowercase hex digits.
+func isShard(name string) bool {
+	if len(name) != 2 {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !('0' <= name[i] && name[i] <= '9' || 'a' <= name[i] && name[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// shards lists the shard directories under the directory, a missing directory has none.
+func shards(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && isShard(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// keyOf recovers the key of the file stored under the name, from the name itself or from its metadata (hashed names).
+// A name which is neither an encoded key nor described by its metadata was stored before the key encoding,
+// it is the key itself.
+func keyOf(name string, meta *fileMeta) string {
+	if fileKey, ok := decodeKey(name); ok {
+		return fileKey
+	}
+	if meta.Key != "" {
+		return meta.Key
+	}
+	return name
+}
+
+// moveFile moves the file and its metadata (if any) to the paths of the key.
+func (s *CacheStorageSystem) moveFile(filePath string, metaPath string, fileKey string) error {
+	if err := os.MkdirAll(filepath.Dir(s.filePath(fileKey)), os.ModePerm); err != nil {
+		return fmt.Errorf("error creating shard directory: %w", err)
+	}
+	if err := os.Rename(filePath, s.filePath(fileKey)); err != nil {
+		return fmt.Errorf("error moving file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.metaPath(fileKey)), os.ModePerm); err != nil {
+		return fmt.Errorf("error creating shard directory: %w", err)
+	}
+	if err := os.Rename(metaPath, s.metaPath(fileKey)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error moving metadata: %w", err)
+	}
+	return nil
+}
+
+// migrateFlatLayout moves the files kept directly in storagePath (and their metadata) into the shard directories.
+// A file which can't be moved is left where it is, and tried again at the next startup.
+func (s *CacheStorageSystem) migrateFlatLayout() error {
+	entries, err := os.ReadDir(s.storagePath)
+	if err != nil {
+		return fmt.Errorf("error reading storage directory: %w", err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := entry.Name()
+		filePath := filepath.Join(s.storagePath, name)
+		metaPath := filepath.Join(s.storagePath, metaDirName, name)
+
+		meta, err := readMeta(metaPath)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := s.moveFile(filePath, metaPath, keyOf(name, meta)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// the metadata left without its file
+	metaEntries, _ := os.ReadDir(filepath.Join(s.storagePath, metaDirName))
+	for _, entry := range metaEntries {
+		if entry.Type().IsRegular() {
+			os.Remove(filepath.Join(s.storagePath, metaDirName, entry.Name()))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("encountered errors: %v", len(errs))
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package storage
+
+import "container/list"
+
+// lfuCache evicts the least frequently used values, the least recently used one among ties.
+// The values are grouped in buckets by frequency, and the buckets are kept in increasing frequency,
+// so every operation is O(1).
+type lfuCache struct {
+	capacity int64
+	size     int64
+	items    map[string]*lfuItem
+	buckets  *list.List // of *lfuBucket, the front has the lowest frequency
+	onEvict  func(string)
+}
+
+// lfuBucket is the values used freq times, the front is the most recently used.
+type lfuBucket struct {
+	freq  int
+	items *list.List // of *lfuItem
+}
+
+type lfuItem struct {
+	entry   cacheEntry
+	bucket  *list.Element // in lfuCache.buckets
+	element *list.Element // in the items of the bucket
+}
+
+func newLFUCache(capacity int64, onEvict func(string)) *lfuCache {
+	return &lfuCache{capacity: capacity, items: make(map[string]*lfuItem), buckets: list.New(), onEvict: onEvict}
+}
+
+// use moves the item to the bucket of the next frequency.
+func (c *lfuCache) use(item *lfuItem) {
+	current := item.bucket
+	freq := current.Value.(*lfuBucket).freq + 1
+	next := current.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != freq {
+		next = c.buckets.InsertAfter(&lfuBucket{freq: freq, items: list.New()}, current)
+	}
+	c.unlink(item)
+	item.bucket = next
+	item.element = next.Value.(*lfuBucket).items.PushFront(item)
+}
+
+// unlink removes the item from its bucket, the bucket is dropped once empty.
+func (c *lfuCache) unlink(item *lfuItem) {
+	bucket := item.bucket.Value.(*lfuBucket)
+	bucket.items.Remove(item.element)
+	if bucket.items.Len() == 0 {
+		c.buckets.Remove(item.bucket)
+	}
+}
+
+func (c *lfuCache) get(key string) ([]byte, bool) {
+	item, found := c.items[key]
+	if !found {
+		return nil, false
+	}
+	c.use(item)
+	return item.entry.value, true
+}
+
+func (c *lfuCache) peek(key string) ([]byte, bool) {
+	item, found := c.items[key]
+	if !found {
+		return nil, false
+	}
+	return item.entry.value, true
+}
+
+func (c *lfuCache) add(key string, value []byte) {
+	size := entrySize(key, value)
+	if item, found := c.items[key]; found {
+		c.size += size - item.entry.size
+		item.entry.value, item.entry.size = value, size
+		c.use(item)
+	} else {
+		front := c.buckets.Front()
+		if front == nil || front.Value.(*lfuBucket).freq != 1 {
+			front = c.buckets.PushFront(&lfuBucket{freq: 1, items: list.New()})
+		}
+		item := &lfuItem{entry: cacheEntry{key: key, value: value, size: size}, bucket: front}
+		item.element = front.Value.(*lfuBucket).items.PushFront(item)
+		c.items[key] = item
+		c.size += size
+	}
+	// the added value is never evicted, it fits in the budget alone
+	for c.size > c.capacity {
+		c.evict(key)
+	}
+}
+
+// evict removes the least recently used value of the lowest frequency, except the value of keep.
+func (c *lfuCache) evict(keep string) {
+	for bucket := c.buckets.Front(); bucket != nil; bucket = bucket.Next() {
+		for element := bucket.Value.(*lfuBucket).items.Back(); element != nil; element = element.Prev() {
+			if key := element.Value.(*lfuItem).entry.key; key != keep {
+				c.remove(key)
+				c.onEvict(key)
+				return
+			}
+		}
+	}
+}
+
+func (c *lfuCache) remove(key string) {
+	item, found := c.items[key]
+	if !found {
+		return
+	}
+	c.unlink(item)
+	delete(c.items, key)
+	c.size -= item.entry.size
+}
+
+func (c *lfuCache) clear() {
+	c.items = make(map[string]*lfuItem)
+	c.buckets.Init()
+	c.size = 0
+}
+
+func (c *lfuCache) bytes() int64 {
+	return c.size
+}
+
+func (c *lfuCache) len() int {
+	return len(c.items)
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// lockStripes is the number of key locks, the keys of a stripe share its lock.
+const lockStripes = 256
+
+// keyLocks guards the files on disk, one read-write lock per stripe of keys.
+// The lock of a key is held in read mode to read the file and its metadata, and in write mode to write or remove
+// them, so a reader never sees the value of one write with the metadata of another, and the reads of different
+// keys (or of the same key) run in parallel.
+//
+// The locks of the storage are taken in this order: the key locks, then mu (the index), then cacheMu (the cache).
+// mu and cacheMu are only held to access the memory, never during disk I/O.
+type keyLocks struct {
+	stripes [lockStripes]sync.RWMutex
+}
+
+// stripeOf returns the stripe of the key.
+func stripeOf(fileKey string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(fileKey))
+	return int(hash.Sum32() % lockStripes)
+}
+
+// rlock locks the key in read mode, and returns the unlock function.
+func (locks *keyLocks) rlock(fileKey string) func() {
+	stripe := &locks.stripes[stripeOf(fileKey)]
+	stripe.RLock()
+	return stripe.RUnlock
+}
+
+// lock locks the key in write mode, and returns the unlock function.
+func (locks *keyLocks) lock(fileKey string) func() {
+	stripe := &locks.stripes[stripeOf(fileKey)]
+	stripe.Lock()
+	return stripe.Unlock
+}
+
+// lockKeys locks the keys in write mode, and returns the unlock function.
+// The stripes are locked in increasing order, so two callers locking several keys can't deadlock.
+func (locks *keyLocks) lockKeys(fileKeys []string) func() {
+	seen := make(map[int]struct{}, len(fileKeys))
+	stripes := make([]int, 0, len(fileKeys))
+	for _, fileKey := range fileKeys {
+		stripe := stripeOf(fileKey)
+		if _, found := seen[stripe]; !found {
+			seen[stripe] = struct{}{}
+			stripes = append(stripes, stripe)
+		}
+	}
+	sort.Ints(stripes)
+	return locks.lockStripes(stripes)
+}
+
+// lockAll locks every key in write mode, and returns the unlock function.
+func (locks *keyLocks) lockAll() func() {
+	stripes := make([]int, lockStripes)
+	for i := range stripes {
+		stripes[i] = i
+	}
+	return locks.lockStripes(stripes)
+}
+
+// lockStripes locks the sorted stripes in write mode, and returns the unlock function.
+func (locks *keyLocks) lockStripes(stripes []int) func() {
+	for _, stripe := range stripes {
+		locks.stripes[stripe].Lock()
+	}
+	return func() {
+		for i := len(stripes) - 1; i >= 0; i-- {
+			locks.stripes[stripes[i]].Unlock()
+		}
+	}
+}
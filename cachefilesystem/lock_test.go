@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// keysOnDifferentStripes returns two keys guarded by different locks.
+func keysOnDifferentStripes() (string, string) {
+	first := "testfile0"
+	for i := 1; ; i++ {
+		if other := fmt.Sprintf("testfile%d", i); stripeOf(other) != stripeOf(first) {
+			return first, other
+		}
+	}
+}
+
+// finishesIn checks if fn returns within the timeout.
+func finishesIn(timeout time.Duration, fn func()) bool {
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestKeyLocksIndependent(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	busy, other := keysOnDifferentStripes()
+	ss.Put(busy, []byte("busy"))
+	ss.Put(other, []byte("other"))
+
+	// a write in progress on one key doesn't block the other keys
+	unlock := ss.locks.lock(busy)
+	if !finishesIn(time.Second, func() {
+		ss.Get(other)
+		ss.Put(other, []byte("updated"))
+		ss.Stat(busy)
+		ss.GetFilesName()
+	}) {
+		t.Fatal("Expected the other keys to be available during a write")
+	}
+	if finishesIn(50*time.Millisecond, func() { ss.Get(busy) }) {
+		t.Fatal("Expected a read of the key to wait for the write")
+	}
+	unlock()
+
+	// the readers of a key don't block each other
+	runlock := ss.locks.rlock(busy)
+	if !finishesIn(time.Second, func() { ss.Get(busy) }) {
+		t.Fatal("Expected the readers of a key to share its lock")
+	}
+	runlock()
+}
+
+func TestLockKeysOrder(t *testing.T) {
+	var locks keyLocks
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	reversed := []string{"h", "g", "f", "e", "d", "c", "b", "a", "a"}
+
+	// two callers locking the same keys in opposite orders don't deadlock
+	if !finishesIn(5*time.Second, func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				locks.lockKeys(keys)()
+			}()
+			go func() {
+				defer wg.Done()
+				locks.lockKeys(reversed)()
+			}()
+		}
+		wg.Wait()
+	}) {
+		t.Fatal("Expected lockKeys not to deadlock")
+	}
+}
+
+func TestConcurrentReadWrite(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	const workers, rounds = 8, 50
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				// the workers share the keys, so the value read is always one of the written ones
+				key := fmt.Sprintf("testfile%d", j%5)
+				ss.Put(key, bytes.Repeat([]byte{byte('a' + i)}, 100))
+				if value, err := ss.Get(key); err == nil && len(value) != 100 {
+					t.Errorf("Expected a whole value, got %d bytes", len(value))
+				}
+				if j%10 == 0 {
+					ss.GetAllFiles()
+					ss.ExtractFilesByFilter(func(fileKey string) bool { return fileKey == key })
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if corrupted, err := ss.Scrub(); err != nil || len(corrupted) != 0 {
+		t.Fatalf("Expected no corrupted file, got %v, %v", corrupted, err)
+	}
+	if quarantined := ss.Quarantined(); len(quarantined) != 0 {
+		t.Fatalf("Expected empty quarantine, got %v", quarantined)
+	}
+}
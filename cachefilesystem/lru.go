@@ -0,0 +1,148 @@
+package storage
+
+import "container/list"
+
+// cacheEntry is a value in a cacheList, a ghost entry (see arcCache) keeps the size without the value.
+type cacheEntry struct {
+	key   string
+	value []byte
+	size  int64
+}
+
+// cacheList is a list of entries in recency order with its total size, the front is the most recently used.
+// It is the building block of the cache policies.
+type cacheList struct {
+	items map[string]*list.Element
+	order *list.List
+	size  int64
+}
+
+func newCacheList() *cacheList {
+	return &cacheList{items: make(map[string]*list.Element), order: list.New()}
+}
+
+// find gets the entry of the key, without changing the order.
+func (l *cacheList) find(key string) (*cacheEntry, bool) {
+	element, found := l.items[key]
+	if !found {
+		return nil, false
+	}
+	return element.Value.(*cacheEntry), true
+}
+
+// touch moves the entry of the key to the front.
+func (l *cacheList) touch(key string) {
+	if element, found := l.items[key]; found {
+		l.order.MoveToFront(element)
+	}
+}
+
+// pushFront adds the entry at the front, the key should not be in the list.
+func (l *cacheList) pushFront(entry *cacheEntry) {
+	l.items[entry.key] = l.order.PushFront(entry)
+	l.size += entry.size
+}
+
+// set replaces the value of an entry in the list, and moves it to the front.
+func (l *cacheList) set(entry *cacheEntry, value []byte) {
+	size := entrySize(entry.key, value)
+	l.size += size - entry.size
+	entry.value, entry.size = value, size
+	l.touch(entry.key)
+}
+
+// back gets the least recently used entry, nil if the list is empty.
+func (l *cacheList) back() *cacheEntry {
+	element := l.order.Back()
+	if element == nil {
+		return nil
+	}
+	return element.Value.(*cacheEntry)
+}
+
+// remove removes the entry of the key, and returns it.
+func (l *cacheList) remove(key string) (*cacheEntry, bool) {
+	element, found := l.items[key]
+	if !found {
+		return nil, false
+	}
+	l.order.Remove(element)
+	delete(l.items, key)
+	entry := element.Value.(*cacheEntry)
+	l.size -= entry.size
+	return entry, true
+}
+
+// removeBack removes the least recently used entry, and returns it (nil if the list is empty).
+func (l *cacheList) removeBack() *cacheEntry {
+	entry := l.back()
+	if entry != nil {
+		l.remove(entry.key)
+	}
+	return entry
+}
+
+func (l *cacheList) len() int {
+	return len(l.items)
+}
+
+func (l *cacheList) clear() {
+	l.items = make(map[string]*list.Element)
+	l.order.Init()
+	l.size = 0
+}
+
+// lruCache evicts the least recently used values.
+type lruCache struct {
+	capacity int64
+	entries  *cacheList
+	onEvict  func(string)
+}
+
+func newLRUCache(capacity int64, onEvict func(string)) *lruCache {
+	return &lruCache{capacity: capacity, entries: newCacheList(), onEvict: onEvict}
+}
+
+func (c *lruCache) get(key string) ([]byte, bool) {
+	entry, found := c.entries.find(key)
+	if !found {
+		return nil, false
+	}
+	c.entries.touch(key)
+	return entry.value, true
+}
+
+func (c *lruCache) peek(key string) ([]byte, bool) {
+	entry, found := c.entries.find(key)
+	if !found {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *lruCache) add(key string, value []byte) {
+	if entry, found := c.entries.find(key); found {
+		c.entries.set(entry, value)
+	} else {
+		c.entries.pushFront(&cacheEntry{key: key, value: value, size: entrySize(key, value)})
+	}
+	for c.entries.size > c.capacity {
+		c.onEvict(c.entries.removeBack().key)
+	}
+}
+
+func (c *lruCache) remove(key string) {
+	c.entries.remove(key)
+}
+
+func (c *lruCache) clear() {
+	c.entries.clear()
+}
+
+func (c *lruCache) bytes() int64 {
+	return c.entries.size
+}
+
+func (c *lruCache) len() int {
+	return c.entries.len()
+}
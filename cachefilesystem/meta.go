@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// metaDirName is the directory (under storagePath) keeping the metadata of the files, one file per key.
+const metaDirName = ".meta"
+
+// fileMeta is the metadata of a file, kept in memory (filesname) and on disk next to the file.
+type fileMeta struct {
+	Key         string          `json:"key"` // the original key, the name on disk may be hashed
+	Version     storage.Version `json:"version"`
+	ExpireAt    time.Time       `json:"expireAt"`
+	Size        int64           `json:"size"`
+	Checksum    string          `json:"checksum"`
+	ContentType string          `json:"contentType"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	ModifiedAt  time.Time       `json:"modifiedAt"`
+	Owner       string          `json:"owner"`
+}
+
+// expired checks if the file has expired at the given time.
+func (meta *fileMeta) expired(now time.Time) bool {
+	return !meta.ExpireAt.IsZero() && !now.Before(meta.ExpireAt)
+}
+
+// file builds the File from the metadata and the value.
+func (meta *fileMeta) file(fileKey string, value []byte) *storage.File {
+	return &storage.File{
+		Key:      fileKey,
+		Value:    value,
+		Version:  meta.Version,
+		ExpireAt: meta.ExpireAt,
+		Owner:    meta.Owner,
+		Checksum: meta.Checksum,
+	}
+}
+
+// info builds the FileInfo from the metadata.
+func (meta *fileMeta) info(fileKey string) *storage.FileInfo {
+	return &storage.FileInfo{
+		Key:         fileKey,
+		Size:        meta.Size,
+		Checksum:    meta.Checksum,
+		ContentType: meta.ContentType,
+		CreatedAt:   meta.CreatedAt,
+		ModifiedAt:  meta.ModifiedAt,
+		Owner:       meta.Owner,
+		Version:     meta.Version,
+		ExpireAt:    meta.ExpireAt,
+	}
+}
+
+// newMeta builds the metadata of the file, the creation time is kept if the fileKey is already tracked.
+func (s *CacheStorageSystem) newMeta(file *storage.File) *fileMeta {
+	return s.newMetaOf(file, int64(len(file.Value)), storage.Checksum(file.Value), storage.ContentType(file.Key, file.Value))
+}
+
+// newMetaOf is newMeta for a value which is not in memory, with its size, checksum and content type.
+func (s *CacheStorageSystem) newMetaOf(file *storage.File, size int64, checksum string, contentType string) *fileMeta {
+	now := time.Now()
+	meta := &fileMeta{
+		Key:         file.Key,
+		Version:     file.Version,
+		ExpireAt:    file.ExpireAt,
+		Size:        size,
+		Checksum:    checksum,
+		ContentType: contentType,
+		CreatedAt:   now,
+		ModifiedAt:  now,
+		Owner:       file.Owner,
+	}
+	if old, found := s.lookup(file.Key); found && !old.CreatedAt.IsZero() {
+		meta.CreatedAt = old.CreatedAt
+	}
+	return meta
+}
+
+// lookup finds the metadata of a file which is tracked and not expired.
+func (s *CacheStorageSystem) lookup(fileKey string) (*fileMeta, bool) {
+	meta, found := s.tracked(fileKey)
+	if !found || meta.expired(time.Now()) {
+		return nil, false
+	}
+	return meta, true
+}
+
+// tracked finds the metadata of a file which is tracked, even if it has expired.
+func (s *CacheStorageSystem) tracked(fileKey string) (*fileMeta, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meta, found := s.filesname[fileKey]
+	return meta, found
+}
+
+// metaPath returns the path of the metadata of the file.
+func (s *CacheStorageSystem) metaPath(fileKey string) string {
+	return filepath.Join(s.storagePath, metaDirName, shardOf(fileKey), encodeKey(fileKey))
+}
+
+// persistMeta saves the metadata of the file on disk, atomically (see writeFileAtomic).
+func (s *CacheStorageSystem) persistMeta(fileKey string, meta *fileMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("error encoding metadata: %w", err)
+	}
+
+	return s.writeFileAtomic(s.metaPath(fileKey), data)
+}
+
+// loadMeta loads the metadata of the file from disk, a file without metadata gets an empty one.
+func (s *CacheStorageSystem) loadMeta(fileKey string) (*fileMeta, error) {
+	return readMeta(s.metaPath(fileKey))
+}
+
+// readMeta reads the metadata at the path, a missing one is empty.
+func readMeta(metaPath string) (*fileMeta, error) {
+	meta := &fileMeta{}
+	data, err := os.ReadFile(metaPath)
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading metadata: %w", err)
+	}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("error decoding metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// removeMeta removes the metadata of the file from disk, it is fine if there is none.
+func (s *CacheStorageSystem) removeMeta(fileKey string) error {
+	if err := os.Remove(s.metaPath(fileKey)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing metadata: %w", err)
+	}
+	return nil
+}
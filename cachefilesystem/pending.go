@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// pendingDirName is the directory (under storagePath) keeping the metadata of the writes in progress.
+// The new metadata is written there before the value is renamed into place, so a crash between the rename of the
+// value and the one of its metadata is finished at startup (see recoverPending), instead of leaving the new value
+// with the old checksum.
+const pendingDirName = ".pending"
+
+// pendingPath returns the path of the pending metadata of the file.
+func (s *CacheStorageSystem) pendingPath(fileKey string) string {
+	return filepath.Join(s.storagePath, pendingDirName, encodeKey(fileKey))
+}
+
+// persistPending saves the metadata of the value about to be renamed into place, atomically.
+func (s *CacheStorageSystem) persistPending(meta *fileMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("error encoding metadata: %w", err)
+	}
+	return s.writeFileAtomic(s.pendingPath(meta.Key), data)
+}
+
+// clearPending removes the pending metadata of the file once the write is done, or failed before the rename.
+func (s *CacheStorageSystem) clearPending(fileKey string) {
+	os.Remove(s.pendingPath(fileKey))
+}
+
+// recoverPending finishes the writes interrupted by a crash: if the value on disk matches the checksum of the
+// pending metadata, the value was renamed into place, and the pending metadata replaces the old one.
+// Otherwise the old value is still there with its metadata. Only the files of these writes are read.
+func (s *CacheStorageSystem) recoverPending() error {
+	pendingDir := filepath.Join(s.storagePath, pendingDirName)
+	entries, err := os.ReadDir(pendingDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading pending directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		pendingPath := filepath.Join(pendingDir, entry.Name())
+		meta, err := readMeta(pendingPath)
+		if err == nil && meta.Key != "" {
+			value, err := os.ReadFile(s.filePath(meta.Key))
+			if err == nil && storage.Checksum(value) == meta.Checksum {
+				if err := s.persistMeta(meta.Key, meta); err != nil {
+					return err
+				}
+			}
+		}
+		os.Remove(pendingPath)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// quarantineDirName is the directory (under storagePath) keeping the corrupted files, until they are stored again.
+const quarantineDirName = ".quarantine"
+
+// quarantinePath returns the path of the file in the quarantine.
+func (s *CacheStorageSystem) quarantinePath(fileKey string) string {
+	return filepath.Join(s.storagePath, quarantineDirName, encodeKey(fileKey))
+}
+
+// quarantineMetaPath returns the path of the metadata of the file in the quarantine,
+// it keeps the original key of a hashed name.
+func (s *CacheStorageSystem) quarantineMetaPath(fileKey string) string {
+	return filepath.Join(s.storagePath, quarantineDirName, metaDirName, encodeKey(fileKey))
+}
+
+// verify checks the value loaded from disk against the checksum in the metadata, ErrCorrupted is returned
+// if it doesn't match. A file without checksum (stored by an older version) is not checked.
+func (s *CacheStorageSystem) verify(fileKey string, value []byte) error {
+	meta, found := s.tracked(fileKey)
+	if !found || meta.Checksum == "" || meta.Checksum == storage.Checksum(value) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", storage.ErrCorrupted, fileKey)
+}
+
+// quarantineCorrupted moves the file found corrupted with the metadata meta to the quarantine, under the write lock
+// of the key, and returns ErrCorrupted. The file is kept if it was written or removed since it was read.
+func (s *CacheStorageSystem) quarantineCorrupted(fileKey string, meta *fileMeta) error {
+	defer s.locks.lock(fileKey)()
+
+	if current, found := s.tracked(fileKey); !found || current != meta {
+		return fmt.Errorf("%w: %s", storage.ErrCorrupted, fileKey)
+	}
+	if err := s.quarantine(fileKey); err != nil {
+		return fmt.Errorf("%w: %s: %v", storage.ErrCorrupted, fileKey, err)
+	}
+	return fmt.Errorf("%w: %s", storage.ErrCorrupted, fileKey)
+}
+
+// quarantine moves the file and its metadata to the quarantine, and stops tracking it.
+// The caller holds the write lock of the key.
+func (s *CacheStorageSystem) quarantine(fileKey string) error {
+	s.removeFromCache(fileKey)
+	s.untrack(fileKey)
+
+	if err := os.MkdirAll(filepath.Join(s.storagePath, quarantineDirName, metaDirName), os.ModePerm); err != nil {
+		return fmt.Errorf("error creating quarantine directory: %w", err)
+	}
+	if err := os.Rename(s.metaPath(fileKey), s.quarantineMetaPath(fileKey)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error moving metadata to quarantine: %w", err)
+	}
+	if err := os.Rename(s.filePath(fileKey), s.quarantinePath(fileKey)); err != nil {
+		return fmt.Errorf("error moving file to quarantine: %w", err)
+	}
+	return nil
+}
+
+// release removes the quarantined copy of the file, it is fine if there is none.
+func (s *CacheStorageSystem) release(fileKey string) error {
+	if err := os.Remove(s.quarantinePath(fileKey)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing quarantined file: %w", err)
+	}
+	if err := os.Remove(s.quarantineMetaPath(fileKey)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing quarantined metadata: %w", err)
+	}
+	return nil
+}
+
+// Scrub reads every file from disk and verifies its checksum, one by one under their locks,
+// the corrupted files are moved to the quarantine and their keys are returned.
+func (s *CacheStorageSystem) Scrub() ([]string, error) {
+	var corrupted []string
+	var errs []error
+
+	for fileKey := range s.snapshot(func(string) bool { return true }, false) {
+		if _, err := s.readFile(fileKey, true); err != nil {
+			if storage.IsCorrupted(err) {
+				corrupted = append(corrupted, fileKey)
+			} else if !errors.Is(err, storage.ErrNotFound) {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return corrupted, fmt.Errorf("encountered errors: %v", len(errs))
+	}
+	return corrupted, nil
+}
+
+// Quarantined lists the keys of the files in the quarantine.
+func (s *CacheStorageSystem) Quarantined() []string {
+	entries, err := os.ReadDir(filepath.Join(s.storagePath, quarantineDirName))
+	if err != nil {
+		return nil
+	}
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if fileKey, ok := decodeKey(entry.Name()); ok {
+			keys = append(keys, fileKey)
+			continue
+		}
+		metaPath := filepath.Join(s.storagePath, quarantineDirName, metaDirName, entry.Name())
+		if meta, err := readMeta(metaPath); err == nil && meta.Key != "" {
+			keys = append(keys, meta.Key)
+		}
+	}
+	return keys
+}
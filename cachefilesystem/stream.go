@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// sniffLength is the number of bytes used to detect the content type of a streamed value.
+const sniffLength = 512
+
+// openFile opens a tracked file under the read lock of its key, and returns it with its metadata.
+// The lock is released once it returns: a write replaces the file by a rename, so the opened file keeps the
+// value matching the metadata, and the caller can read it without blocking the writers.
+func (s *CacheStorageSystem) openFile(fileKey string) (*os.File, *fileMeta, error) {
+	defer s.locks.rlock(fileKey)()
+
+	meta, found := s.lookup(fileKey)
+	if !found {
+		return nil, nil, fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	file, err := os.Open(s.filePath(fileKey))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening file: %w", err)
+	}
+	return file, meta, nil
+}
+
+// ForEachKey calls fn with the key of every file that satisfies the filter, the files are not read.
+func (s *CacheStorageSystem) ForEachKey(filter func(string) bool, fn func(fileKey string) error) error {
+	for fileKey := range s.snapshot(filter, false) {
+		if err := fn(fileKey); err != nil {
+			if errors.Is(err, storage.ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachFile calls fn with the metadata and a reader of the value of every file that satisfies the filter,
+// the values are read from disk while fn consumes them.
+func (s *CacheStorageSystem) ForEachFile(filter func(string) bool, fn func(info *storage.FileInfo, value io.Reader) error) error {
+	for fileKey := range s.snapshot(filter, false) {
+		err := s.streamFile(fileKey, func(meta *fileMeta, value *storage.VerifyingReader) error {
+			return fn(meta.info(fileKey), value)
+		})
+		if errors.Is(err, storage.ErrNotFound) || storage.IsCorrupted(err) {
+			continue
+		}
+		if errors.Is(err, storage.ErrStop) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamFile opens the file and calls fn with a verifying reader of its value,
+// a value found corrupted is moved to the quarantine once fn returns.
+func (s *CacheStorageSystem) streamFile(fileKey string, fn func(meta *fileMeta, value *storage.VerifyingReader) error) error {
+	file, meta, err := s.openFile(fileKey)
+	if err != nil {
+		return err
+	}
+	value := storage.NewVerifyingReader(file, meta.Checksum)
+	err = fn(meta, value)
+	file.Close()
+
+	if value.Corrupted() {
+		s.quarantineCorrupted(fileKey, meta)
+	}
+	return err
+}
+
+// GetStream writes the value of the file to the writer, from the cache or from disk, and returns its metadata.
+func (s *CacheStorageSystem) GetStream(fileKey string, w io.Writer) (*storage.FileInfo, error) {
+	unlock := s.locks.rlock(fileKey)
+	meta, found := s.lookup(fileKey)
+	s.cacheMu.Lock()
+	value, cached := s.cache.get(fileKey)
+	s.cacheMu.Unlock()
+	unlock()
+	if found && cached {
+		if _, err := w.Write(value); err != nil {
+			return nil, fmt.Errorf("error writing value of %s: %w", fileKey, err)
+		}
+		return meta.info(fileKey), nil
+	}
+
+	var info *storage.FileInfo
+	err := s.streamFile(fileKey, func(meta *fileMeta, value *storage.VerifyingReader) error {
+		info = meta.info(fileKey)
+		if _, err := io.Copy(w, value); err != nil {
+			if storage.IsCorrupted(err) {
+				return fmt.Errorf("%w: %s", storage.ErrCorrupted, fileKey)
+			}
+			return fmt.Errorf("error writing value of %s: %w", fileKey, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// PutStream stores the file with the value read from the reader, the value is streamed to disk
+// and never fully in memory, so it is not cached.
+func (s *CacheStorageSystem) PutStream(file *storage.File, value io.Reader) error {
+	if err := validateKey(file.Key); err != nil {
+		return err
+	}
+
+	defer s.locks.lock(file.Key)()
+
+	// the first bytes are kept to detect the content type
+	buffered := bufio.NewReaderSize(value, sniffLength)
+	head, _ := buffered.Peek(sniffLength)
+	head = bytes.Clone(head)
+
+	reader := storage.NewVerifyingReader(buffered, "")
+	var meta *fileMeta
+	defer s.clearPending(file.Key)
+	err := s.writeStreamAtomic(s.filePath(file.Key), reader, func() error {
+		if file.Checksum != "" && file.Checksum != reader.Checksum() {
+			return fmt.Errorf("%w: %s", storage.ErrCorrupted, file.Key)
+		}
+		// the metadata is pending before the value is renamed, see persistFile
+		meta = s.newMetaOf(file, reader.Size(), reader.Checksum(), storage.ContentType(file.Key, head))
+		return s.persistPending(meta)
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.release(file.Key); err != nil {
+		return err
+	}
+	if err := s.persistMeta(file.Key, meta); err != nil {
+		return err
+	}
+	s.track(meta)
+	s.removeFromCache(file.Key)
+	return nil
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+func TestStreamCorruptionQuarantine(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	ss.Put("testfile1", []byte("testdata"))
+	ss.Put("testfile2", []byte("testdata"))
+	for _, key := range []string{"testfile1", "testfile2"} {
+		ss.removeFromCache(key)
+		if err := os.WriteFile(ss.filePath(key), []byte("testdatb"), 0644); err != nil {
+			t.Fatalf("Failed to corrupt file: %v", err)
+		}
+	}
+
+	if _, err := ss.GetStream("testfile1", io.Discard); !errors.Is(err, storage.ErrCorrupted) {
+		t.Fatalf("Expected ErrCorrupted, got %v", err)
+	}
+	// the corrupted file is reported to fn, and the iteration goes on
+	var readErr error
+	err := ss.ForEachFile(func(key string) bool { return key == "testfile2" }, func(info *storage.FileInfo, value io.Reader) error {
+		_, readErr = io.ReadAll(value)
+		return readErr
+	})
+	if err != nil || !errors.Is(readErr, storage.ErrCorrupted) {
+		t.Fatalf("Expected ErrCorrupted in fn only, got %v, %v", readErr, err)
+	}
+
+	if quarantined := ss.Quarantined(); len(quarantined) != 2 {
+		t.Fatalf("Expected 2 files in quarantine, got %v", quarantined)
+	}
+	if _, err := ss.GetStream("testfile1", io.Discard); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected quarantined file to be absent, got %v", err)
+	}
+}
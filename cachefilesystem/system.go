@@ -1,31 +1,52 @@
 package storage
 
 import (
-	"container/list"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/chord-dht/chord-core/storage"
 )
 
 // CacheStorageSystem represents a storage system with caching and disk persistence.
 type CacheStorageSystem struct {
-	storagePath string              // Path to store files on disk
-	filesname   map[string]struct{} // Map to track stored files
+	storagePath string               // Path to store files on disk
+	filesname   map[string]*fileMeta // Map to track stored files and their metadata
+	index       *storage.KeyIndex    // Keys of the filesname sorted by identifier, for GetRange and ExtractRange
 
-	cache       map[string]*list.Element // In-memory cache
-	cacheList   *list.List               // List to maintain LRU order
-	cacheSize   int                      // Maximum size of the cache
-	maxFileSize int64                    // Maximum file size, files larger than this will be stored directly on disk
+	cache       *valueCache // In-memory cache of the values, within a byte budget
+	maxFileSize int64       // Maximum file size, files larger than this will be stored directly on disk
 
-	mu sync.Mutex // Mutex to ensure thread safety
+	transfers *storage.TransferLog // Pending transfers of the files, see BeginTransfer
+
+	locks   keyLocks     // Per-key locks of the files on disk, see keyLocks for the lock order
+	mu      sync.RWMutex // Guards the filesname and the index
+	cacheMu sync.Mutex   // Guards the cache, a hit updates the cache policy
 }
 
-// NewStorage creates a new StorageSystem instance with default settings.
+// NewStorage creates a new StorageSystem instance with default settings: a 64MB LRU cache of the files up to 1MB.
+// The files already in storagePath (from a previous run) are tracked, see rebuildIndex.
 func NewStorage(storagePath string) (*CacheStorageSystem, error) {
+	defaultCacheBytes := int64(64 * 1024 * 1024) // 64MB
+	defaultMaxFileSize := int64(1024 * 1024)     // 1MB
+
+	return NewStorageWithCache(storagePath, defaultCacheBytes, defaultMaxFileSize, CacheLRU)
+}
+
+// NewStorageWithCache creates a new StorageSystem instance with a cache of cacheBytes (keys and values)
+// using the cache policy (CacheLRU, CacheLFU, CacheARC or CacheTinyLFU), the files larger than maxFileSize
+// are not cached. The files already in storagePath (from a previous run) are tracked, see rebuildIndex.
+func NewStorageWithCache(
+	storagePath string,
+	cacheBytes int64,
+	maxFileSize int64,
+	policy string,
+) (*CacheStorageSystem, error) {
 	// Create the storage directory if it does not exist
 	if _, err := os.Stat(storagePath); os.IsNotExist(err) {
 		err := os.MkdirAll(storagePath, os.ModePerm)
@@ -36,62 +57,112 @@ func NewStorage(storagePath string) (*CacheStorageSystem, error) {
 		return nil, fmt.Errorf("error checking directory: %w", err)
 	}
 
-	defaultCacheSize := 100
-	defaultMaxFileSize := int64(1024 * 1024) // 1MB
+	cache, err := newValueCache(cacheBytes, policy)
+	if err != nil {
+		return nil, err
+	}
+	transfers, err := storage.OpenTransferLog(filepath.Join(storagePath, transferDirName, transferFileName))
+	if err != nil {
+		return nil, err
+	}
+	s := newStorageSystem(storagePath, cache, maxFileSize, transfers)
 
-	return NewStorageWithSetting(
-		storagePath,
-		defaultCacheSize,
-		defaultMaxFileSize,
-	), nil
-}
+	// Remove the temporary files left by a crash, and finish the writes it interrupted
+	if err := s.cleanTemp(); err != nil {
+		return nil, err
+	}
+	if err := s.recoverPending(); err != nil {
+		return nil, err
+	}
 
-// cacheItem is an alias for File.
-type cacheItem = storage.File
+	// Track the files already on disk
+	if err := s.rebuildIndex(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
 
 // NewStorageWithSetting creates a new StorageSystem instance with a cache size and max file size.
-func NewStorageWithSetting(
+// The cache is an LRU cache holding up to cacheSize files of maxFileSize bytes, the files already
+// in storagePath are not tracked, and a transfer log which can't be read is replaced by an empty one.
+//
+// Deprecated: use NewStorageWithCache, which picks the cache policy and reports the errors.
+func NewStorageWithSetting(storagePath string, cacheSize int, maxFileSize int64) *CacheStorageSystem {
+	// an LRU cache with a budget of at least 0 bytes can't fail
+	cache, _ := newValueCache(max(int64(cacheSize)*maxFileSize, 0), CacheLRU)
+	transfers, err := storage.OpenTransferLog(filepath.Join(storagePath, transferDirName, transferFileName))
+	if err != nil {
+		transfers, _ = storage.OpenTransferLog("")
+	}
+	return newStorageSystem(storagePath, cache, maxFileSize, transfers)
+}
+
+// newStorageSystem creates a StorageSystem instance, without tracking the files already in storagePath.
+func newStorageSystem(
 	storagePath string,
-	cacheSize int,
+	cache *valueCache,
 	maxFileSize int64,
+	transfers *storage.TransferLog,
 ) *CacheStorageSystem {
 	return &CacheStorageSystem{
 		storagePath: storagePath,
-		filesname:   make(map[string]struct{}),
-		cache:       make(map[string]*list.Element),
-		cacheList:   list.New(),
-		cacheSize:   cacheSize,
+		filesname:   make(map[string]*fileMeta),
+		index:       storage.NewKeyIndex(),
+		cache:       cache,
 		maxFileSize: maxFileSize,
+		transfers:   transfers,
 	}
 }
 
-// persistToDisk saves the given value to a file on disk.
+// CacheStats returns the statistics of the cache.
+func (s *CacheStorageSystem) CacheStats() CacheStats {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	return s.cache.stats()
+}
+
+// persistToDisk saves the given value to a file on disk, atomically (see writeFileAtomic).
 func (s *CacheStorageSystem) persistToDisk(fileKey string, Value []byte) error {
-	filePath := filepath.Join(s.storagePath, fileKey)
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("error creating file: %w", err)
-	}
-	defer file.Close()
+	filePath := s.filePath(fileKey)
+	return s.writeFileAtomic(filePath, Value)
+}
 
-	_, err = file.Write(Value)
-	if err != nil {
-		return fmt.Errorf("error writing to file: %w", err)
+// persistFile saves the file and its metadata on disk, and returns the metadata, the caller tracks it.
+// A file with a wrong checksum is rejected, and a quarantined copy of the file is dropped.
+// The new metadata is made pending before the value is written, then the value and the metadata are renamed
+// into place: a crash in between is finished at startup (see recoverPending).
+// The caller holds the write lock of the key.
+func (s *CacheStorageSystem) persistFile(file *storage.File) (*fileMeta, error) {
+	if err := validateKey(file.Key); err != nil {
+		return nil, err
+	}
+	if err := file.Verify(); err != nil {
+		return nil, err
 	}
 
-	err = file.Sync()
-	if err != nil {
-		os.Remove(filePath)
-		return fmt.Errorf("error syncing file: %w", err)
+	meta := s.newMeta(file)
+	if err := s.persistPending(meta); err != nil {
+		return nil, err
 	}
+	defer s.clearPending(file.Key)
 
-	s.filesname[fileKey] = struct{}{}
-	return nil
+	if err := s.persistToDisk(file.Key, file.Value); err != nil {
+		return nil, err
+	}
+	if err := s.release(file.Key); err != nil {
+		return nil, err
+	}
+	if err := s.persistMeta(file.Key, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
 }
 
-// loadFromDisk loads the value from a file on disk.
+// loadFromDisk loads the value from a file on disk, and verifies it against the checksum in the metadata.
+// The caller holds the lock of the key, a corrupted file is reported with ErrCorrupted (see quarantineCorrupted).
 func (s *CacheStorageSystem) loadFromDisk(fileKey string) ([]byte, error) {
-	filePath := filepath.Join(s.storagePath, fileKey)
+	filePath := s.filePath(fileKey)
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("error opening file: %w", err)
@@ -108,76 +179,214 @@ func (s *CacheStorageSystem) loadFromDisk(fileKey string) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error reading file: %w", err)
 	}
+	if err := s.verify(fileKey, data); err != nil {
+		return nil, err
+	}
 	return data, nil
 }
 
-// addToCache adds the given file to the cache.
-func (s *CacheStorageSystem) addToCache(fileKey string, value []byte) {
-	// If the cache is full, remove the least recently used item
-	if s.cacheList.Len() >= s.cacheSize {
-		backElement := s.cacheList.Back()
-		if backElement != nil {
-			s.cacheList.Remove(backElement)
-			delete(s.cache, backElement.Value.(*cacheItem).Key)
-			backElement.Value = nil // Explicitly set to nil to avoid memory leak
+// track sets the metadata of the files in the filesname, in one step.
+func (s *CacheStorageSystem) track(metas ...*fileMeta) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, meta := range metas {
+		s.filesname[meta.Key] = meta
+		s.index.Add(meta.Key)
+	}
+}
+
+// untrack removes the files from the filesname, in one step.
+func (s *CacheStorageSystem) untrack(fileKeys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, fileKey := range fileKeys {
+		delete(s.filesname, fileKey)
+		s.index.Remove(fileKey)
+	}
+}
+
+// snapshot returns the metadata of the tracked files that satisfy the filter, the expired ones are skipped
+// unless withExpired is set. The files may change once it returns, the callers check them again under their lock.
+func (s *CacheStorageSystem) snapshot(filter func(string) bool, withExpired bool) map[string]*fileMeta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	metas := make(map[string]*fileMeta)
+	for fileKey, meta := range s.filesname {
+		if (withExpired || !meta.expired(now)) && filter(fileKey) {
+			metas[fileKey] = meta
 		}
 	}
+	return metas
+}
 
-	// Add the value to the cache
-	item := &cacheItem{Key: fileKey, Value: value}
-	element := s.cacheList.PushFront(item)
-	s.cache[fileKey] = element
+// snapshotRange is snapshot for the files with an identifier in (lo, hi], found with the index.
+func (s *CacheStorageSystem) snapshotRange(lo, hi *big.Int) map[string]*fileMeta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	metas := make(map[string]*fileMeta)
+	for _, fileKey := range s.index.Range(lo, hi) {
+		if meta, found := s.filesname[fileKey]; found && !meta.expired(now) {
+			metas[fileKey] = meta
+		}
+	}
+	return metas
 }
 
-// persistAndCache persists the value to disk and caches it if it is small enough.
-func (s *CacheStorageSystem) persistAndCache(fileKey string, value []byte) error {
-	// Persist the value to disk
-	if err := s.persistToDisk(fileKey, value); err != nil {
+// addToCache adds the given file to the cache, the policy may evict other files.
+func (s *CacheStorageSystem) addToCache(fileKey string, value []byte) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	s.cache.add(fileKey, value)
+}
+
+// persistAndCache persists the file to disk and caches it if it is small enough.
+// The caller holds the write lock of the key.
+func (s *CacheStorageSystem) persistAndCache(file *storage.File) error {
+	// Persist the file and its metadata to disk, then add the fileKey to the filesname map
+	meta, err := s.persistFile(file)
+	if err != nil {
 		return err
 	}
+	s.track(meta)
+	s.cacheFile(file)
+	return nil
+}
 
-	// Add the fileKey to the filesname map
-	s.filesname[fileKey] = struct{}{}
+// cacheFile caches the value of the file if it is small enough, and drops the old value otherwise.
+func (s *CacheStorageSystem) cacheFile(file *storage.File) {
+	// If the file size is larger than maxFileSize, do not cache it (and drop the old value if it is cached)
+	if int64(len(file.Value)) > s.maxFileSize {
+		s.removeFromCache(file.Key)
+		return
+	}
 
-	// Check the file size
-	fileSize := int64(len(value))
+	// Update the cache with the new value
+	s.addToCache(file.Key, file.Value)
+}
+
+// removeFromCache removes the file from the cache if present.
+func (s *CacheStorageSystem) removeFromCache(fileKey string) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	s.cache.remove(fileKey)
+}
 
-	// If the file size is larger than maxFileSize, do not cache it
-	if fileSize > s.maxFileSize {
-		return nil
+// getValue gets the value of a tracked file, from the cache or from disk.
+// The caller holds the lock of the key.
+func (s *CacheStorageSystem) getValue(fileKey string) ([]byte, error) {
+	// Check if the value is in the cache
+	s.cacheMu.Lock()
+	value, found := s.cache.get(fileKey)
+	s.cacheMu.Unlock()
+	if found {
+		return value, nil
+	}
+
+	// Load the value from disk
+	value, err := s.loadFromDisk(fileKey)
+	if err != nil {
+		return nil, err
 	}
 
 	// Add the value to the cache
-	s.addToCache(fileKey, value)
+	if int64(len(value)) <= s.maxFileSize {
+		s.addToCache(fileKey, value)
+	}
 
-	return nil
+	return value, nil
+}
+
+// readFile reads a tracked file under the read lock of its key, from the cache or (if fromDisk is set)
+// directly from disk. A corrupted file is moved to the quarantine, see quarantineCorrupted.
+func (s *CacheStorageSystem) readFile(fileKey string, fromDisk bool) (*storage.File, error) {
+	unlock := s.locks.rlock(fileKey)
+	meta, found := s.lookup(fileKey)
+	if !found {
+		unlock()
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+
+	var value []byte
+	var err error
+	if fromDisk {
+		value, err = s.loadFromDisk(fileKey)
+	} else {
+		value, err = s.getValue(fileKey)
+	}
+	unlock()
+
+	if storage.IsCorrupted(err) {
+		return nil, s.quarantineCorrupted(fileKey, meta)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return meta.file(fileKey, value), nil
 }
 
 // CheckFiles checks if the files still exist on disk.
+// Every shard directory is listed once, instead of checking the files one by one,
+// and a file missing from the listing is checked again under its lock, as it may have been written meanwhile.
 func (s *CacheStorageSystem) CheckFiles() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	var keysToDelete []string
+	metas := s.snapshot(func(string) bool { return true }, true)
+
+	// the files on disk, grouped by shard; a shard which can't be listed is skipped
+	onDisk := make(map[string]map[string]struct{})
+	for fileKey := range metas {
+		shard := shardOf(fileKey)
+		if _, listed := onDisk[shard]; listed {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.storagePath, shard))
+		if err != nil && !os.IsNotExist(err) {
+			continue
+		}
+		names := make(map[string]struct{}, len(entries))
+		for _, entry := range entries {
+			names[entry.Name()] = struct{}{}
+		}
+		onDisk[shard] = names
+	}
 
-	for fileKey := range s.filesname {
-		filePath := filepath.Join(s.storagePath, fileKey)
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			keysToDelete = append(keysToDelete, fileKey)
+	for fileKey := range metas {
+		names, listed := onDisk[shardOf(fileKey)]
+		if !listed {
+			continue
+		}
+		if _, found := names[encodeKey(fileKey)]; !found {
+			s.untrackMissing(fileKey)
 		}
 	}
+}
 
-	for _, key := range keysToDelete {
-		delete(s.filesname, key)
+// untrackMissing stops tracking the file if it is missing on disk.
+func (s *CacheStorageSystem) untrackMissing(fileKey string) {
+	defer s.locks.lock(fileKey)()
+
+	if _, err := os.Stat(s.filePath(fileKey)); os.IsNotExist(err) {
+		s.removeFromCache(fileKey)
+		s.untrack(fileKey)
 	}
 }
 
 func (s *CacheStorageSystem) GetFilesName() []string {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
+	now := time.Now()
 	keys := make([]string, 0, len(s.filesname))
-	for key := range s.filesname {
+	for key, meta := range s.filesname {
+		if meta.expired(now) {
+			continue
+		}
 		keys = append(keys, key)
 	}
 
@@ -187,173 +396,249 @@ func (s *CacheStorageSystem) GetFilesName() []string {
 // Get retrieves the value associated with the given fileKey.
 // It first checks the filesname, then the cache, and if not found, loads it from disk.
 func (s *CacheStorageSystem) Get(fileKey string) ([]byte, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Check if the fileKey is in the filesname
-	if _, found := s.filesname[fileKey]; !found {
-		return nil, fmt.Errorf("fileKey not found: %s", fileKey)
-	}
-
-	// Check if the value is in the cache
-	if element, found := s.cache[fileKey]; found {
-		s.cacheList.MoveToFront(element)
-		return element.Value.(*cacheItem).Value, nil
-	}
-
-	// Load the value from disk
-	value, err := s.loadFromDisk(fileKey)
+	file, err := s.readFile(fileKey, false)
 	if err != nil {
 		return nil, err
 	}
+	return file.Value, nil
+}
 
-	// Add the value to the cache
-	s.addToCache(fileKey, value)
+// GetFile retrieves the file (value and version) associated with the given fileKey.
+func (s *CacheStorageSystem) GetFile(fileKey string) (*storage.File, error) {
+	return s.readFile(fileKey, false)
+}
 
-	return value, nil
+// Stat returns the metadata of the file, without reading its value.
+func (s *CacheStorageSystem) Stat(fileKey string) (*storage.FileInfo, error) {
+	meta, found := s.lookup(fileKey)
+	if !found {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	return meta.info(fileKey), nil
 }
 
-// Put stores the value associated with the given fileKey.
+// Put stores the value associated with the given fileKey, with the zero version.
 func (s *CacheStorageSystem) Put(fileKey string, value []byte) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	return s.persistAndCache(fileKey, value)
+	return s.PutFile(&storage.File{Key: fileKey, Value: value})
 }
 
-// Update modifies the value associated with the given fileKey.
-func (s *CacheStorageSystem) Update(fileKey string, newValue []byte) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// PutFile stores the file together with its version and expiry time.
+func (s *CacheStorageSystem) PutFile(file *storage.File) error {
+	defer s.locks.lock(file.Key)()
 
-	// Check if the fileKey exists in the filesname
-	if _, found := s.filesname[fileKey]; !found {
-		return fmt.Errorf("fileKey not found: %s", fileKey)
-	}
-
-	// Persist the new value to disk
-	if err := s.persistToDisk(fileKey, newValue); err != nil {
-		return err
-	}
+	return s.persistAndCache(file)
+}
 
-	// Check the file size
-	fileSize := int64(len(newValue))
+// PutWithTTL stores the value associated with the given fileKey, with the zero version,
+// the file expires after ttl.
+func (s *CacheStorageSystem) PutWithTTL(fileKey string, value []byte, ttl time.Duration) error {
+	return s.PutFile(&storage.File{Key: fileKey, Value: value, ExpireAt: time.Now().Add(ttl)})
+}
 
-	// If the file size is larger than maxFileSize, remove it from the cache
-	if fileSize > s.maxFileSize {
-		if element, found := s.cache[fileKey]; found {
-			s.cacheList.Remove(element)
-			delete(s.cache, fileKey)
-		}
-		return nil
-	}
+// Update modifies the value associated with the given fileKey, with the zero version.
+func (s *CacheStorageSystem) Update(fileKey string, newValue []byte) error {
+	defer s.locks.lock(fileKey)()
 
-	// Update the cache with the new value
-	if element, found := s.cache[fileKey]; found {
-		s.cacheList.MoveToFront(element)
-		element.Value.(*cacheItem).Value = newValue
-	} else {
-		s.addToCache(fileKey, newValue)
+	// Check if the fileKey exists in the filesname
+	if _, found := s.lookup(fileKey); !found {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
 	}
 
-	return nil
+	// Persist the new value to disk and update the cache
+	return s.persistAndCache(&storage.File{Key: fileKey, Value: newValue})
 }
 
 // Delete removes the value associated with the given fileKey from both the cache and disk.
 func (s *CacheStorageSystem) Delete(fileKey string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.locks.lock(fileKey)()
 
 	// Check if the fileKey exists in the filesname
-	if _, found := s.filesname[fileKey]; !found {
-		return fmt.Errorf("fileKey not found: %s", fileKey)
+	if _, found := s.tracked(fileKey); !found {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
 	}
 
+	return s.deleteFile(fileKey)
+}
+
+// deleteFile removes a tracked file from the filesname, the cache and disk.
+// The caller holds the write lock of the key.
+func (s *CacheStorageSystem) deleteFile(fileKey string) error {
 	// defer ensures the fileKey is removed from the filesname regardless of os.Remove result
-	defer delete(s.filesname, fileKey)
+	defer s.untrack(fileKey)
 
 	// Remove from cache if present
-	if element, found := s.cache[fileKey]; found {
-		s.cacheList.Remove(element)
-		delete(s.cache, fileKey)
-	}
+	s.removeFromCache(fileKey)
 
 	// Remove from disk
-	filePath := filepath.Join(s.storagePath, fileKey)
+	filePath := s.filePath(fileKey)
 	err := os.Remove(filePath)
 	if err != nil {
 		return fmt.Errorf("error removing file: %w", err)
-	} else {
-		return nil
 	}
+	return s.removeMeta(fileKey)
 }
 
+// PutIfAbsent stores the file only if the fileKey is not in the storage yet.
+// It returns the version of the stored file, or the current version with ErrExists.
+func (s *CacheStorageSystem) PutIfAbsent(file *storage.File) (storage.Version, error) {
+	defer s.locks.lock(file.Key)()
+
+	if meta, found := s.lookup(file.Key); found {
+		return meta.Version, fmt.Errorf("%w: %s", storage.ErrExists, file.Key)
+	}
+
+	if err := s.persistAndCache(file); err != nil {
+		return storage.Version{}, err
+	}
+	return file.Version, nil
+}
+
+// CompareAndSwap stores the file only if the current version of the fileKey is the expected one.
+// It returns the version of the stored file, or the current version with ErrVersionMismatch.
+func (s *CacheStorageSystem) CompareAndSwap(file *storage.File, expected storage.Version) (storage.Version, error) {
+	defer s.locks.lock(file.Key)()
+
+	meta, found := s.lookup(file.Key)
+	if !found {
+		return storage.Version{}, fmt.Errorf("%w: %s", storage.ErrNotFound, file.Key)
+	}
+	if meta.Version != expected {
+		return meta.Version, fmt.Errorf("%w: %s", storage.ErrVersionMismatch, file.Key)
+	}
+
+	if err := s.persistAndCache(file); err != nil {
+		return meta.Version, err
+	}
+	return file.Version, nil
+}
+
+// DeleteIfVersion removes the fileKey only if its current version is the expected one.
+// It returns the zero version, or the current version with ErrVersionMismatch.
+func (s *CacheStorageSystem) DeleteIfVersion(fileKey string, expected storage.Version) (storage.Version, error) {
+	defer s.locks.lock(fileKey)()
+
+	meta, found := s.lookup(fileKey)
+	if !found {
+		return storage.Version{}, fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	if meta.Version != expected {
+		return meta.Version, fmt.Errorf("%w: %s", storage.ErrVersionMismatch, fileKey)
+	}
+
+	if err := s.deleteFile(fileKey); err != nil {
+		return meta.Version, err
+	}
+	return storage.Version{}, nil
+}
+
+// GetFilesByFilter gets the files that satisfy the filter, reading them one by one from disk under their locks,
+// so the other keys stay available meanwhile. The corrupted files are quarantined and skipped,
+// and the files removed meanwhile are skipped.
 func (s *CacheStorageSystem) GetFilesByFilter(filter func(string) bool) (storage.FileList, error) {
-	var files storage.FileList
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.getFiles(s.snapshot(filter, false))
+}
 
-	for fileKey := range s.filesname {
-		if filter(fileKey) {
-			// Load the value from disk
-			value, err := s.loadFromDisk(fileKey)
-			if err != nil {
-				return nil, err
-			}
+// GetRange gets the files with an identifier in (lo, hi], see GetFilesByFilter.
+func (s *CacheStorageSystem) GetRange(lo, hi *big.Int) (storage.FileList, error) {
+	return s.getFiles(s.snapshotRange(lo, hi))
+}
+
+// getFiles reads the files of the snapshot, see GetFilesByFilter.
+func (s *CacheStorageSystem) getFiles(metas map[string]*fileMeta) (storage.FileList, error) {
+	var files storage.FileList
 
-			// Add the value to the files list
-			files = append(files, &storage.File{Key: fileKey, Value: value})
+	for fileKey := range metas {
+		// Load the value from disk directly
+		file, err := s.readFile(fileKey, true)
+		if storage.IsCorrupted(err) || errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
 		}
+
+		// Add the value to the files list
+		files = append(files, file)
 	}
 	return files, nil
 }
 
 // PutFiles stores the given files.
+// The keys are locked together and the files are tracked in one step, so the other calls see all of them or none.
 func (s *CacheStorageSystem) PutFiles(files storage.FileList) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.putFiles(files, false)
+}
+
+// PutFilesIfNewer stores the given files, except those the storage has a newer version of,
+// the versions are compared under the locks of the keys, see PutFiles.
+func (s *CacheStorageSystem) PutFilesIfNewer(files storage.FileList) error {
+	return s.putFiles(files, true)
+}
 
+// putFiles stores the files, leaving out the ones older than the stored version if ifNewer is set.
+func (s *CacheStorageSystem) putFiles(files storage.FileList, ifNewer bool) error {
+	// a list with an invalid file is rejected as a whole
+	keys := make([]string, 0, len(files))
 	for _, file := range files {
-		if err := s.persistAndCache(file.Key, file.Value); err != nil {
+		if err := validateKey(file.Key); err != nil {
+			return err
+		}
+		if err := file.Verify(); err != nil {
 			return err
 		}
+		keys = append(keys, file.Key)
 	}
-	return nil
-}
 
-// GetAllFiles retrieves all files from the storage system.
-func (s *CacheStorageSystem) GetAllFiles() (storage.FileList, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.locks.lockKeys(keys)()
 
-	var files storage.FileList
+	if ifNewer {
+		var newer storage.FileList
+		for _, file := range files {
+			if meta, found := s.lookup(file.Key); found && meta.Version.After(file.Version) {
+				continue
+			}
+			newer = append(newer, file)
+		}
+		files = newer
+	}
 
-	// Iterate over all fileKeys in the filesname
-	for fileKey := range s.filesname {
-		// Load the value from disk directly
-		value, err := s.loadFromDisk(fileKey)
+	// the files persisted before an error are kept
+	var metas []*fileMeta
+	var finalErr error
+	for _, file := range files {
+		meta, err := s.persistFile(file)
 		if err != nil {
-			return nil, err
+			finalErr = err
+			break
 		}
-
-		// Add the value to the files list
-		files = append(files, &storage.File{Key: fileKey, Value: value})
+		metas = append(metas, meta)
+	}
+	s.track(metas...)
+	for _, file := range files[:len(metas)] {
+		s.cacheFile(file)
 	}
+	return finalErr
+}
 
-	return files, nil
+// GetAllFiles retrieves all files from the storage system.
+func (s *CacheStorageSystem) GetAllFiles() (storage.FileList, error) {
+	return s.GetFilesByFilter(func(string) bool { return true })
 }
 
-// Clear removes all files from both the cache and disk.
+// Clear removes all files from both the cache and disk, it waits for the other calls to finish.
 func (s *CacheStorageSystem) Clear() error {
+	defer s.locks.lockAll()()
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
 
 	// Clear the cache
-	s.cache = make(map[string]*list.Element)
-	s.cacheList.Init()
+	s.cache.clear()
 
 	// Clear the filesname map
-	s.filesname = make(map[string]struct{})
+	s.filesname = make(map[string]*fileMeta)
+	s.index.Clear()
 
 	// Remove all files from the disk
 	err := os.RemoveAll(s.storagePath)
@@ -367,60 +652,85 @@ func (s *CacheStorageSystem) Clear() error {
 		return fmt.Errorf("error recreating storage directory: %w", err)
 	}
 
-	return nil
+	return s.transfers.Clear()
 }
 
 // ExtractFilesByFilter extracts the files that match the filter from the file system and returns them as a FileList.
 // It also removes the files from the file system.
+// The matching keys are locked together and removed from the filesname in one step at the end.
 // If an error occurs, the process continues to the next file.
 //  1. Load the value from disk failed -> continue to the next file, but delete the key from the filesname later
 //  2. Remove from disk failed -> continue to the next file, but delete the key from the filesname later
 //
 // This function is special, as even if an error occurs, we still believe the FileList result is valid.
 func (s *CacheStorageSystem) ExtractFilesByFilter(filter func(string) bool) (storage.FileList, error) {
+	return s.extractFiles(s.snapshot(filter, false))
+}
+
+// ExtractRange extracts the files with an identifier in (lo, hi], see ExtractFilesByFilter.
+func (s *CacheStorageSystem) ExtractRange(lo, hi *big.Int) (storage.FileList, error) {
+	return s.extractFiles(s.snapshotRange(lo, hi))
+}
+
+// extractFiles extracts the files of the snapshot, see ExtractFilesByFilter.
+func (s *CacheStorageSystem) extractFiles(metas map[string]*fileMeta) (storage.FileList, error) {
 	var files storage.FileList
 	var keysToDelete []string
 	var errs []error
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	keys := make([]string, 0, len(metas))
+	for fileKey := range metas {
+		keys = append(keys, fileKey)
+	}
+
+	defer s.locks.lockKeys(keys)()
 
 	defer func() {
-		if len(keysToDelete) > 0 {
-			// Delete keys from filesname map
-			for _, key := range keysToDelete {
-				delete(s.filesname, key)
-			}
-		}
+		// Delete keys from filesname map
+		s.untrack(keysToDelete...)
 	}()
 
-	for fileKey := range s.filesname {
-		if filter(fileKey) {
-			// Load the value from disk directly
-			value, err := s.loadFromDisk(fileKey)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("error loading file %s: %w", fileKey, err))
-				keysToDelete = append(keysToDelete, fileKey)
-				// error won't stop the process, but continue to the next file
-				continue
-			}
+	for _, fileKey := range keys {
+		// the file may have been removed or rewritten before the keys were locked
+		meta, found := s.lookup(fileKey)
+		if !found {
+			continue
+		}
+
+		// Load the value from disk directly, a corrupted file is quarantined and skipped
+		value, err := s.loadFromDisk(fileKey)
+		if storage.IsCorrupted(err) {
+			s.quarantine(fileKey)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error loading file %s: %w", fileKey, err))
+			keysToDelete = append(keysToDelete, fileKey)
+			// error won't stop the process, but continue to the next file
+			continue
+		}
 
-			// Add the value to the files list
-			files = append(files, &storage.File{Key: fileKey, Value: value})
+		// Add the value to the files list
+		files = append(files, meta.file(fileKey, value))
 
-			// Remove from disk
-			filePath := filepath.Join(s.storagePath, fileKey)
-			err = os.Remove(filePath)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("error removing file %s: %w", fileKey, err))
-				keysToDelete = append(keysToDelete, fileKey)
-				// error won't stop the process, but continue to the next file
-				continue
-			}
+		// Remove from cache if present
+		s.removeFromCache(fileKey)
 
-			// Add the key to the keysToDelete list
+		// Remove from disk
+		filePath := s.filePath(fileKey)
+		err = os.Remove(filePath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error removing file %s: %w", fileKey, err))
 			keysToDelete = append(keysToDelete, fileKey)
+			// error won't stop the process, but continue to the next file
+			continue
 		}
+		if err := s.removeMeta(fileKey); err != nil {
+			errs = append(errs, fmt.Errorf("error removing metadata %s: %w", fileKey, err))
+		}
+
+		// Add the key to the keysToDelete list
+		keysToDelete = append(keysToDelete, fileKey)
 	}
 
 	if len(errs) > 0 {
@@ -429,3 +739,36 @@ func (s *CacheStorageSystem) ExtractFilesByFilter(filter func(string) bool) (sto
 
 	return files, nil
 }
+
+// RemoveExpired removes the expired files from both the cache and disk, and returns their keys.
+// If an error occurs, the process continues to the next file.
+func (s *CacheStorageSystem) RemoveExpired() ([]string, error) {
+	var removed []string
+	var errs []error
+
+	for fileKey := range s.snapshot(func(string) bool { return true }, true) {
+		expired, err := s.removeIfExpired(fileKey)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if expired {
+			removed = append(removed, fileKey)
+		}
+	}
+
+	if len(errs) > 0 {
+		return removed, fmt.Errorf("encountered errors: %v", len(errs))
+	}
+	return removed, nil
+}
+
+// removeIfExpired removes the file under its lock if it is (still) expired.
+func (s *CacheStorageSystem) removeIfExpired(fileKey string) (bool, error) {
+	defer s.locks.lock(fileKey)()
+
+	meta, found := s.tracked(fileKey)
+	if !found || !meta.expired(time.Now()) {
+		return false, nil
+	}
+	return true, s.deleteFile(fileKey)
+}
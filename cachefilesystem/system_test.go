@@ -2,9 +2,13 @@ package storage
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/chord-dht/chord-core/storage"
 )
@@ -46,7 +50,7 @@ func TestPersistToDisk(t *testing.T) {
 		t.Fatalf("Failed to persist to disk: %v", err)
 	}
 
-	filePath := filepath.Join(ss.storagePath, fileKey)
+	filePath := ss.filePath(fileKey)
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		t.Fatalf("Expected file to exist: %s", filePath)
 	}
@@ -83,7 +87,7 @@ func TestAddToCache(t *testing.T) {
 
 	ss.addToCache(fileKey, value)
 
-	if _, found := ss.cache[fileKey]; !found {
+	if !ss.cache.contains(fileKey) {
 		t.Fatal("Expected file to be in cache")
 	}
 }
@@ -158,7 +162,7 @@ func TestUpdate(t *testing.T) {
 	}
 
 	// Check if the updated value is persisted to disk
-	filePath := filepath.Join(ss.storagePath, fileKey)
+	filePath := ss.filePath(fileKey)
 	diskValue, err := os.ReadFile(filePath)
 	if err != nil {
 		t.Fatalf("Failed to read file from disk: %v", err)
@@ -190,7 +194,7 @@ func TestDelete(t *testing.T) {
 		t.Fatal("Expected file to be removed from filesname")
 	}
 
-	filePath := filepath.Join(ss.storagePath, fileKey)
+	filePath := ss.filePath(fileKey)
 	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
 		t.Fatalf("Expected file to be removed from disk: %s", filePath)
 	}
@@ -284,7 +288,7 @@ func TestClear(t *testing.T) {
 		t.Fatal("Expected filesname to be empty")
 	}
 
-	if len(ss.cache) != 0 {
+	if ss.cache.len() != 0 {
 		t.Fatal("Expected cache to be empty")
 	}
 
@@ -322,8 +326,586 @@ func TestExtractFilesByFilter(t *testing.T) {
 		t.Fatalf("Expected file %s to be removed from filesname", fileKey1)
 	}
 
-	filePath := filepath.Join(ss.storagePath, fileKey1)
+	filePath := ss.filePath(fileKey1)
 	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
 		t.Fatalf("Expected file %s to be removed from disk", filePath)
 	}
 }
+
+func TestPutFileVersion(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	version := storage.Version{WallTime: 42, Logical: 1, NodeID: "node"}
+	err := ss.PutFile(&storage.File{Key: "testfile", Value: []byte("testdata"), Version: version})
+	if err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+
+	file, err := ss.GetFile("testfile")
+	if err != nil {
+		t.Fatalf("Failed to get file: %v", err)
+	}
+	if file.Version != version {
+		t.Fatalf("Expected version %v, got %v", version, file.Version)
+	}
+
+	// the version is persisted next to the file
+	meta, err := ss.loadMeta("testfile")
+	if err != nil {
+		t.Fatalf("Failed to load metadata: %v", err)
+	}
+	if meta.Version != version {
+		t.Fatalf("Expected persisted version %v, got %v", version, meta.Version)
+	}
+
+	files, err := ss.GetAllFiles()
+	if err != nil {
+		t.Fatalf("Failed to get all files: %v", err)
+	}
+	if len(files) != 1 || files[0].Version != version {
+		t.Fatalf("Expected the file list to carry version %v, got %v", version, files)
+	}
+}
+
+func TestMergeFiles(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	older := storage.Version{WallTime: 1, NodeID: "node"}
+	newer := storage.Version{WallTime: 2, NodeID: "node"}
+
+	ss.PutFile(&storage.File{Key: "testfile1", Value: []byte("newer"), Version: newer})
+	ss.PutFile(&storage.File{Key: "testfile2", Value: []byte("older"), Version: older})
+
+	err := storage.MergeFiles(ss, storage.FileList{
+		{Key: "testfile1", Value: []byte("older"), Version: older},
+		{Key: "testfile2", Value: []byte("newer"), Version: newer},
+	})
+	if err != nil {
+		t.Fatalf("Failed to merge files: %v", err)
+	}
+
+	for _, key := range []string{"testfile1", "testfile2"} {
+		value, err := ss.Get(key)
+		if err != nil {
+			t.Fatalf("Failed to get file: %v", err)
+		}
+		if !bytes.Equal(value, []byte("newer")) {
+			t.Fatalf("Expected the newer value for %s, got %s", key, value)
+		}
+	}
+}
+
+func TestPutIfAbsent(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	first := storage.Version{WallTime: 1, NodeID: "node"}
+	second := storage.Version{WallTime: 2, NodeID: "node"}
+
+	version, err := ss.PutIfAbsent(&storage.File{Key: "testfile", Value: []byte("first"), Version: first})
+	if err != nil || version != first {
+		t.Fatalf("Expected version %v, got %v, %v", first, version, err)
+	}
+
+	version, err = ss.PutIfAbsent(&storage.File{Key: "testfile", Value: []byte("second"), Version: second})
+	if !errors.Is(err, storage.ErrExists) {
+		t.Fatalf("Expected ErrExists, got %v", err)
+	}
+	if version != first {
+		t.Fatalf("Expected the current version %v, got %v", first, version)
+	}
+
+	value, _ := ss.Get("testfile")
+	if !bytes.Equal(value, []byte("first")) {
+		t.Fatalf("Expected first, got %s", value)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	first := storage.Version{WallTime: 1, NodeID: "node"}
+	second := storage.Version{WallTime: 2, NodeID: "node"}
+	third := storage.Version{WallTime: 3, NodeID: "node"}
+
+	if _, err := ss.CompareAndSwap(&storage.File{Key: "testfile", Version: second}, first); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	ss.PutFile(&storage.File{Key: "testfile", Value: []byte("first"), Version: first})
+
+	version, err := ss.CompareAndSwap(&storage.File{Key: "testfile", Value: []byte("second"), Version: second}, first)
+	if err != nil || version != second {
+		t.Fatalf("Expected version %v, got %v, %v", second, version, err)
+	}
+
+	// the expected version is stale now
+	version, err = ss.CompareAndSwap(&storage.File{Key: "testfile", Value: []byte("third"), Version: third}, first)
+	if !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Fatalf("Expected ErrVersionMismatch, got %v", err)
+	}
+	if version != second {
+		t.Fatalf("Expected the current version %v, got %v", second, version)
+	}
+
+	value, _ := ss.Get("testfile")
+	if !bytes.Equal(value, []byte("second")) {
+		t.Fatalf("Expected second, got %s", value)
+	}
+}
+
+func TestDeleteIfVersion(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	first := storage.Version{WallTime: 1, NodeID: "node"}
+	second := storage.Version{WallTime: 2, NodeID: "node"}
+
+	ss.PutFile(&storage.File{Key: "testfile", Value: []byte("second"), Version: second})
+
+	version, err := ss.DeleteIfVersion("testfile", first)
+	if !errors.Is(err, storage.ErrVersionMismatch) || version != second {
+		t.Fatalf("Expected ErrVersionMismatch with %v, got %v, %v", second, version, err)
+	}
+
+	if _, err := ss.DeleteIfVersion("testfile", second); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if _, found := ss.filesname["testfile"]; found {
+		t.Fatal("Expected file to be removed from filesname")
+	}
+}
+
+func TestPutWithTTL(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	if err := ss.PutWithTTL("short", []byte("short"), 500*time.Millisecond); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	ss.PutWithTTL("long", []byte("long"), time.Hour)
+	ss.Put("forever", []byte("forever"))
+
+	file, err := ss.GetFile("short")
+	if err != nil || file.ExpireAt.IsZero() {
+		t.Fatalf("Expected file with expiry time, got %v, %v", file, err)
+	}
+
+	time.Sleep(time.Until(file.ExpireAt) + 10*time.Millisecond)
+
+	if _, err := ss.Get("short"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for expired file, got %v", err)
+	}
+	if names := ss.GetFilesName(); len(names) != 2 {
+		t.Fatalf("Expected 2 files, got %v", names)
+	}
+	if _, err := ss.PutIfAbsent(&storage.File{Key: "short", Value: []byte("again")}); err != nil {
+		t.Fatalf("Expected PutIfAbsent to succeed over expired file, got %v", err)
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	ss.PutWithTTL("expired", []byte("expired"), time.Millisecond)
+	ss.PutWithTTL("alive", []byte("alive"), time.Hour)
+	time.Sleep(10 * time.Millisecond)
+
+	removed, err := ss.RemoveExpired()
+	if err != nil {
+		t.Fatalf("Failed to remove expired files: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "expired" {
+		t.Fatalf("Expected [expired], got %v", removed)
+	}
+	if _, err := os.Stat(ss.filePath("expired")); !os.IsNotExist(err) {
+		t.Fatal("Expected expired file to be removed from disk")
+	}
+	if _, found := ss.filesname["alive"]; !found {
+		t.Fatal("Expected alive file to be kept")
+	}
+}
+
+func TestExpireAtPersisted(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	ss.PutWithTTL("testfile", []byte("testdata"), time.Hour)
+	expireAt := ss.filesname["testfile"].ExpireAt
+
+	meta, err := ss.loadMeta("testfile")
+	if err != nil {
+		t.Fatalf("Failed to load meta: %v", err)
+	}
+	if !meta.ExpireAt.Equal(expireAt) {
+		t.Fatalf("Expected persisted expiry %v, got %v", expireAt, meta.ExpireAt)
+	}
+}
+
+func TestStat(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	value := []byte("<html><body>hello</body></html>")
+	ss.PutFile(&storage.File{Key: "page", Value: value, Owner: "127.0.0.1:8000"})
+
+	info, err := ss.Stat("page")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if info.Size != int64(len(value)) || info.Checksum != storage.Checksum(value) {
+		t.Fatalf("Unexpected size or checksum: %+v", info)
+	}
+	if info.ContentType != "text/html; charset=utf-8" {
+		t.Fatalf("Expected text/html content type, got %s", info.ContentType)
+	}
+	if info.Owner != "127.0.0.1:8000" || info.CreatedAt.IsZero() || info.ModifiedAt.IsZero() {
+		t.Fatalf("Unexpected owner or timestamps: %+v", info)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	ss.Update("page", []byte("new"))
+
+	updated, err := ss.Stat("page")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if !updated.CreatedAt.Equal(info.CreatedAt) || !updated.ModifiedAt.After(info.ModifiedAt) {
+		t.Fatalf("Expected creation time kept and modification time updated: %+v", updated)
+	}
+	if updated.Size != 3 {
+		t.Fatalf("Expected size 3, got %d", updated.Size)
+	}
+
+	if _, err := ss.Stat("nonexistent"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStatPersisted(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	ss.Put("notes.txt", []byte("notes"))
+
+	meta, err := ss.loadMeta("notes.txt")
+	if err != nil {
+		t.Fatalf("Failed to load meta: %v", err)
+	}
+	if meta.Checksum != storage.Checksum([]byte("notes")) || meta.ContentType != "text/plain; charset=utf-8" {
+		t.Fatalf("Unexpected persisted metadata: %+v", meta)
+	}
+}
+
+func TestCorruptionQuarantine(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	ss.Put("testfile", []byte("testdata"))
+	ss.removeFromCache("testfile")
+
+	// flip the content on disk behind the storage's back
+	if err := os.WriteFile(ss.filePath("testfile"), []byte("testdatb"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt file: %v", err)
+	}
+
+	if _, err := ss.Get("testfile"); !errors.Is(err, storage.ErrCorrupted) {
+		t.Fatalf("Expected ErrCorrupted, got %v", err)
+	}
+	if _, err := ss.Get("testfile"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected quarantined file to be absent, got %v", err)
+	}
+	if quarantined := ss.Quarantined(); len(quarantined) != 1 || quarantined[0] != "testfile" {
+		t.Fatalf("Expected [testfile] in quarantine, got %v", quarantined)
+	}
+
+	// storing the file again releases it from the quarantine
+	ss.Put("testfile", []byte("testdata"))
+	if quarantined := ss.Quarantined(); len(quarantined) != 0 {
+		t.Fatalf("Expected empty quarantine, got %v", quarantined)
+	}
+}
+
+func TestScrub(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	ss.Put("healthy", []byte("healthy"))
+	ss.Put("corrupted", []byte("corrupted"))
+	os.WriteFile(ss.filePath("corrupted"), []byte("garbage"), 0644)
+
+	corrupted, err := ss.Scrub()
+	if err != nil {
+		t.Fatalf("Failed to scrub: %v", err)
+	}
+	if len(corrupted) != 1 || corrupted[0] != "corrupted" {
+		t.Fatalf("Expected [corrupted], got %v", corrupted)
+	}
+
+	files, err := ss.GetAllFiles()
+	if err != nil || len(files) != 1 || files[0].Key != "healthy" {
+		t.Fatalf("Expected only the healthy file, got %v, %v", files, err)
+	}
+	if files[0].Checksum != storage.Checksum([]byte("healthy")) {
+		t.Fatalf("Expected file to carry its checksum, got %s", files[0].Checksum)
+	}
+}
+
+func TestRejectWrongChecksum(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	file := &storage.File{Key: "testfile", Value: []byte("testdata"), Checksum: storage.Checksum([]byte("other"))}
+	if err := ss.PutFile(file); !errors.Is(err, storage.ErrCorrupted) {
+		t.Fatalf("Expected ErrCorrupted, got %v", err)
+	}
+	if _, found := ss.filesname["testfile"]; found {
+		t.Fatal("Expected corrupted file not to be stored")
+	}
+}
+
+func TestPersistToDiskAtomic(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	ss.Put("testfile", []byte("old"))
+	ss.Update("testfile", []byte("new"))
+
+	value, err := os.ReadFile(ss.filePath("testfile"))
+	if err != nil || !bytes.Equal(value, []byte("new")) {
+		t.Fatalf("Expected new value on disk, got %s, %v", value, err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(ss.storagePath, tempDirName))
+	if len(entries) != 0 {
+		t.Fatalf("Expected no temporary file left, got %d", len(entries))
+	}
+}
+
+func TestCleanTemp(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	ss.Put("testfile", []byte("testdata"))
+
+	// a write interrupted by a crash leaves its temporary file behind
+	tempPath := filepath.Join(ss.storagePath, tempDirName, "testfile.123")
+	if err := os.WriteFile(tempPath, []byte("partial"), 0644); err != nil {
+		t.Fatalf("Failed to write temporary file: %v", err)
+	}
+
+	if _, err := NewStorage(ss.storagePath); err != nil {
+		t.Fatalf("Failed to create storage system: %v", err)
+	}
+	if _, err := os.Stat(tempPath); !os.IsNotExist(err) {
+		t.Fatal("Expected temporary file to be removed at startup")
+	}
+	value, err := os.ReadFile(ss.filePath("testfile"))
+	if err != nil || !bytes.Equal(value, []byte("testdata")) {
+		t.Fatalf("Expected the file to be kept, got %s, %v", value, err)
+	}
+}
+
+func TestRecoverPending(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	ss.Put("renamed", []byte("old"))
+	ss.Put("unrenamed", []byte("old"))
+
+	// a crash after the rename of the value, before the one of its metadata
+	renamed := &storage.File{Key: "renamed", Value: []byte("new")}
+	if err := ss.persistPending(ss.newMeta(renamed)); err != nil {
+		t.Fatalf("Failed to persist pending metadata: %v", err)
+	}
+	if err := ss.persistToDisk("renamed", []byte("new")); err != nil {
+		t.Fatalf("Failed to persist file: %v", err)
+	}
+	// a crash before the rename of the value
+	unrenamed := &storage.File{Key: "unrenamed", Value: []byte("new")}
+	if err := ss.persistPending(ss.newMeta(unrenamed)); err != nil {
+		t.Fatalf("Failed to persist pending metadata: %v", err)
+	}
+
+	restarted, err := NewStorage(ss.storagePath)
+	if err != nil {
+		t.Fatalf("Failed to create storage system: %v", err)
+	}
+	if value, err := restarted.Get("renamed"); err != nil || !bytes.Equal(value, []byte("new")) {
+		t.Fatalf("Expected the new value, got %s, %v", value, err)
+	}
+	if value, err := restarted.Get("unrenamed"); err != nil || !bytes.Equal(value, []byte("old")) {
+		t.Fatalf("Expected the old value, got %s, %v", value, err)
+	}
+	if corrupted, err := restarted.Scrub(); err != nil || len(corrupted) != 0 {
+		t.Fatalf("Expected no corrupted file, got %v, %v", corrupted, err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(ss.storagePath, pendingDirName))
+	if len(entries) != 0 {
+		t.Fatalf("Expected no pending metadata left, got %d", len(entries))
+	}
+}
+
+func TestRebuildIndex(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	version := storage.Version{WallTime: 1, NodeID: "node"}
+	ss.PutFile(&storage.File{Key: "kept", Value: []byte("kept"), Version: version})
+	ss.Put("corrupted", []byte("corrupted"))
+	ss.Put("deleted", []byte("deleted"))
+
+	os.WriteFile(ss.filePath("corrupted"), []byte("garbage"), 0644)
+	os.Remove(ss.filePath("deleted"))
+	os.WriteFile(filepath.Join(ss.storagePath, "Legacy"), []byte("legacy"), 0644)
+
+	restarted, err := NewStorage(ss.storagePath)
+	if err != nil {
+		t.Fatalf("Failed to create storage system: %v", err)
+	}
+
+	file, err := restarted.GetFile("kept")
+	if err != nil || !bytes.Equal(file.Value, []byte("kept")) || file.Version != version {
+		t.Fatalf("Expected kept file with its version, got %v, %v", file, err)
+	}
+	if value, err := restarted.Get("Legacy"); err != nil || !bytes.Equal(value, []byte("legacy")) {
+		t.Fatalf("Expected legacy file to be tracked, got %s, %v", value, err)
+	}
+	if info, err := restarted.Stat("Legacy"); err != nil || info.Checksum != storage.Checksum([]byte("legacy")) {
+		t.Fatalf("Expected legacy file to get metadata, got %v, %v", info, err)
+	}
+	if _, err := os.Stat(restarted.filePath("Legacy")); err != nil {
+		t.Fatalf("Expected legacy file to be moved to its encoded name: %v", err)
+	}
+	// the values are not read at startup, the corrupted file is found by Scrub
+	if quarantined := restarted.Quarantined(); len(quarantined) != 0 {
+		t.Fatalf("Expected empty quarantine at startup, got %v", quarantined)
+	}
+	if corrupted, err := restarted.Scrub(); err != nil || len(corrupted) != 1 || corrupted[0] != "corrupted" {
+		t.Fatalf("Expected [corrupted], got %v, %v", corrupted, err)
+	}
+	if quarantined := restarted.Quarantined(); len(quarantined) != 1 || quarantined[0] != "corrupted" {
+		t.Fatalf("Expected [corrupted] in quarantine, got %v", quarantined)
+	}
+	if _, err := os.Stat(restarted.metaPath("deleted")); !os.IsNotExist(err) {
+		t.Fatal("Expected metadata without file to be removed")
+	}
+}
+
+func TestEncodeKey(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"testfile", "testfile"},
+		{"../../etc/x", "%2e.%2f..%2fetc%2fx"},
+		{"a/b", "a%2fb"},
+		{"File", "%46ile"},
+		{".meta", "%2emeta"},
+		{"100%", "100%25"},
+	}
+	for _, test := range tests {
+		name := encodeKey(test.key)
+		if name != test.expected {
+			t.Errorf("encodeKey(%q) = %q, expected %q", test.key, name, test.expected)
+		}
+		if key, ok := decodeKey(name); !ok || key != test.key {
+			t.Errorf("decodeKey(%q) = %q, %v, expected %q", name, key, ok, test.key)
+		}
+	}
+
+	long := strings.Repeat("k", maxEscapedLength+1)
+	if name := encodeKey(long); !strings.HasPrefix(name, hashedPrefix) {
+		t.Errorf("Expected a hashed name for a long key, got %q", name)
+	}
+	if encodeKey("A") == encodeKey("a") {
+		t.Error("Expected keys differing by case to get different names")
+	}
+}
+
+func TestUnsafeKeys(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	keys := []string{"../escape", "dir/file", "Case", "case", strings.Repeat("long/", 100)}
+	for _, key := range keys {
+		if err := ss.Put(key, []byte(key)); err != nil {
+			t.Fatalf("Failed to put %q: %v", key, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(ss.storagePath, "..", "escape")); !os.IsNotExist(err) {
+		t.Fatal("Expected the key not to escape the storage directory")
+	}
+
+	restarted, err := NewStorage(ss.storagePath)
+	if err != nil {
+		t.Fatalf("Failed to create storage system: %v", err)
+	}
+	for _, key := range keys {
+		value, err := restarted.Get(key)
+		if err != nil || !bytes.Equal(value, []byte(key)) {
+			t.Fatalf("Expected %q after restart, got %s, %v", key, value, err)
+		}
+	}
+
+	if err := ss.Put("", []byte("empty")); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestShardLayout(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	ss.Put("testfile", []byte("testdata"))
+
+	expected := filepath.Join(ss.storagePath, shardOf("testfile"), "testfile")
+	if _, err := os.Stat(expected); err != nil {
+		t.Fatalf("Expected file in its shard directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(ss.storagePath, metaDirName, shardOf("testfile"), "testfile")); err != nil {
+		t.Fatalf("Expected metadata in its shard directory: %v", err)
+	}
+
+	os.Remove(expected)
+	ss.CheckFiles()
+	if _, found := ss.filesname["testfile"]; found {
+		t.Fatal("Expected CheckFiles to untrack the removed file")
+	}
+}
+
+func TestMigrateFlatLayout(t *testing.T) {
+	ss := setupTestStorageSystem(t)
+	defer os.RemoveAll(ss.storagePath)
+
+	// a storage written with the flat layout: storagePath/<name> and storagePath/.meta/<name>
+	version := storage.Version{WallTime: 1, NodeID: "node"}
+	data, _ := json.Marshal(&fileMeta{Version: version})
+	os.MkdirAll(filepath.Join(ss.storagePath, metaDirName), os.ModePerm)
+	os.WriteFile(filepath.Join(ss.storagePath, "flat"), []byte("flat"), 0644)
+	os.WriteFile(filepath.Join(ss.storagePath, metaDirName, "flat"), data, 0644)
+	os.WriteFile(filepath.Join(ss.storagePath, metaDirName, "orphan"), data, 0644)
+
+	migrated, err := NewStorage(ss.storagePath)
+	if err != nil {
+		t.Fatalf("Failed to create storage system: %v", err)
+	}
+
+	file, err := migrated.GetFile("flat")
+	if err != nil || !bytes.Equal(file.Value, []byte("flat")) || file.Version != version {
+		t.Fatalf("Expected migrated file with its version, got %v, %v", file, err)
+	}
+	if _, err := os.Stat(filepath.Join(ss.storagePath, "flat")); !os.IsNotExist(err) {
+		t.Fatal("Expected the flat file to be moved")
+	}
+	if _, err := os.Stat(migrated.filePath("flat")); err != nil {
+		t.Fatalf("Expected the file in its shard directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(ss.storagePath, metaDirName, "orphan")); !os.IsNotExist(err) {
+		t.Fatal("Expected the flat metadata without file to be removed")
+	}
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"hash/maphash"
+)
+
+// The shares of the W-TinyLFU budget: the window takes 1% of it, and the protected segment 80% of the rest.
+const (
+	tinyLFUWindowPercent    = 1
+	tinyLFUProtectedPercent = 80
+)
+
+// tinyLFUCache is a W-TinyLFU cache, sized in bytes.
+// A new value enters a small LRU window. The values leaving the window compete for the main cache,
+// a segmented LRU (probation and protected): the candidate is admitted only if its estimated frequency
+// is higher than the one of the probation victims, so a burst of values used once doesn't flush the cache.
+// The frequencies are estimated by a count-min sketch over the recent uses, hits and misses alike.
+type tinyLFUCache struct {
+	capacity     int64
+	window       *cacheList
+	probation    *cacheList
+	protected    *cacheList
+	windowCap    int64
+	protectedCap int64
+	sketch       *countMinSketch
+	onEvict      func(string)
+}
+
+func newTinyLFUCache(capacity int64, onEvict func(string)) *tinyLFUCache {
+	windowCap := capacity * tinyLFUWindowPercent / 100
+	return &tinyLFUCache{
+		capacity:     capacity,
+		window:       newCacheList(),
+		probation:    newCacheList(),
+		protected:    newCacheList(),
+		windowCap:    windowCap,
+		protectedCap: (capacity - windowCap) * tinyLFUProtectedPercent / 100,
+		sketch:       newCountMinSketch(capacity),
+		onEvict:      onEvict,
+	}
+}
+
+// find gets the cached entry of the key, and the segment keeping it.
+func (c *tinyLFUCache) find(key string) (*cacheEntry, *cacheList) {
+	for _, segment := range []*cacheList{c.window, c.probation, c.protected} {
+		if entry, found := segment.find(key); found {
+			return entry, segment
+		}
+	}
+	return nil, nil
+}
+
+func (c *tinyLFUCache) get(key string) ([]byte, bool) {
+	c.sketch.increment(key)
+	entry, segment := c.find(key)
+	if entry == nil {
+		return nil, false
+	}
+	c.use(entry, segment)
+	return entry.value, true
+}
+
+func (c *tinyLFUCache) peek(key string) ([]byte, bool) {
+	entry, _ := c.find(key)
+	if entry == nil {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// use records a hit: a probation value is promoted to the protected segment,
+// which demotes its least recently used values to probation when it is over its size.
+func (c *tinyLFUCache) use(entry *cacheEntry, segment *cacheList) {
+	if segment != c.probation {
+		segment.touch(entry.key)
+		return
+	}
+	c.probation.remove(entry.key)
+	c.protected.pushFront(entry)
+	for c.protected.size > c.protectedCap && c.protected.len() > 1 {
+		c.probation.pushFront(c.protected.removeBack())
+	}
+}
+
+func (c *tinyLFUCache) add(key string, value []byte) {
+	if entry, segment := c.find(key); entry != nil {
+		segment.set(entry, value)
+		c.use(entry, segment)
+	} else {
+		c.sketch.increment(key)
+		c.window.pushFront(&cacheEntry{key: key, value: value, size: entrySize(key, value)})
+	}
+
+	// the values leaving the window compete for the main cache
+	for c.window.size > c.windowCap {
+		c.admit(c.window.removeBack())
+	}
+	// an update may have grown the main cache over its budget
+	for c.bytes() > c.capacity {
+		c.evict(key)
+	}
+}
+
+// evict evicts the least recently used value of probation, then of protected, except the value of keep.
+func (c *tinyLFUCache) evict(keep string) {
+	for _, segment := range []*cacheList{c.probation, c.protected, c.window} {
+		for element := segment.order.Back(); element != nil; element = element.Prev() {
+			if key := element.Value.(*cacheEntry).key; key != keep {
+				segment.remove(key)
+				c.onEvict(key)
+				return
+			}
+		}
+	}
+}
+
+// admit puts the candidate in probation if it is used more often than the victims it would evict,
+// otherwise the candidate is evicted.
+func (c *tinyLFUCache) admit(candidate *cacheEntry) {
+	mainCap := c.capacity - c.windowCap
+	if candidate.size > mainCap {
+		c.onEvict(candidate.key)
+		return
+	}
+
+	// find the victims first, nothing is evicted if the candidate loses
+	freq := c.sketch.estimate(candidate.key)
+	var victims []*cacheEntry
+	free := mainCap - c.probation.size - c.protected.size
+	for _, segment := range []*cacheList{c.probation, c.protected} {
+		for element := segment.order.Back(); element != nil && free < candidate.size; element = element.Prev() {
+			victim := element.Value.(*cacheEntry)
+			if c.sketch.estimate(victim.key) >= freq {
+				c.onEvict(candidate.key)
+				return
+			}
+			victims = append(victims, victim)
+			free += victim.size
+		}
+	}
+
+	for _, victim := range victims {
+		c.probation.remove(victim.key)
+		c.protected.remove(victim.key)
+		c.onEvict(victim.key)
+	}
+	c.probation.pushFront(candidate)
+}
+
+func (c *tinyLFUCache) remove(key string) {
+	c.window.remove(key)
+	c.probation.remove(key)
+	c.protected.remove(key)
+}
+
+func (c *tinyLFUCache) clear() {
+	c.window.clear()
+	c.probation.clear()
+	c.protected.clear()
+	c.sketch.reset()
+}
+
+func (c *tinyLFUCache) bytes() int64 {
+	return c.window.size + c.probation.size + c.protected.size
+}
+
+func (c *tinyLFUCache) len() int {
+	return c.window.len() + c.probation.len() + c.protected.len()
+}
+
+// The count-min sketch has sketchDepth rows, and a counter saturates at sketchMaxCount.
+// It is sized for the budget filled with values of sketchAverageSize, within [sketchMinWidth, sketchMaxWidth].
+const (
+	sketchDepth       = 4
+	sketchMaxCount    = 15
+	sketchAverageSize = 4 * 1024
+	sketchMinWidth    = 1024
+	sketchMaxWidth    = 1 << 20
+)
+
+// countMinSketch estimates the frequencies of the keys in little memory, an estimate is never lower than
+// the real count. The counters are halved every sampleSize increments, so the old uses fade out.
+type countMinSketch struct {
+	rows       [sketchDepth][]uint8
+	seeds      [sketchDepth]maphash.Seed
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newCountMinSketch(capacity int64) *countMinSketch {
+	width := sketchMinWidth
+	for int64(width)*sketchAverageSize < capacity && width < sketchMaxWidth {
+		width *= 2
+	}
+	sketch := &countMinSketch{mask: uint64(width - 1), sampleSize: 10 * width}
+	for i := range sketch.rows {
+		sketch.rows[i] = make([]uint8, width)
+		sketch.seeds[i] = maphash.MakeSeed()
+	}
+	return sketch
+}
+
+// index returns the position of the key in a row.
+func (sketch *countMinSketch) index(row int, key string) uint64 {
+	return maphash.String(sketch.seeds[row], key) & sketch.mask
+}
+
+// increment counts a use of the key.
+func (sketch *countMinSketch) increment(key string) {
+	for row := range sketch.rows {
+		if i := sketch.index(row, key); sketch.rows[row][i] < sketchMaxCount {
+			sketch.rows[row][i]++
+		}
+	}
+	sketch.additions++
+	if sketch.additions >= sketch.sampleSize {
+		sketch.age()
+	}
+}
+
+// estimate returns the estimated count of the key, the lowest of its counters.
+func (sketch *countMinSketch) estimate(key string) uint8 {
+	count := uint8(sketchMaxCount)
+	for row := range sketch.rows {
+		count = min(count, sketch.rows[row][sketch.index(row, key)])
+	}
+	return count
+}
+
+// age halves all the counters.
+func (sketch *countMinSketch) age() {
+	for row := range sketch.rows {
+		for i := range sketch.rows[row] {
+			sketch.rows[row][i] /= 2
+		}
+	}
+	sketch.additions /= 2
+}
+
+func (sketch *countMinSketch) reset() {
+	for row := range sketch.rows {
+		clear(sketch.rows[row])
+	}
+	sketch.additions = 0
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"math/big"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// The log of the pending transfers is kept in its own directory, out of the files and their shards.
+const (
+	transferDirName  = ".transfers"
+	transferFileName = "transfers.json"
+)
+
+// BeginTransfer starts a transfer of the files in (lo, hi] to the target,
+// they stay in the storage until CommitTransfer.
+func (s *CacheStorageSystem) BeginTransfer(lo, hi *big.Int, target string) (string, storage.FileList, error) {
+	return storage.BeginTransfer(s, s.transfers, lo, hi, target)
+}
+
+// BeginTransferFiles starts a transfer of the files to the target, the ones already in a pending transfer are
+// left out, they stay in the storage until CommitTransfer.
+func (s *CacheStorageSystem) BeginTransferFiles(files storage.FileList, target string) (string, storage.FileList, error) {
+	return s.transfers.Begin(files, target)
+}
+
+// CommitTransfer removes the delivered files of the transfer, unless they changed since it began, and ends it.
+func (s *CacheStorageSystem) CommitTransfer(id string, delivered []string) error {
+	return storage.CommitTransfer(s, s.transfers, id, delivered)
+}
+
+// AbortTransfer ends the transfer, its files are kept.
+func (s *CacheStorageSystem) AbortTransfer(id string) error {
+	return s.transfers.End(id)
+}
+
+// PendingTransfers returns the transfers not committed or aborted yet, including the ones from before a restart.
+func (s *CacheStorageSystem) PendingTransfers() []*storage.Transfer {
+	return s.transfers.Pending()
+}
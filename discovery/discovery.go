@@ -0,0 +1,7 @@
+package discovery
+
+// Discoverer finds the network addresses ("host:port") of live ring members.
+// The result may contain dead or duplicated addresses, the caller should check them before use.
+type Discoverer interface {
+	Discover() ([]string, error)
+}
@@ -0,0 +1,42 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DNSSRV discovers the seeds through DNS SRV records, e.g. _chord._tcp.example.com.
+// The records are returned in the order given by the resolver (priority, then weight).
+type DNSSRV struct {
+	Service string // e.g. "chord", can be empty to look up Name directly
+	Proto   string // e.g. "tcp"
+	Name    string // e.g. "example.com"
+
+	Resolver *net.Resolver // the resolver to use, nil for the default one
+}
+
+func NewDNSSRV(service, proto, name string) *DNSSRV {
+	return &DNSSRV{Service: service, Proto: proto, Name: name}
+}
+
+// Discover looks up the SRV records and returns their targets as "host:port".
+func (dnsSRV *DNSSRV) Discover() ([]string, error) {
+	resolver := dnsSRV.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	_, records, err := resolver.LookupSRV(context.Background(), dnsSRV.Service, dnsSRV.Proto, dnsSRV.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up SRV records: %w", err)
+	}
+
+	addresses := make([]string, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		addresses = append(addresses, net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+	}
+	return addresses, nil
+}
@@ -0,0 +1,111 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// srvRecord is an answer of the fake DNS server.
+type srvRecord struct {
+	priority, weight, port uint16
+	target                 string
+}
+
+// encodeName encodes a domain name as DNS labels.
+func encodeName(name string) []byte {
+	var encoded []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		encoded = append(encoded, byte(len(label)))
+		encoded = append(encoded, label...)
+	}
+	return append(encoded, 0)
+}
+
+// answerSRV builds the answer to the query with the records.
+func answerSRV(query []byte, records []srvRecord) []byte {
+	// the question ends after its name, and its type and class
+	end := 12
+	for query[end] != 0 {
+		end += int(query[end]) + 1
+	}
+	end += 5
+
+	answer := make([]byte, 12, 512)
+	copy(answer, query[:2])                                      // id
+	binary.BigEndian.PutUint16(answer[2:], 0x8180)               // response, recursion desired and available
+	binary.BigEndian.PutUint16(answer[4:], 1)                    // questions
+	binary.BigEndian.PutUint16(answer[6:], uint16(len(records))) // answers
+	answer = append(answer, query[12:end]...)
+	for _, record := range records {
+		target := encodeName(record.target)
+		answer = append(answer, 0xc0, 12) // the name of the question
+		answer = binary.BigEndian.AppendUint16(answer, 33)
+		answer = binary.BigEndian.AppendUint16(answer, 1)
+		answer = binary.BigEndian.AppendUint32(answer, 60)
+		answer = binary.BigEndian.AppendUint16(answer, uint16(6+len(target)))
+		answer = binary.BigEndian.AppendUint16(answer, record.priority)
+		answer = binary.BigEndian.AppendUint16(answer, record.weight)
+		answer = binary.BigEndian.AppendUint16(answer, record.port)
+		answer = append(answer, target...)
+	}
+	return answer
+}
+
+// fakeDNS serves the records to every query, until the end of the test, and returns a resolver using it.
+func fakeDNS(t *testing.T, records []srvRecord) *net.Resolver {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buffer := make([]byte, 512)
+		for {
+			n, src, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(answerSRV(buffer[:n], records), src)
+		}
+	}()
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+}
+
+func TestDNSSRVDiscover(t *testing.T) {
+	resolver := fakeDNS(t, []srvRecord{
+		{priority: 10, weight: 0, port: 8001, target: "node1.example.com."},
+		{priority: 20, weight: 0, port: 8002, target: "node2.example.com."},
+	})
+
+	dnsSRV := NewDNSSRV("chord", "tcp", "example.com")
+	dnsSRV.Resolver = resolver
+	addresses, err := dnsSRV.Discover()
+	if err != nil {
+		t.Fatalf("Failed to discover: %v", err)
+	}
+
+	expected := []string{"node1.example.com:8001", "node2.example.com:8002"}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Fatalf("Expected %v, got %v", expected, addresses)
+	}
+}
+
+func TestDNSSRVDiscoverNoRecord(t *testing.T) {
+	dnsSRV := NewDNSSRV("chord", "tcp", "example.com")
+	dnsSRV.Resolver = fakeDNS(t, nil)
+	if addresses, err := dnsSRV.Discover(); err == nil {
+		t.Fatalf("Expected an error without records, got %v", addresses)
+	}
+}
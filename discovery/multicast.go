@@ -0,0 +1,101 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// probeMessage is sent to the multicast group, every Responder answers it with its own address.
+const probeMessage = "chord-discover"
+
+// maxMessageSize is the maximum size of a probe or an answer.
+const maxMessageSize = 512
+
+// Multicast discovers the ring members on the LAN by sending a probe to a UDP multicast group.
+type Multicast struct {
+	Group   string        // multicast group address, e.g. "239.255.77.77:7777"
+	Timeout time.Duration // how long to wait for answers
+}
+
+func NewMulticast(group string, timeout time.Duration) *Multicast {
+	return &Multicast{Group: group, Timeout: timeout}
+}
+
+// Discover sends one probe and collects the answers until the timeout.
+func (multicast *Multicast) Discover() ([]string, error) {
+	groupAddr, err := net.ResolveUDPAddr("udp", multicast.Group)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving multicast group: %w", err)
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error listening: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.WriteToUDP([]byte(probeMessage), groupAddr); err != nil {
+		return nil, fmt.Errorf("error sending probe: %w", err)
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(multicast.Timeout)); err != nil {
+		return nil, fmt.Errorf("error setting deadline: %w", err)
+	}
+
+	var addresses []string
+	buffer := make([]byte, maxMessageSize)
+	for {
+		n, _, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			// the deadline is reached, we have collected all the answers we can get
+			break
+		}
+		address := string(buffer[:n])
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			continue
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// Responder answers the probes sent to a multicast group with the advertised address.
+type Responder struct {
+	conn      *net.UDPConn
+	advertise string
+}
+
+// NewResponder joins the multicast group, advertise is the "host:port" of the local node.
+func NewResponder(group string, advertise string) (*Responder, error) {
+	groupAddr, err := net.ResolveUDPAddr("udp", group)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving multicast group: %w", err)
+	}
+	conn, err := net.ListenMulticastUDP("udp", nil, groupAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error joining multicast group: %w", err)
+	}
+	return &Responder{conn: conn, advertise: advertise}, nil
+}
+
+// Serve answers the probes until the responder is closed.
+func (responder *Responder) Serve() {
+	buffer := make([]byte, maxMessageSize)
+	for {
+		n, src, err := responder.conn.ReadFromUDP(buffer)
+		if err != nil {
+			// the connection is closed
+			return
+		}
+		if string(buffer[:n]) != probeMessage {
+			continue
+		}
+		_, _ = responder.conn.WriteToUDP([]byte(responder.advertise), src)
+	}
+}
+
+// Close leaves the multicast group and stops Serve.
+func (responder *Responder) Close() error {
+	return responder.conn.Close()
+}
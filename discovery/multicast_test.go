@@ -0,0 +1,64 @@
+package discovery
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// multicastGroup returns a multicast group on a free port.
+func multicastGroup(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	return net.JoinHostPort("239.255.77.77", strconv.Itoa(port))
+}
+
+func TestMulticastDiscover(t *testing.T) {
+	group := multicastGroup(t)
+	var expected []string
+	for _, advertise := range []string{"127.0.0.1:8001", "[::1]:8002"} {
+		responder, err := NewResponder(group, advertise)
+		if err != nil {
+			t.Skipf("Multicast is not available: %v", err)
+		}
+		defer responder.Close()
+		go responder.Serve()
+		expected = append(expected, advertise)
+	}
+
+	addresses, err := NewMulticast(group, 500*time.Millisecond).Discover()
+	if err != nil {
+		t.Fatalf("Failed to discover: %v", err)
+	}
+	if len(addresses) == 0 {
+		t.Skip("Multicast loopback is not available")
+	}
+	if len(addresses) == 2 && addresses[0] != expected[0] {
+		addresses[0], addresses[1] = addresses[1], addresses[0]
+	}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Fatalf("Expected %v, got %v", expected, addresses)
+	}
+}
+
+func TestMulticastDiscoverIgnoresInvalidAnswers(t *testing.T) {
+	group := multicastGroup(t)
+	responder, err := NewResponder(group, "not an address")
+	if err != nil {
+		t.Skipf("Multicast is not available: %v", err)
+	}
+	defer responder.Close()
+	go responder.Serve()
+
+	addresses, err := NewMulticast(group, 200*time.Millisecond).Discover()
+	if err != nil || len(addresses) != 0 {
+		t.Fatalf("Expected no address, got %v, %v", addresses, err)
+	}
+}
@@ -0,0 +1,45 @@
+package discovery
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// StaticFile discovers the seeds listed in a file, one "host:port" per line.
+// Blank lines and lines starting with '#' are ignored.
+type StaticFile struct {
+	Path string
+}
+
+func NewStaticFile(path string) *StaticFile {
+	return &StaticFile{Path: path}
+}
+
+// Discover reads the file and returns the addresses in it, in order.
+func (staticFile *StaticFile) Discover() ([]string, error) {
+	file, err := os.Open(staticFile.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening seed file: %w", err)
+	}
+	defer file.Close()
+
+	var addresses []string
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(line); err != nil {
+			return nil, fmt.Errorf("invalid address at line %d: %w", lineNumber, err)
+		}
+		addresses = append(addresses, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading seed file: %w", err)
+	}
+	return addresses, nil
+}
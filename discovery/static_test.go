@@ -0,0 +1,37 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStaticFileDiscover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seeds")
+	content := "# seeds\n127.0.0.1:8001\n\n  127.0.0.1:8002  \n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write seed file: %v", err)
+	}
+
+	addresses, err := NewStaticFile(path).Discover()
+	if err != nil {
+		t.Fatalf("Failed to discover: %v", err)
+	}
+
+	expected := []string{"127.0.0.1:8001", "127.0.0.1:8002"}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Fatalf("Expected %v, got %v", expected, addresses)
+	}
+}
+
+func TestStaticFileDiscoverInvalidAddress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seeds")
+	if err := os.WriteFile(path, []byte("127.0.0.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write seed file: %v", err)
+	}
+
+	if _, err := NewStaticFile(path).Discover(); err == nil {
+		t.Fatal("Expected an error for an address without port")
+	}
+}
@@ -0,0 +1,94 @@
+package erasure
+
+import "fmt"
+
+// matrix is a matrix over GF(2^8), row major.
+type matrix [][]byte
+
+func newMatrix(rows, cols int) matrix {
+	m := make(matrix, rows)
+	for r := range m {
+		m[r] = make([]byte, cols)
+	}
+	return m
+}
+
+func identityMatrix(size int) matrix {
+	m := newMatrix(size, size)
+	for i := range m {
+		m[i][i] = 1
+	}
+	return m
+}
+
+// vandermonde returns the rows x cols matrix whose element (r, c) is r^c,
+// any cols rows of it are linearly independent.
+func vandermonde(rows, cols int) matrix {
+	m := newMatrix(rows, cols)
+	for r := range m {
+		for c := range m[r] {
+			m[r][c] = galExp(byte(r), c)
+		}
+	}
+	return m
+}
+
+func (m matrix) multiply(right matrix) matrix {
+	result := newMatrix(len(m), len(right[0]))
+	for r := range result {
+		for c := range result[r] {
+			var value byte
+			for i := range right {
+				value ^= galMul(m[r][i], right[i][c])
+			}
+			result[r][c] = value
+		}
+	}
+	return result
+}
+
+// invert returns the inverse of the square matrix with Gauss-Jordan elimination.
+func (m matrix) invert() (matrix, error) {
+	size := len(m)
+	work := newMatrix(size, 2*size)
+	for r := range m {
+		copy(work[r], m[r])
+		work[r][size+r] = 1
+	}
+
+	for c := 0; c < size; c++ {
+		// find a row with a non-zero pivot, and swap it into place
+		pivot := c
+		for pivot < size && work[pivot][c] == 0 {
+			pivot++
+		}
+		if pivot == size {
+			return nil, fmt.Errorf("matrix is singular")
+		}
+		work[c], work[pivot] = work[pivot], work[c]
+
+		// scale the pivot row to make the pivot 1
+		if scale := work[c][c]; scale != 1 {
+			for i := range work[c] {
+				work[c][i] = galDiv(work[c][i], scale)
+			}
+		}
+
+		// eliminate the column from the other rows
+		for r := 0; r < size; r++ {
+			if r == c || work[r][c] == 0 {
+				continue
+			}
+			factor := work[r][c]
+			for i := range work[r] {
+				work[r][i] ^= galMul(factor, work[c][i])
+			}
+		}
+	}
+
+	inverse := newMatrix(size, size)
+	for r := range inverse {
+		copy(inverse[r], work[r][size:])
+	}
+	return inverse, nil
+}
@@ -0,0 +1,172 @@
+package erasure
+
+import (
+	"fmt"
+)
+
+// Encoder is a systematic Reed-Solomon encoder:
+// the data is split into dataShards shards, and parityShards parity shards are computed from them.
+// Any dataShards of the dataShards+parityShards shards are enough to reconstruct the data.
+type Encoder struct {
+	dataShards   int
+	parityShards int
+	matrix       matrix // (dataShards+parityShards) x dataShards, the top dataShards rows are the identity
+}
+
+// New creates an Encoder, dataShards+parityShards should be at most 256.
+func New(dataShards, parityShards int) (*Encoder, error) {
+	if dataShards < 1 || parityShards < 0 {
+		return nil, fmt.Errorf("invalid number of shards: %d data, %d parity", dataShards, parityShards)
+	}
+	if dataShards+parityShards > 256 {
+		return nil, fmt.Errorf("too many shards: %d", dataShards+parityShards)
+	}
+
+	// turn the vandermonde matrix into a systematic one, so the data shards are kept as they are
+	v := vandermonde(dataShards+parityShards, dataShards)
+	top, err := matrix(v[:dataShards]).invert()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encoder{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		matrix:       v.multiply(top),
+	}, nil
+}
+
+// DataShards returns the number of data shards.
+func (encoder *Encoder) DataShards() int {
+	return encoder.dataShards
+}
+
+// TotalShards returns the number of data and parity shards.
+func (encoder *Encoder) TotalShards() int {
+	return encoder.dataShards + encoder.parityShards
+}
+
+// Split splits the data into dataShards equally sized data shards (the last one is padded with zeros),
+// and allocates the empty parity shards.
+func (encoder *Encoder) Split(data []byte) [][]byte {
+	shardSize := (len(data) + encoder.dataShards - 1) / encoder.dataShards
+	if shardSize == 0 {
+		shardSize = 1
+	}
+
+	padded := make([]byte, shardSize*encoder.TotalShards())
+	copy(padded, data)
+
+	shards := make([][]byte, encoder.TotalShards())
+	for i := range shards {
+		shards[i] = padded[i*shardSize : (i+1)*shardSize]
+	}
+	return shards
+}
+
+// Encode computes the parity shards from the data shards.
+func (encoder *Encoder) Encode(shards [][]byte) error {
+	if err := encoder.checkShards(shards, false); err != nil {
+		return err
+	}
+	for i := encoder.dataShards; i < encoder.TotalShards(); i++ {
+		encoder.codeShard(encoder.matrix[i], shards[:encoder.dataShards], shards[i])
+	}
+	return nil
+}
+
+// Reconstruct fills the missing (nil) shards, at least dataShards shards should be present.
+func (encoder *Encoder) Reconstruct(shards [][]byte) error {
+	if err := encoder.checkShards(shards, true); err != nil {
+		return err
+	}
+
+	// pick the first dataShards present shards, and the rows of the matrix that produced them
+	var rows matrix
+	var present [][]byte
+	for i, shard := range shards {
+		if shard != nil && len(rows) < encoder.dataShards {
+			rows = append(rows, encoder.matrix[i])
+			present = append(present, shard)
+		}
+	}
+	if len(rows) < encoder.dataShards {
+		return fmt.Errorf("too few shards to reconstruct: %d of %d", len(rows), encoder.dataShards)
+	}
+
+	// rows * data = present, so data = rows^-1 * present
+	decode, err := rows.invert()
+	if err != nil {
+		return err
+	}
+	shardSize := len(present[0])
+	for i := 0; i < encoder.dataShards; i++ {
+		if shards[i] == nil {
+			shards[i] = make([]byte, shardSize)
+			encoder.codeShard(decode[i], present, shards[i])
+		}
+	}
+
+	// then the missing parity shards are computed from the data shards again
+	for i := encoder.dataShards; i < encoder.TotalShards(); i++ {
+		if shards[i] == nil {
+			shards[i] = make([]byte, shardSize)
+			encoder.codeShard(encoder.matrix[i], shards[:encoder.dataShards], shards[i])
+		}
+	}
+	return nil
+}
+
+// Join concatenates the data shards and cuts the result to size.
+func (encoder *Encoder) Join(shards [][]byte, size int) ([]byte, error) {
+	data := make([]byte, 0, size)
+	for i := 0; i < encoder.dataShards && len(data) < size; i++ {
+		if shards[i] == nil {
+			return nil, fmt.Errorf("data shard %d is missing", i)
+		}
+		data = append(data, shards[i]...)
+	}
+	if len(data) < size {
+		return nil, fmt.Errorf("too few data: %d of %d bytes", len(data), size)
+	}
+	return data[:size], nil
+}
+
+// codeShard computes output = sum(coefficients[i] * inputs[i]).
+func (encoder *Encoder) codeShard(coefficients []byte, inputs [][]byte, output []byte) {
+	for i := range output {
+		output[i] = 0
+	}
+	for i, input := range inputs {
+		coefficient := coefficients[i]
+		if coefficient == 0 {
+			continue
+		}
+		for j := range output {
+			output[j] ^= galMul(coefficient, input[j])
+		}
+	}
+}
+
+// checkShards checks the number of shards and that all the present shards have the same size.
+func (encoder *Encoder) checkShards(shards [][]byte, allowMissing bool) error {
+	if len(shards) != encoder.TotalShards() {
+		return fmt.Errorf("wrong number of shards: %d, expected %d", len(shards), encoder.TotalShards())
+	}
+	shardSize := -1
+	for i, shard := range shards {
+		if shard == nil {
+			if !allowMissing {
+				return fmt.Errorf("shard %d is missing", i)
+			}
+			continue
+		}
+		if shardSize == -1 {
+			shardSize = len(shard)
+		}
+		if len(shard) != shardSize || shardSize == 0 {
+			return fmt.Errorf("shard %d has a wrong size", i)
+		}
+	}
+	return nil
+}
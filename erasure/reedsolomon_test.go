@@ -0,0 +1,84 @@
+package erasure
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeReconstruct(t *testing.T) {
+	encoder, err := New(4, 2)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	shards := encoder.Split(data)
+	if err := encoder.Encode(shards); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	// lose one data shard and one parity shard
+	expected := append([]byte(nil), shards[1]...)
+	shards[1] = nil
+	shards[5] = nil
+
+	if err := encoder.Reconstruct(shards); err != nil {
+		t.Fatalf("Failed to reconstruct: %v", err)
+	}
+	if !bytes.Equal(shards[1], expected) {
+		t.Fatalf("Expected %v, got %v", expected, shards[1])
+	}
+
+	result, err := encoder.Join(shards, len(data))
+	if err != nil {
+		t.Fatalf("Failed to join: %v", err)
+	}
+	if !bytes.Equal(result, data) {
+		t.Fatalf("Expected %s, got %s", data, result)
+	}
+}
+
+func TestReconstructFromParityOnly(t *testing.T) {
+	encoder, err := New(2, 2)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	data := []byte("testdata")
+	shards := encoder.Split(data)
+	if err := encoder.Encode(shards); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	shards[0] = nil
+	shards[1] = nil
+	if err := encoder.Reconstruct(shards); err != nil {
+		t.Fatalf("Failed to reconstruct: %v", err)
+	}
+
+	result, err := encoder.Join(shards, len(data))
+	if err != nil {
+		t.Fatalf("Failed to join: %v", err)
+	}
+	if !bytes.Equal(result, data) {
+		t.Fatalf("Expected %s, got %s", data, result)
+	}
+}
+
+func TestReconstructTooFewShards(t *testing.T) {
+	encoder, err := New(3, 1)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	shards := encoder.Split([]byte("testdata"))
+	if err := encoder.Encode(shards); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	shards[0] = nil
+	shards[2] = nil
+	if err := encoder.Reconstruct(shards); err == nil {
+		t.Fatal("Expected an error with too few shards")
+	}
+}
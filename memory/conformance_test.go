@@ -0,0 +1,19 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/chord-dht/chord-core/storage"
+	"github.com/chord-dht/chord-core/storagetest"
+)
+
+// corrupt flips the first byte of the value of the file.
+func corrupt(s storage.Storage, fileKey string) error {
+	ss := s.(*MemoryStorage)
+	ss.items[fileKey].value[0] ^= 0xff
+	return nil
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.RunWithOptions(t, MemoryStorageFactory, storagetest.Options{Corrupt: corrupt})
+}
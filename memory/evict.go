@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"fmt"
+	"time"
+)
+
+// The eviction policies, used when a write doesn't fit in the memory cap.
+const (
+	EvictionNone = "none" // the write is rejected with ErrFull
+	EvictionLRU  = "lru"  // the least recently used files are evicted, reads and writes count as uses
+	EvictionFIFO = "fifo" // the oldest written files are evicted, reads don't count
+)
+
+// validPolicy checks if the eviction policy is known.
+func validPolicy(policy string) bool {
+	return policy == EvictionNone || policy == EvictionLRU || policy == EvictionFIFO
+}
+
+// itemSize is the memory accounted for a file, its key and its value.
+func itemSize(fileKey string, value []byte) int64 {
+	return int64(len(fileKey) + len(value))
+}
+
+// touch records a read of the item, only LRU reorders on reads.
+func (s *MemoryStorage) touch(it *item) {
+	if s.policy == EvictionLRU {
+		s.order.MoveToFront(it.element)
+	}
+}
+
+// makeRoom frees the memory for needed more bytes, the item of keep (being overwritten) is never evicted.
+// The expired files are dropped first, then the files are evicted by the policy.
+// With EvictionNone, ErrFull is returned if the room can't be made.
+func (s *MemoryStorage) makeRoom(needed int64, keep string) error {
+	if s.maxBytes <= 0 || s.used+needed <= s.maxBytes {
+		return nil
+	}
+
+	s.removeExpired(time.Now(), keep)
+	if s.used+needed <= s.maxBytes {
+		return nil
+	}
+	if s.policy == EvictionNone {
+		return fmt.Errorf("%w: %d of %d bytes used", ErrFull, s.used, s.maxBytes)
+	}
+
+	// the caller checks that the file alone fits in the cap, so evicting the others always makes the room
+	for element := s.order.Back(); element != nil && s.used+needed > s.maxBytes; {
+		prev := element.Prev()
+		if fileKey := element.Value.(string); fileKey != keep {
+			s.remove(fileKey)
+			s.evicted++
+		}
+		element = prev
+	}
+	return nil
+}
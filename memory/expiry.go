@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiryHeap keeps the items with an ExpireAt, the next to expire on top,
+// so the expired files are found without going through all the files.
+type expiryHeap []*item
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].info.ExpireAt.Before(h[j].info.ExpireAt) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].expiry = i
+	h[j].expiry = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	it := x.(*item)
+	it.expiry = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	it.expiry = -1
+	return it
+}
+
+// trackExpiry adds the item to the expiry heap if it has an ExpireAt.
+func (s *MemoryStorage) trackExpiry(it *item) {
+	it.expiry = -1
+	if !it.info.ExpireAt.IsZero() {
+		heap.Push(&s.expiries, it)
+	}
+}
+
+// untrackExpiry removes the item from the expiry heap.
+func (s *MemoryStorage) untrackExpiry(it *item) {
+	if it.expiry >= 0 {
+		heap.Remove(&s.expiries, it.expiry)
+	}
+}
+
+// removeExpired removes the files expired at now, except keep (being overwritten), and returns their keys.
+func (s *MemoryStorage) removeExpired(now time.Time, keep string) []string {
+	var removed []string
+	var kept *item
+	for len(s.expiries) > 0 && s.expiries[0].expired(now) {
+		it := heap.Pop(&s.expiries).(*item)
+		if it.info.Key == keep {
+			kept = it
+			continue
+		}
+		s.remove(it.info.Key)
+		removed = append(removed, it.info.Key)
+	}
+	if kept != nil {
+		heap.Push(&s.expiries, kept)
+	}
+	return removed
+}
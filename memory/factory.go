@@ -0,0 +1,24 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// MemoryStorageFactory is an implementation of StorageFactory using NewStorage, the path is ignored.
+func MemoryStorageFactory(path string) (storage.Storage, error) {
+	return NewStorage(), nil
+}
+
+// CappedMemoryStorageFactory returns an implementation of StorageFactory using NewStorageWithSetting,
+// every storage created by it gets its own memory cap.
+func CappedMemoryStorageFactory(maxBytes int64, policy string) func(string) (storage.Storage, error) {
+	return func(path string) (storage.Storage, error) {
+		storage, err := NewStorageWithSetting(maxBytes, policy)
+		if err != nil {
+			return nil, fmt.Errorf("error creating storage for %s: %w", path, err)
+		}
+		return storage, nil
+	}
+}
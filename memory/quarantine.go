@@ -0,0 +1,35 @@
+package memory
+
+import "github.com/chord-dht/chord-core/storage"
+
+// quarantine drops the corrupted file, the key is listed in the quarantine until it is stored again.
+func (s *MemoryStorage) quarantine(fileKey string) {
+	s.remove(fileKey)
+	s.quarantined[fileKey] = struct{}{}
+}
+
+// Scrub verifies every file, the corrupted files are quarantined and their keys are returned.
+func (s *MemoryStorage) Scrub() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var corrupted []string
+	for _, it := range s.items {
+		if _, err := s.readFile(it); storage.IsCorrupted(err) {
+			corrupted = append(corrupted, it.info.Key)
+		}
+	}
+	return corrupted, nil
+}
+
+// Quarantined lists the keys of the quarantined files.
+func (s *MemoryStorage) Quarantined() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.quarantined))
+	for key := range s.quarantined {
+		keys = append(keys, key)
+	}
+	return keys
+}
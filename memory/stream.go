@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// keys returns the keys of the files that satisfy the filter, the callbacks of the iterations run on them
+// without the lock.
+func (s *MemoryStorage) keys(filter func(string) bool) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	now := time.Now()
+	for fileKey, it := range s.items {
+		if !it.expired(now) && filter(fileKey) {
+			keys = append(keys, fileKey)
+		}
+	}
+	return keys
+}
+
+// ForEachKey calls fn with the key of every file that satisfies the filter.
+func (s *MemoryStorage) ForEachKey(filter func(string) bool, fn func(fileKey string) error) error {
+	for _, fileKey := range s.keys(filter) {
+		if err := fn(fileKey); err != nil {
+			if errors.Is(err, storage.ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachFile calls fn with the metadata and a reader of the value of every file that satisfies the filter.
+// It doesn't count as a use for the eviction.
+func (s *MemoryStorage) ForEachFile(filter func(string) bool, fn func(info *storage.FileInfo, value io.Reader) error) error {
+	for _, fileKey := range s.keys(filter) {
+		file, info, err := s.readFileInfo(fileKey, false)
+		if err != nil {
+			continue
+		}
+		if err := fn(info, bytes.NewReader(file.Value)); err != nil {
+			if storage.IsCorrupted(err) {
+				continue
+			}
+			if errors.Is(err, storage.ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readFileInfo reads the file with its metadata, touch tells if it counts as a use for the eviction.
+func (s *MemoryStorage) readFileInfo(fileKey string, touch bool) (*storage.File, *storage.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, found := s.lookup(fileKey)
+	if !found {
+		return nil, nil, fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	if touch {
+		s.touch(it)
+	}
+	file, err := s.readFile(it)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := it.info
+	return file, &info, nil
+}
+
+// GetStream writes the value of the file to the writer, and returns its metadata.
+func (s *MemoryStorage) GetStream(fileKey string, w io.Writer) (*storage.FileInfo, error) {
+	file, info, err := s.readFileInfo(fileKey, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(file.Value); err != nil {
+		return nil, fmt.Errorf("error writing value of %s: %w", fileKey, err)
+	}
+	return info, nil
+}
+
+// PutStream stores the file with the value read from the reader.
+func (s *MemoryStorage) PutStream(file *storage.File, value io.Reader) error {
+	read, err := storage.ReadFile(file, value)
+	if err != nil {
+		return err
+	}
+	return s.PutFile(read)
+}
@@ -0,0 +1,481 @@
+package memory
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// ErrFull is returned when a write doesn't fit in the memory cap, and the eviction policy can't make room for it.
+var ErrFull = errors.New("memory storage full")
+
+// MemoryStorage is a storage keeping all the files in memory, nothing is written to disk.
+// It suits unit tests and ephemeral caches. With a memory cap, the files are evicted by the eviction policy
+// when a write doesn't fit: an evicted file is lost, so a capped storage should only hold files that can be
+// fetched again, e.g. replicas.
+type MemoryStorage struct {
+	items    map[string]*item  // The files by key
+	ring     *storage.KeyIndex // The keys sorted by identifier, for GetRange and ExtractRange
+	order    *list.List        // The keys in eviction order, the front is the most recently used (LRU) or written (FIFO)
+	expiries expiryHeap        // The items with an ExpireAt, the next to expire first
+	maxBytes int64             // The memory cap on the keys and values, 0 means no cap
+	used     int64             // The memory used by the keys and values
+	policy   string            // The eviction policy, EvictionNone, EvictionLRU or EvictionFIFO
+	evicted  int               // The number of evicted files
+
+	quarantined map[string]struct{}  // The keys of the corrupted files, until they are stored again
+	transfers   *storage.TransferLog // Pending transfers of the files, see BeginTransfer
+
+	mu sync.Mutex // Mutex to ensure thread safety
+}
+
+// item is a stored file with its metadata and its place in the eviction order.
+type item struct {
+	value   []byte
+	info    storage.FileInfo
+	size    int64
+	element *list.Element
+	expiry  int // The index of the item in the expiry heap, -1 if it is not there
+}
+
+// expired checks if the file has expired at now.
+func (it *item) expired(now time.Time) bool {
+	return !it.info.ExpireAt.IsZero() && !now.Before(it.info.ExpireAt)
+}
+
+// file builds the file of the item, with a copy of the value.
+func (it *item) file() *storage.File {
+	return &storage.File{
+		Key:      it.info.Key,
+		Value:    append([]byte(nil), it.value...),
+		Version:  it.info.Version,
+		ExpireAt: it.info.ExpireAt,
+		Owner:    it.info.Owner,
+		Checksum: it.info.Checksum,
+	}
+}
+
+// NewStorage creates a new MemoryStorage without memory cap.
+func NewStorage() *MemoryStorage {
+	storage, _ := NewStorageWithSetting(0, EvictionNone)
+	return storage
+}
+
+// NewStorageWithSetting creates a new MemoryStorage with a memory cap (in bytes of keys and values,
+// 0 means no cap) and the eviction policy used when a write doesn't fit in it.
+func NewStorageWithSetting(maxBytes int64, policy string) (*MemoryStorage, error) {
+	if maxBytes < 0 {
+		return nil, fmt.Errorf("invalid memory cap: %d", maxBytes)
+	}
+	if !validPolicy(policy) {
+		return nil, fmt.Errorf("unknown eviction policy: %s", policy)
+	}
+	transfers, _ := storage.OpenTransferLog("") // an in-memory log can't fail
+	return &MemoryStorage{
+		items:       make(map[string]*item),
+		ring:        storage.NewKeyIndex(),
+		order:       list.New(),
+		maxBytes:    maxBytes,
+		policy:      policy,
+		quarantined: make(map[string]struct{}),
+		transfers:   transfers,
+	}, nil
+}
+
+// Used returns the memory used by the keys and values, and the memory cap (0 means no cap).
+func (s *MemoryStorage) Used() (int64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.used, s.maxBytes
+}
+
+// Evicted returns the number of files evicted to make room for the writes.
+func (s *MemoryStorage) Evicted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.evicted
+}
+
+// lookup finds the item of a file which is not expired.
+func (s *MemoryStorage) lookup(fileKey string) (*item, bool) {
+	it, found := s.items[fileKey]
+	if !found || it.expired(time.Now()) {
+		return nil, false
+	}
+	return it, true
+}
+
+// validate checks if the file can be stored: its key is not empty, its checksum is right,
+// and it fits in the memory cap alone.
+func (s *MemoryStorage) validate(file *storage.File) error {
+	if file.Key == "" {
+		return fmt.Errorf("%w: empty key", storage.ErrInvalidKey)
+	}
+	if err := file.Verify(); err != nil {
+		return err
+	}
+	if s.maxBytes > 0 && itemSize(file.Key, file.Value) > s.maxBytes {
+		return fmt.Errorf("%w: %s is larger than the memory cap", ErrFull, file.Key)
+	}
+	return nil
+}
+
+// putFile stores a copy of the file, making room for it if the storage is capped.
+// A file failing validate is rejected, and a quarantined copy of the file is dropped.
+func (s *MemoryStorage) putFile(file *storage.File) error {
+	if err := s.validate(file); err != nil {
+		return err
+	}
+
+	size := itemSize(file.Key, file.Value)
+	needed := size
+	old, exists := s.items[file.Key]
+	if exists {
+		needed -= old.size
+	}
+	if err := s.makeRoom(needed, file.Key); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	info := storage.FileInfo{
+		Key:         file.Key,
+		Size:        int64(len(file.Value)),
+		Checksum:    storage.Checksum(file.Value),
+		ContentType: storage.ContentType(file.Key, file.Value),
+		CreatedAt:   now,
+		ModifiedAt:  now,
+		Owner:       file.Owner,
+		Version:     file.Version,
+		ExpireAt:    file.ExpireAt,
+	}
+	if current, found := s.lookup(file.Key); found {
+		info.CreatedAt = current.info.CreatedAt
+	}
+	if exists {
+		s.remove(file.Key)
+	}
+
+	it := &item{value: append([]byte(nil), file.Value...), info: info, size: size}
+	it.element = s.order.PushFront(file.Key)
+	s.trackExpiry(it)
+	s.items[file.Key] = it
+	s.ring.Add(file.Key)
+	s.used += size
+	delete(s.quarantined, file.Key)
+	return nil
+}
+
+// putFiles stores the files, a list with an invalid file is rejected as a whole.
+// With EvictionNone, the files before the one which doesn't fit are kept.
+func (s *MemoryStorage) putFiles(files storage.FileList) error {
+	for _, file := range files {
+		if err := s.validate(file); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		if err := s.putFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove drops the file from the storage.
+func (s *MemoryStorage) remove(fileKey string) {
+	it, found := s.items[fileKey]
+	if !found {
+		return
+	}
+	s.order.Remove(it.element)
+	s.untrackExpiry(it)
+	delete(s.items, fileKey)
+	s.ring.Remove(fileKey)
+	s.used -= it.size
+}
+
+// readFile reads the file and verifies it against its checksum.
+// A corrupted file is quarantined and ErrCorrupted is returned.
+func (s *MemoryStorage) readFile(it *item) (*storage.File, error) {
+	file := it.file()
+	if storage.Checksum(file.Value) != it.info.Checksum {
+		s.quarantine(it.info.Key)
+		return nil, fmt.Errorf("%w: %s", storage.ErrCorrupted, it.info.Key)
+	}
+	return file, nil
+}
+
+// CheckFiles does nothing, the files can't disappear behind the storage's back.
+func (s *MemoryStorage) CheckFiles() {}
+
+func (s *MemoryStorage) GetFilesName() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.items))
+	for key, it := range s.items {
+		if it.expired(now) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Get retrieves the value associated with the given fileKey.
+func (s *MemoryStorage) Get(fileKey string) ([]byte, error) {
+	file, err := s.GetFile(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return file.Value, nil
+}
+
+// GetFile retrieves the file associated with the given fileKey, with its version.
+func (s *MemoryStorage) GetFile(fileKey string) (*storage.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, found := s.lookup(fileKey)
+	if !found {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	s.touch(it)
+	return s.readFile(it)
+}
+
+// Stat returns the metadata of the file, without reading its value.
+func (s *MemoryStorage) Stat(fileKey string) (*storage.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, found := s.lookup(fileKey)
+	if !found {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	info := it.info
+	return &info, nil
+}
+
+// Put stores the value associated with the given fileKey, with the zero version.
+func (s *MemoryStorage) Put(fileKey string, value []byte) error {
+	return s.PutFile(&storage.File{Key: fileKey, Value: value})
+}
+
+// PutFile stores the file together with its version and expiry time.
+func (s *MemoryStorage) PutFile(file *storage.File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.putFile(file)
+}
+
+// PutWithTTL stores the value associated with the given fileKey, with the zero version,
+// the file expires after ttl.
+func (s *MemoryStorage) PutWithTTL(fileKey string, value []byte, ttl time.Duration) error {
+	return s.PutFile(&storage.File{Key: fileKey, Value: value, ExpireAt: time.Now().Add(ttl)})
+}
+
+// Update updates the value associated with the given fileKey, with the zero version.
+func (s *MemoryStorage) Update(fileKey string, newValue []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.lookup(fileKey); !found {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	return s.putFile(&storage.File{Key: fileKey, Value: newValue})
+}
+
+// Delete removes the file associated with the given fileKey.
+func (s *MemoryStorage) Delete(fileKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.items[fileKey]; !found {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	s.remove(fileKey)
+	return nil
+}
+
+// PutIfAbsent stores the file only if the fileKey is not in the storage yet.
+func (s *MemoryStorage) PutIfAbsent(file *storage.File) (storage.Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if it, found := s.lookup(file.Key); found {
+		return it.info.Version, fmt.Errorf("%w: %s", storage.ErrExists, file.Key)
+	}
+	if err := s.putFile(file); err != nil {
+		return storage.Version{}, err
+	}
+	return file.Version, nil
+}
+
+// CompareAndSwap stores the file only if the current version of the fileKey is the expected one.
+func (s *MemoryStorage) CompareAndSwap(file *storage.File, expected storage.Version) (storage.Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, found := s.lookup(file.Key)
+	if !found {
+		return storage.Version{}, fmt.Errorf("%w: %s", storage.ErrNotFound, file.Key)
+	}
+	if it.info.Version != expected {
+		return it.info.Version, fmt.Errorf("%w: %s", storage.ErrVersionMismatch, file.Key)
+	}
+	version := it.info.Version
+	if err := s.putFile(file); err != nil {
+		return version, err
+	}
+	return file.Version, nil
+}
+
+// DeleteIfVersion removes the file only if its current version is the expected one.
+func (s *MemoryStorage) DeleteIfVersion(fileKey string, expected storage.Version) (storage.Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, found := s.lookup(fileKey)
+	if !found {
+		return storage.Version{}, fmt.Errorf("%w: %s", storage.ErrNotFound, fileKey)
+	}
+	if it.info.Version != expected {
+		return it.info.Version, fmt.Errorf("%w: %s", storage.ErrVersionMismatch, fileKey)
+	}
+	s.remove(fileKey)
+	return storage.Version{}, nil
+}
+
+// GetFilesByFilter gets the files that satisfy the filter, the corrupted files are quarantined and skipped.
+// It doesn't count as a use for the eviction.
+func (s *MemoryStorage) GetFilesByFilter(filter func(string) bool) (storage.FileList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.filesByFilter(filter), nil
+}
+
+// GetRange gets the files with an identifier in (lo, hi], the corrupted files are quarantined and skipped.
+func (s *MemoryStorage) GetRange(lo, hi *big.Int) (storage.FileList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.readFiles(s.ring.Range(lo, hi)), nil
+}
+
+// filesByFilter reads the files that satisfy the filter.
+func (s *MemoryStorage) filesByFilter(filter func(string) bool) storage.FileList {
+	var keys []string
+	for fileKey := range s.items {
+		if filter(fileKey) {
+			keys = append(keys, fileKey)
+		}
+	}
+	return s.readFiles(keys)
+}
+
+// readFiles reads the files of the keys, the expired and missing ones are skipped.
+func (s *MemoryStorage) readFiles(keys []string) storage.FileList {
+	var files storage.FileList
+	now := time.Now()
+	for _, fileKey := range keys {
+		it, found := s.items[fileKey]
+		if !found || it.expired(now) {
+			continue
+		}
+		if file, err := s.readFile(it); err == nil {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// PutFiles stores the given files.
+func (s *MemoryStorage) PutFiles(files storage.FileList) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.putFiles(files)
+}
+
+// PutFilesIfNewer stores the given files, except those the storage has a newer version of.
+// The list is validated as a whole first, see PutFiles.
+func (s *MemoryStorage) PutFilesIfNewer(files storage.FileList) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var newer storage.FileList
+	for _, file := range files {
+		if err := s.validate(file); err != nil {
+			return err
+		}
+		if it, found := s.lookup(file.Key); found && it.info.Version.After(file.Version) {
+			continue
+		}
+		newer = append(newer, file)
+	}
+	return s.putFiles(newer)
+}
+
+// GetAllFiles retrieves all files from the storage.
+func (s *MemoryStorage) GetAllFiles() (storage.FileList, error) {
+	return s.GetFilesByFilter(func(string) bool { return true })
+}
+
+// Clear removes all the files.
+func (s *MemoryStorage) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items = make(map[string]*item)
+	s.ring.Clear()
+	s.order = list.New()
+	s.expiries = nil
+	s.used = 0
+	s.quarantined = make(map[string]struct{})
+	return s.transfers.Clear()
+}
+
+// ExtractFilesByFilter extracts the files that match the filter and returns them as a FileList.
+// It also removes the files from the storage.
+func (s *MemoryStorage) ExtractFilesByFilter(filter func(string) bool) (storage.FileList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := s.filesByFilter(filter)
+	for _, file := range files {
+		s.remove(file.Key)
+	}
+	return files, nil
+}
+
+// ExtractRange extracts the files with an identifier in (lo, hi], see ExtractFilesByFilter.
+func (s *MemoryStorage) ExtractRange(lo, hi *big.Int) (storage.FileList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := s.readFiles(s.ring.Range(lo, hi))
+	for _, file := range files {
+		s.remove(file.Key)
+	}
+	return files, nil
+}
+
+// RemoveExpired removes the expired files, and returns their keys.
+func (s *MemoryStorage) RemoveExpired() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removeExpired(time.Now(), ""), nil
+}
@@ -0,0 +1,282 @@
+package memory
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+func TestGetPutDelete(t *testing.T) {
+	ss := NewStorage()
+
+	value := []byte("testdata")
+	if err := ss.Put("testfile", value); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+
+	// the storage keeps its own copy of the value
+	value[0] = 'X'
+	got, err := ss.Get("testfile")
+	if err != nil || !bytes.Equal(got, []byte("testdata")) {
+		t.Fatalf("Expected testdata, got %s, %v", got, err)
+	}
+	got[0] = 'X'
+	if got, _ := ss.Get("testfile"); !bytes.Equal(got, []byte("testdata")) {
+		t.Fatalf("Expected the stored value to be unchanged, got %s", got)
+	}
+
+	if err := ss.Delete("testfile"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if _, err := ss.Get("testfile"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	if used, _ := ss.Used(); used != 0 {
+		t.Fatalf("Expected no memory used, got %d", used)
+	}
+	if err := ss.Put("", value); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestConditionalWrites(t *testing.T) {
+	ss := NewStorage()
+
+	first := storage.Version{WallTime: 1, NodeID: "node"}
+	second := storage.Version{WallTime: 2, NodeID: "node"}
+
+	if _, err := ss.PutIfAbsent(&storage.File{Key: "testfile", Value: []byte("first"), Version: first}); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	if version, err := ss.PutIfAbsent(&storage.File{Key: "testfile", Version: second}); !errors.Is(err, storage.ErrExists) || version != first {
+		t.Fatalf("Expected ErrExists with %v, got %v, %v", first, version, err)
+	}
+	if version, err := ss.CompareAndSwap(&storage.File{Key: "testfile", Value: []byte("second"), Version: second}, first); err != nil || version != second {
+		t.Fatalf("Expected version %v, got %v, %v", second, version, err)
+	}
+	if version, err := ss.DeleteIfVersion("testfile", first); !errors.Is(err, storage.ErrVersionMismatch) || version != second {
+		t.Fatalf("Expected ErrVersionMismatch with %v, got %v, %v", second, version, err)
+	}
+	if _, err := ss.DeleteIfVersion("testfile", second); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+}
+
+func TestFileLists(t *testing.T) {
+	ss := NewStorage()
+
+	files := storage.FileList{
+		{Key: "testfile1", Value: []byte("testdata1")},
+		{Key: "testfile2", Value: []byte("testdata2")},
+	}
+	if err := ss.PutFiles(files); err != nil {
+		t.Fatalf("Failed to put files: %v", err)
+	}
+
+	all, _ := ss.GetAllFiles()
+	if len(all) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(all))
+	}
+
+	extracted, _ := ss.ExtractFilesByFilter(func(key string) bool { return key == "testfile1" })
+	if len(extracted) != 1 || extracted[0].Key != "testfile1" {
+		t.Fatalf("Expected to extract testfile1, got %v", extracted)
+	}
+	if names := ss.GetFilesName(); len(names) != 1 || names[0] != "testfile2" {
+		t.Fatalf("Expected [testfile2], got %v", names)
+	}
+
+	ss.Clear()
+	if names := ss.GetFilesName(); len(names) != 0 {
+		t.Fatalf("Expected no file after clear, got %v", names)
+	}
+}
+
+func TestTTLAndStat(t *testing.T) {
+	ss := NewStorage()
+
+	ss.PutWithTTL("short", []byte("short"), 500*time.Millisecond)
+	ss.PutFile(&storage.File{Key: "notes.txt", Value: []byte("notes"), Owner: "127.0.0.1:8000"})
+
+	info, err := ss.Stat("notes.txt")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if info.Size != 5 || info.Checksum != storage.Checksum([]byte("notes")) || info.Owner != "127.0.0.1:8000" {
+		t.Fatalf("Unexpected metadata: %+v", info)
+	}
+
+	short, err := ss.Stat("short")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	time.Sleep(time.Until(short.ExpireAt) + 10*time.Millisecond)
+	if _, err := ss.Get("short"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for expired file, got %v", err)
+	}
+	if removed, _ := ss.RemoveExpired(); len(removed) != 1 || removed[0] != "short" {
+		t.Fatalf("Expected [short] to be removed, got %v", removed)
+	}
+}
+
+func TestExpiryHeap(t *testing.T) {
+	ss, _ := NewStorageWithSetting(60, EvictionNone)
+
+	ss.PutWithTTL("expired1", []byte("value"), time.Millisecond)
+	ss.PutWithTTL("expired2", []byte("value"), 2*time.Millisecond)
+	ss.PutWithTTL("later", []byte("value"), time.Hour)
+	ss.PutWithTTL("deleted", []byte("value"), time.Millisecond)
+	ss.Delete("deleted")
+	ss.PutWithTTL("overwritten", []byte("value"), time.Millisecond)
+	ss.Put("overwritten", []byte("value"))
+	if len(ss.expiries) != 3 {
+		t.Fatalf("Expected 3 items in the expiry heap, got %d", len(ss.expiries))
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// a capped write drops the expired files through the heap, the others are kept
+	if err := ss.Put("new", []byte("0123456789")); err != nil {
+		t.Fatalf("Expected the expired files to make room, got %v", err)
+	}
+	for _, key := range []string{"expired1", "expired2"} {
+		if _, found := ss.items[key]; found {
+			t.Fatalf("Expected %s to be removed", key)
+		}
+	}
+	if len(ss.expiries) != 1 || ss.expiries[0].info.Key != "later" || ss.expiries[0].expiry != 0 {
+		t.Fatalf("Expected only later in the expiry heap, got %d items", len(ss.expiries))
+	}
+	if _, err := ss.Get("overwritten"); err != nil {
+		t.Fatalf("Expected the overwritten file without TTL to be kept, got %v", err)
+	}
+}
+
+func TestCorruption(t *testing.T) {
+	ss := NewStorage()
+
+	file := &storage.File{Key: "testfile", Value: []byte("testdata"), Checksum: storage.Checksum([]byte("other"))}
+	if err := ss.PutFile(file); !errors.Is(err, storage.ErrCorrupted) {
+		t.Fatalf("Expected ErrCorrupted, got %v", err)
+	}
+
+	ss.Put("testfile", []byte("testdata"))
+	ss.items["testfile"].value[0] = 'X'
+
+	if corrupted, _ := ss.Scrub(); len(corrupted) != 1 || corrupted[0] != "testfile" {
+		t.Fatalf("Expected [testfile], got %v", corrupted)
+	}
+	if quarantined := ss.Quarantined(); len(quarantined) != 1 {
+		t.Fatalf("Expected [testfile] in quarantine, got %v", quarantined)
+	}
+	ss.Put("testfile", []byte("testdata"))
+	if quarantined := ss.Quarantined(); len(quarantined) != 0 {
+		t.Fatalf("Expected empty quarantine, got %v", quarantined)
+	}
+}
+
+func TestEvictionNone(t *testing.T) {
+	ss, err := NewStorageWithSetting(20, EvictionNone)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	if err := ss.Put("a", []byte("123456789")); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	if err := ss.Put("b", []byte("123456789")); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	if err := ss.Put("c", []byte("1")); !errors.Is(err, ErrFull) {
+		t.Fatalf("Expected ErrFull, got %v", err)
+	}
+
+	// an overwrite only needs the room for the difference
+	if err := ss.Put("a", []byte("12345678")); err != nil {
+		t.Fatalf("Failed to overwrite file: %v", err)
+	}
+	if used, _ := ss.Used(); used != 19 {
+		t.Fatalf("Expected 19 bytes used, got %d", used)
+	}
+	if err := ss.Put("c", make([]byte, 30)); !errors.Is(err, ErrFull) {
+		t.Fatalf("Expected ErrFull for a file larger than the cap, got %v", err)
+	}
+}
+
+func TestEvictionLRU(t *testing.T) {
+	ss, _ := NewStorageWithSetting(30, EvictionLRU)
+
+	ss.Put("a", []byte("123456789"))
+	ss.Put("b", []byte("123456789"))
+	ss.Put("c", []byte("123456789"))
+	ss.Get("a")
+
+	// b is the least recently used
+	if err := ss.Put("d", []byte("123456789")); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	if _, err := ss.Get("b"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected b to be evicted, got %v", err)
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, err := ss.Get(key); err != nil {
+			t.Fatalf("Expected %s to be kept, got %v", key, err)
+		}
+	}
+	if ss.Evicted() != 1 {
+		t.Fatalf("Expected 1 eviction, got %d", ss.Evicted())
+	}
+}
+
+func TestEvictionFIFO(t *testing.T) {
+	ss, _ := NewStorageWithSetting(30, EvictionFIFO)
+
+	ss.Put("a", []byte("123456789"))
+	ss.Put("b", []byte("123456789"))
+	ss.Put("c", []byte("123456789"))
+	ss.Get("a")
+
+	// a is the oldest written, the read doesn't count
+	ss.Put("d", []byte("123456789"))
+	if _, err := ss.Get("a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected a to be evicted, got %v", err)
+	}
+}
+
+func TestInvalidSetting(t *testing.T) {
+	if _, err := NewStorageWithSetting(-1, EvictionLRU); err == nil {
+		t.Fatal("Expected an error for a negative cap")
+	}
+	if _, err := NewStorageWithSetting(0, "random"); err == nil {
+		t.Fatal("Expected an error for an unknown policy")
+	}
+	if _, err := CappedMemoryStorageFactory(0, "random")("path"); err == nil {
+		t.Fatal("Expected the factory to return the error")
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	ss, _ := NewStorageWithSetting(1024, EvictionLRU)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := string(rune('a' + i))
+			for j := 0; j < 100; j++ {
+				ss.Put(key, bytes.Repeat([]byte{byte(j)}, 100))
+				ss.Get(key)
+				ss.GetAllFiles()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if used, maxBytes := ss.Used(); used > maxBytes {
+		t.Fatalf("Expected at most %d bytes used, got %d", maxBytes, used)
+	}
+}
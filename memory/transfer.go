@@ -0,0 +1,35 @@
+package memory
+
+import (
+	"math/big"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// BeginTransfer starts a transfer of the files in (lo, hi] to the target,
+// they stay in the storage until CommitTransfer.
+func (s *MemoryStorage) BeginTransfer(lo, hi *big.Int, target string) (string, storage.FileList, error) {
+	return storage.BeginTransfer(s, s.transfers, lo, hi, target)
+}
+
+// BeginTransferFiles starts a transfer of the files to the target, the ones already in a pending transfer are
+// left out, they stay in the storage until CommitTransfer.
+func (s *MemoryStorage) BeginTransferFiles(files storage.FileList, target string) (string, storage.FileList, error) {
+	return s.transfers.Begin(files, target)
+}
+
+// CommitTransfer removes the delivered files of the transfer, unless they changed since it began, and ends it.
+func (s *MemoryStorage) CommitTransfer(id string, delivered []string) error {
+	return storage.CommitTransfer(s, s.transfers, id, delivered)
+}
+
+// AbortTransfer ends the transfer, its files are kept.
+func (s *MemoryStorage) AbortTransfer(id string) error {
+	return s.transfers.End(id)
+}
+
+// PendingTransfers returns the transfers not committed or aborted yet,
+// the log is kept in memory like the files.
+func (s *MemoryStorage) PendingTransfers() []*storage.Transfer {
+	return s.transfers.Pending()
+}
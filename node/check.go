@@ -0,0 +1,225 @@
+package node
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/chord-dht/chord-core/tools"
+)
+
+// Kinds of violations found by CheckRing.
+const (
+	ViolationUnreachable = "unreachable" // the node can't be reached, the walk stops here
+	ViolationWalk        = "walk"        // the successor pointers don't form a single ring
+	ViolationSuccessor   = "successor"   // the successor list is not the true list of successors
+	ViolationPredecessor = "predecessor" // the successor's predecessor doesn't point back
+	ViolationFinger      = "finger"      // the finger entry is not the true successor of fingerIndex[i]
+	ViolationOwnership   = "ownership"   // the key is not in (predecessor, node]
+	ViolationReplica     = "replica"     // the key is missing from a backup storage that should hold it
+)
+
+// Violation is one inconsistency found by CheckRing.
+type Violation struct {
+	Node   NodeInfo `json:"node"`
+	Kind   string   `json:"kind"`
+	Detail string   `json:"detail"`
+}
+
+// RingReport is the result of CheckRing.
+type RingReport struct {
+	Nodes      NodeInfoList `json:"nodes"`
+	Violations []Violation  `json:"violations"`
+}
+
+// ringState is a node's state together with its position in the sorted ring.
+type ringState struct {
+	info  *NodeInfo
+	state *NodeState
+}
+
+// CheckRing walks the ring through the successor pointers, starting from the node itself,
+// and verifies every node it meets against the ring it has seen:
+//  1. the successor list is the true list of the following nodes, and the successor's predecessor points back.
+//  2. every finger entry is the true successor of fingerIndex[i].
+//  3. every key in the local storage lies in (predecessor, node], and it is replicated in the backup storages:
+//     of the predecessors in ReplicationPull (the i-th predecessor keeps it in backupStorages[i-1]),
+//     of the successors in ReplicationPush (successors[i] keeps it in backupStorages[i]),
+//     fragments in ReplicationErasure are not checked.
+//
+// The check is only a snapshot, a ring that is still stabilizing will report violations.
+func (node *Node) CheckRing() *RingReport {
+	report := &RingReport{}
+	states := node.walkRing(report)
+	if len(states) == 0 {
+		return report
+	}
+
+	// the true ring, sorted by identifier
+	sort.Slice(states, func(i, j int) bool {
+		return tools.LessThan(states[i].info.Identifier, states[j].info.Identifier)
+	})
+	for _, s := range states {
+		report.Nodes = append(report.Nodes, s.info)
+	}
+
+	for j, s := range states {
+		report.checkNeighbours(states, j)
+		report.checkFingers(states, s)
+		report.checkFiles(states, j)
+	}
+	return report
+}
+
+// maxWalkLength is the most nodes walkRing visits, whatever the size of the identifier space.
+const maxWalkLength = 1 << 16
+
+// walkLimit returns the most nodes walkRing visits: one per identifier, up to maxWalkLength.
+func walkLimit(identifierLength int) int {
+	if identifierLength >= 16 {
+		return maxWalkLength
+	}
+	return 1 << identifierLength
+}
+
+// walkRing follows the successor pointers until it comes back to the node itself.
+// The walk stops at the first unreachable node, when a node is met twice, or after walkLimit nodes.
+func (node *Node) walkRing(report *RingReport) []*ringState {
+	var states []*ringState
+	visited := make(map[string]struct{})
+	maxNodes := walkLimit(node.identifierLength)
+
+	current := &node.info
+	for i := 0; i < maxNodes; i++ {
+		state, err := current.GetState()
+		if err != nil {
+			report.addViolation(current, ViolationUnreachable, err.Error())
+			break
+		}
+		visited[current.Address()] = struct{}{}
+		states = append(states, &ringState{info: &state.Info, state: state})
+
+		next := state.Successors[0]
+		if next.Empty() {
+			report.addViolation(current, ViolationWalk, "successor is empty")
+			break
+		}
+		if InfoEqual(next, &node.info) {
+			break
+		}
+		if _, found := visited[next.Address()]; found {
+			report.addViolation(current, ViolationWalk, fmt.Sprintf("successor %v is visited twice", next.Identifier))
+			break
+		}
+		current = next
+	}
+	return states
+}
+
+// checkNeighbours checks the successor list of states[j], and the predecessor of its successor.
+func (report *RingReport) checkNeighbours(states []*ringState, j int) {
+	s := states[j]
+	for i, successor := range s.state.Successors {
+		expected := states[(j+1+i)%len(states)].info
+		if successor.Empty() || !InfoEqual(successor, expected) {
+			report.addViolation(s.info, ViolationSuccessor,
+				fmt.Sprintf("successors[%d] is %s, expected %v", i, describe(successor), expected.Identifier))
+		}
+	}
+
+	successor := states[(j+1)%len(states)]
+	predecessor := successor.state.Predecessor
+	if predecessor.Empty() || !InfoEqual(predecessor, s.info) {
+		report.addViolation(successor.info, ViolationPredecessor,
+			fmt.Sprintf("predecessor is %s, expected %v", describe(predecessor), s.info.Identifier))
+	}
+}
+
+// checkFingers checks every finger entry of s against the true successor of its finger index.
+func (report *RingReport) checkFingers(states []*ringState, s *ringState) {
+	for i, finger := range s.state.FingerTable {
+		expected := trueSuccessor(states, s.state.FingerIndex[i])
+		if finger.Empty() || !InfoEqual(finger, expected) {
+			report.addViolation(s.info, ViolationFinger,
+				fmt.Sprintf("finger[%d] is %s, expected %v", i, describe(finger), expected.Identifier))
+		}
+	}
+}
+
+// checkFiles checks the ownership of every key of states[j] and its replicas in the holders' backup storages.
+func (report *RingReport) checkFiles(states []*ringState, j int) {
+	s := states[j]
+	predecessor := states[(j-1+len(states))%len(states)].info
+
+	for _, filename := range s.state.LocalStorageName {
+		identifier := tools.GenerateIdentifier(filename)
+		if len(states) > 1 && !tools.ModIntervalCheck(identifier, predecessor.Identifier, s.info.Identifier, false, true) {
+			report.addViolation(s.info, ViolationOwnership,
+				fmt.Sprintf("%s (%v) is not in (%v, %v]", filename, identifier, predecessor.Identifier, s.info.Identifier))
+		}
+
+		if s.state.ReplicationMode == ReplicationErasure {
+			continue
+		}
+		for i := 0; i < len(s.state.BackupStoragesName); i++ {
+			holder := states[((j-1-i)%len(states)+len(states))%len(states)]
+			if s.state.ReplicationMode == ReplicationPush {
+				holder = states[(j+1+i)%len(states)]
+			}
+			if holder == s {
+				// the ring is smaller than the successor list, the rest of the replicas would be on the node itself
+				break
+			}
+			if i >= len(holder.state.BackupStoragesName) || !contains(holder.state.BackupStoragesName[i], filename) {
+				report.addViolation(holder.info, ViolationReplica,
+					fmt.Sprintf("backupStorages[%d] misses %s of %v", i, filename, s.info.Identifier))
+			}
+		}
+	}
+}
+
+// trueSuccessor finds the first node whose identifier >= identifier in the sorted ring (wrapping around).
+func trueSuccessor(states []*ringState, identifier *big.Int) *NodeInfo {
+	index := sort.Search(len(states), func(i int) bool {
+		return tools.GreaterThanOrEqual(states[i].info.Identifier, identifier)
+	})
+	return states[index%len(states)].info
+}
+
+func (report *RingReport) addViolation(nodeInfo *NodeInfo, kind string, detail string) {
+	report.Violations = append(report.Violations, Violation{Node: *nodeInfo, Kind: kind, Detail: detail})
+}
+
+// describe prints the identifier of the node, or "empty".
+func describe(nodeInfo *NodeInfo) string {
+	if nodeInfo.Empty() {
+		return "empty"
+	}
+	return nodeInfo.Identifier.String()
+}
+
+func contains(list []string, item string) bool {
+	for _, element := range list {
+		if element == item {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintReport prints the nodes of the ring and all the violations.
+func (report *RingReport) PrintReport() {
+	fmt.Println("Ring:")
+	for _, nodeInfo := range report.Nodes {
+		fmt.Printf("  ")
+		nodeInfo.PrintInfo()
+	}
+
+	fmt.Println("Violations:")
+	if len(report.Violations) == 0 {
+		fmt.Println("  No violation")
+	}
+	for _, violation := range report.Violations {
+		fmt.Printf("  [%s] Node %v: %s\n", violation.Kind, violation.Node.Identifier, violation.Detail)
+	}
+}
@@ -0,0 +1,187 @@
+package node
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/chord-dht/chord-core/tools"
+)
+
+func TestWalkLimit(t *testing.T) {
+	tests := []struct {
+		identifierLength int
+		expected         int
+	}{
+		{1, 2},
+		{8, 256},
+		{15, 1 << 15},
+		{16, maxWalkLength},
+		{63, maxWalkLength},
+		{64, maxWalkLength},
+		{160, maxWalkLength},
+	}
+	for _, tt := range tests {
+		if limit := walkLimit(tt.identifierLength); limit != tt.expected {
+			t.Errorf("walkLimit(%d) = %d, expected %d", tt.identifierLength, limit, tt.expected)
+		}
+	}
+}
+
+// ownedKeys finds n keys whose identifier lies in (predecessor, identifier].
+func ownedKeys(t *testing.T, predecessor, identifier *big.Int, n int) []string {
+	t.Helper()
+	var keys []string
+	for i := 0; i < 100000 && len(keys) < n; i++ {
+		key := fmt.Sprintf("file%d", i)
+		if tools.ModIntervalCheck(tools.GenerateIdentifier(key), predecessor, identifier, false, true) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) < n {
+		t.Fatalf("Only %d keys in (%v, %v]", len(keys), predecessor, identifier)
+	}
+	return keys
+}
+
+// testRing builds the states of a consistent ring of n nodes spread over the identifier space, sorted by identifier.
+// Every node holds one file, replicated in the backup storages of its holders in the replication mode.
+func testRing(t *testing.T, n int, successorsLength int, mode string) []*ringState {
+	t.Helper()
+	states := make([]*ringState, n)
+	for j := range states {
+		identifier := new(big.Int).Div(new(big.Int).Mul(tools.TwoM, big.NewInt(int64(j))), big.NewInt(int64(n)))
+		info := &NodeInfo{Identifier: identifier, IpAddress: "127.0.0.1", Port: fmt.Sprint(8000 + j)}
+		states[j] = &ringState{info: info, state: &NodeState{
+			Info:               *info,
+			ReplicationMode:    mode,
+			BackupStoragesName: make([][]string, successorsLength),
+		}}
+	}
+
+	for j, s := range states {
+		s.state.Predecessor = states[(j-1+n)%n].info
+		for i := 0; i < successorsLength; i++ {
+			s.state.Successors = append(s.state.Successors, states[(j+1+i)%n].info)
+		}
+		for i := 0; i < tools.IdentifierLength; i++ {
+			index := new(big.Int).Add(s.info.Identifier, new(big.Int).Lsh(big.NewInt(1), uint(i)))
+			index.Mod(index, tools.TwoM)
+			finger := states[0].info
+			for _, other := range states {
+				if other.info.Identifier.Cmp(index) >= 0 {
+					finger = other.info
+					break
+				}
+			}
+			s.state.FingerIndex = append(s.state.FingerIndex, index)
+			s.state.FingerTable = append(s.state.FingerTable, finger)
+		}
+
+		key := ownedKeys(t, s.state.Predecessor.Identifier, s.info.Identifier, 1)[0]
+		s.state.LocalStorageName = []string{key}
+		for i := 0; i < successorsLength; i++ {
+			holder := states[((j-1-i)%n+n)%n]
+			if mode == ReplicationPush {
+				holder = states[(j+1+i)%n]
+			}
+			if holder == s {
+				break
+			}
+			holder.state.BackupStoragesName[i] = append(holder.state.BackupStoragesName[i], key)
+		}
+	}
+	return states
+}
+
+// checkStates runs the checks of CheckRing over the states.
+func checkStates(states []*ringState) *RingReport {
+	report := &RingReport{}
+	for j, s := range states {
+		report.checkNeighbours(states, j)
+		report.checkFingers(states, s)
+		report.checkFiles(states, j)
+	}
+	return report
+}
+
+// without returns the list without the item.
+func without(list []string, item string) []string {
+	var kept []string
+	for _, element := range list {
+		if element != item {
+			kept = append(kept, element)
+		}
+	}
+	return kept
+}
+
+func TestCheckRing(t *testing.T) {
+	type violation struct {
+		node int // the index of the node in the ring
+		kind string
+	}
+	tests := []struct {
+		name             string
+		nodes            int
+		successorsLength int
+		mode             string
+		breakRing        func(states []*ringState)
+		expected         []violation
+	}{
+		{"Consistent", 4, 3, ReplicationPull, func(states []*ringState) {}, nil},
+		{"ConsistentPush", 4, 3, ReplicationPush, func(states []*ringState) {}, nil},
+		{"BrokenSuccessor", 4, 3, ReplicationPull, func(states []*ringState) {
+			states[0].state.Successors[0] = states[2].info
+		}, []violation{{0, ViolationSuccessor}}},
+		{"EmptySuccessor", 4, 3, ReplicationPull, func(states []*ringState) {
+			states[1].state.Successors[2] = NewNodeInfo()
+		}, []violation{{1, ViolationSuccessor}}},
+		{"BrokenPredecessor", 4, 3, ReplicationPull, func(states []*ringState) {
+			states[2].state.Predecessor = states[0].info
+		}, []violation{{2, ViolationPredecessor}}},
+		{"EmptyPredecessor", 4, 3, ReplicationPull, func(states []*ringState) {
+			states[3].state.Predecessor = NewNodeInfo()
+		}, []violation{{3, ViolationPredecessor}}},
+		{"StaleFinger", 4, 3, ReplicationPull, func(states []*ringState) {
+			last := len(states[1].state.FingerTable) - 1
+			states[1].state.FingerTable[last] = states[2].info
+		}, []violation{{1, ViolationFinger}}},
+		{"MisplacedFile", 4, 3, ReplicationErasure, func(states []*ringState) {
+			states[1].state.LocalStorageName = append(states[1].state.LocalStorageName, states[0].state.LocalStorageName[0])
+		}, []violation{{1, ViolationOwnership}}},
+		{"MissingReplicaPull", 4, 3, ReplicationPull, func(states []*ringState) {
+			// the second predecessor of node 0 keeps its replicas in backupStorages[1]
+			states[2].state.BackupStoragesName[1] = without(states[2].state.BackupStoragesName[1], states[0].state.LocalStorageName[0])
+		}, []violation{{2, ViolationReplica}}},
+		{"MissingReplicaPush", 4, 3, ReplicationPush, func(states []*ringState) {
+			// the second successor of node 0 keeps its replicas in backupStorages[1]
+			states[2].state.BackupStoragesName[1] = without(states[2].state.BackupStoragesName[1], states[0].state.LocalStorageName[0])
+		}, []violation{{2, ViolationReplica}}},
+		{"MissingBackupStorage", 4, 3, ReplicationPush, func(states []*ringState) {
+			states[1].state.BackupStoragesName = states[1].state.BackupStoragesName[:1]
+		}, []violation{{1, ViolationReplica}, {1, ViolationReplica}}},
+		{"SmallRing", 2, 3, ReplicationPull, func(states []*ringState) {}, nil},
+		{"SmallRingMissingReplica", 2, 3, ReplicationPush, func(states []*ringState) {
+			states[1].state.BackupStoragesName[0] = nil
+		}, []violation{{1, ViolationReplica}}},
+		{"SingleNode", 1, 3, ReplicationPull, func(states []*ringState) {}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			states := testRing(t, tt.nodes, tt.successorsLength, tt.mode)
+			tt.breakRing(states)
+
+			report := checkStates(states)
+			if len(report.Violations) != len(tt.expected) {
+				t.Fatalf("Expected %d violations, got %+v", len(tt.expected), report.Violations)
+			}
+			for i, expected := range tt.expected {
+				got := report.Violations[i]
+				if !InfoEqual(&got.Node, states[expected.node].info) || got.Kind != expected.kind {
+					t.Fatalf("Expected a %s violation on node %d, got %+v", expected.kind, expected.node, got)
+				}
+			}
+		})
+	}
+}
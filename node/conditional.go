@@ -0,0 +1,139 @@
+package node
+
+import (
+	"errors"
+
+	"github.com/chord-dht/chord-core/storage"
+	"github.com/chord-dht/chord-core/tools"
+)
+
+/*
+ * Conditional writes, for optimistic concurrency on the files shared by several clients.
+ * A client reads the file (and its version), and writes it back only if nobody wrote it in between.
+ * On conflict, the current version is returned so the client can read it again and retry.
+ */
+
+// PutIfAbsent stores the file in the node only if the node doesn't have it yet, and replicates it.
+// A *WriteQuorumError comes with the version of the write, which is kept.
+func (node *Node) PutIfAbsent(filename string, data []byte) (storage.Version, error) {
+	file := node.newFile(filename, data)
+	version, err := node.localStorage.PutIfAbsent(file)
+	if err != nil {
+		return version, err
+	}
+	return version, node.replicateFile(file)
+}
+
+// CompareAndSwap stores the file in the node only if its current version is the expected one, and replicates it.
+// A *WriteQuorumError comes with the version of the write, which is kept.
+func (node *Node) CompareAndSwap(filename string, expected storage.Version, data []byte) (storage.Version, error) {
+	file := node.newFile(filename, data)
+	version, err := node.localStorage.CompareAndSwap(file, expected)
+	if err != nil {
+		return version, err
+	}
+	return version, node.replicateFile(file)
+}
+
+// DeleteIfVersion removes the file from the node only if its current version is the expected one.
+func (node *Node) DeleteIfVersion(filename string, expected storage.Version) (storage.Version, error) {
+	version, err := node.localStorage.DeleteIfVersion(filename, expected)
+	if err != nil {
+		return version, err
+	}
+	node.deleteReplicas(filename, expected)
+	return version, nil
+}
+
+// fillConditionalReply fills the reply with the result of a conditional write.
+func fillConditionalReply(reply *ConditionalReply, version storage.Version, err error) {
+	reply.Version = version
+	var quorumErr *WriteQuorumError
+	switch {
+	case err == nil:
+		reply.Success = true
+	case errors.As(err, &quorumErr):
+		// the copies written are kept, the client learns the version it committed
+		reply.Written = quorumErr.Written
+	case errors.Is(err, storage.ErrExists), errors.Is(err, storage.ErrVersionMismatch):
+		reply.Conflict = true
+	case errors.Is(err, storage.ErrNotFound):
+		reply.NotFound = true
+	}
+}
+
+// checkOwner rejects the request if the node is not responsible for the key, with the hint of the correct owner.
+func checkOwner(key string, reply *ConditionalReply) bool {
+	if localNode.isResponsible(tools.GenerateIdentifier(key)) {
+		return true
+	}
+	reply.Misrouted = true
+	reply.Owner = localNode.ownerHint(key)
+	return false
+}
+
+/*                             RPC Part                             */
+
+// PutIfAbsent is a wrap of PutIfAbsentRPC method
+func (nodeInfo *NodeInfo) PutIfAbsent(filename string, fileContent []byte) (*ConditionalReply, error) {
+	args := &ConditionalArgs{
+		File: storage.File{Key: filename, Value: fileContent},
+	}
+	reply := &ConditionalReply{}
+	err := nodeInfo.callRPC("PutIfAbsentRPC", args, reply)
+	return reply, err
+}
+
+// PutIfAbsentRPC : Store the file only if the node doesn't have it yet
+func (handler *RPCHandler) PutIfAbsentRPC(args *ConditionalArgs, reply *ConditionalReply) error {
+	if !checkOwner(args.File.Key, reply) {
+		return nil
+	}
+	version, err := localNode.PutIfAbsent(args.File.Key, args.File.Value)
+	fillConditionalReply(reply, version, err)
+	return nil
+}
+
+// CompareAndSwap is a wrap of CompareAndSwapRPC method
+func (nodeInfo *NodeInfo) CompareAndSwap(filename string, expected storage.Version, fileContent []byte) (*ConditionalReply, error) {
+	args := &ConditionalArgs{
+		File:     storage.File{Key: filename, Value: fileContent},
+		Expected: expected,
+	}
+	reply := &ConditionalReply{}
+	err := nodeInfo.callRPC("CompareAndSwapRPC", args, reply)
+	return reply, err
+}
+
+// CompareAndSwapRPC : Store the file only if its current version is the expected one
+func (handler *RPCHandler) CompareAndSwapRPC(args *ConditionalArgs, reply *ConditionalReply) error {
+	if !checkOwner(args.File.Key, reply) {
+		return nil
+	}
+	version, err := localNode.CompareAndSwap(args.File.Key, args.Expected, args.File.Value)
+	fillConditionalReply(reply, version, err)
+	return nil
+}
+
+// DeleteIfVersion is a wrap of DeleteIfVersionRPC method
+func (nodeInfo *NodeInfo) DeleteIfVersion(filename string, expected storage.Version) (*ConditionalReply, error) {
+	args := &ConditionalArgs{
+		File:     storage.File{Key: filename},
+		Expected: expected,
+	}
+	reply := &ConditionalReply{}
+	err := nodeInfo.callRPC("DeleteIfVersionRPC", args, reply)
+	return reply, err
+}
+
+// DeleteIfVersionRPC : Remove the file only if its current version is the expected one
+func (handler *RPCHandler) DeleteIfVersionRPC(args *ConditionalArgs, reply *ConditionalReply) error {
+	if !checkOwner(args.File.Key, reply) {
+		return nil
+	}
+	version, err := localNode.DeleteIfVersion(args.File.Key, args.Expected)
+	fillConditionalReply(reply, version, err)
+	return nil
+}
+
+/*                             RPC Part                             */
@@ -0,0 +1,412 @@
+package node
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chord-dht/chord-core/erasure"
+	"github.com/chord-dht/chord-core/storage"
+	"github.com/chord-dht/chord-core/tools"
+)
+
+/*
+ * Erasure-coded storage (ReplicationErasure).
+ * The owner keeps the full file in its local storage, and splits it into k data + m parity fragments with
+ * Reed-Solomon, fragment i is kept by successors[i] in its fragment storage. Any k fragments rebuild the file, so the
+ * disk usage is 1 + (k+m)/k instead of r+1 with full replication.
+ * When the owner dies, its successor takes over the range: it holds fragment 0 of every file of the dead owner,
+ * and rebuilds them from the fragments kept by itself and its successors (the dead owner's successors).
+ * Fragments are pushed the same way as replicas in ReplicationPush: a new successor gets the fragments of its index,
+ * and all of them are pushed again when the local files change in bulk or successors are lost.
+ * Every fragment records its owner, so a node only rebuilds the files of dead owners, the owner removes its fragments
+ * when it deletes or hands off a file, and the fragments left by a previous owner are pruned once the file has a new
+ * one: when the node gets a fragment of it from another owner, or becomes its owner.
+ */
+
+const ReplicationErasure = "erasure"
+
+// fragmentSizeLength is the length of the header of a fragment, which keeps the size of the original file.
+const fragmentSizeLength = 8
+
+// SetErasureCoding switches the node to ReplicationErasure, with dataShards (k) data and parityShards (m) parity
+// fragments per file. It requires k+m <= SuccessorsLength, and it should be called before Initialize.
+func (node *Node) SetErasureCoding(dataShards, parityShards int) error {
+	if dataShards < 1 || parityShards < 1 {
+		return fmt.Errorf("there should be at least 1 data and 1 parity fragment")
+	}
+	if dataShards+parityShards > node.successorsLength {
+		return fmt.Errorf("data + parity fragments should be at most %d", node.successorsLength)
+	}
+	encoder, err := erasure.New(dataShards, parityShards)
+	if err != nil {
+		return err
+	}
+	node.encoder = encoder
+	node.replicationMode = ReplicationErasure
+	return nil
+}
+
+// fragmentKey is the key of the index-th fragment of the file in the fragment storage.
+func fragmentKey(filename string, index int) string {
+	return filename + "#" + strconv.Itoa(index)
+}
+
+// parseFragmentKey splits the fragment key into the filename and the index.
+func parseFragmentKey(key string) (string, int, error) {
+	separator := strings.LastIndex(key, "#")
+	if separator == -1 {
+		return "", 0, fmt.Errorf("invalid fragment key: %s", key)
+	}
+	index, err := strconv.Atoi(key[separator+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid fragment key: %s", key)
+	}
+	return key[:separator], index, nil
+}
+
+// encodeFragments splits the data into fragments, each of them starts with the size of the data.
+func (node *Node) encodeFragments(data []byte) ([][]byte, error) {
+	shards := node.encoder.Split(data)
+	if err := node.encoder.Encode(shards); err != nil {
+		return nil, err
+	}
+	fragments := make([][]byte, len(shards))
+	for i, shard := range shards {
+		fragment := make([]byte, fragmentSizeLength+len(shard))
+		binary.BigEndian.PutUint64(fragment, uint64(len(data)))
+		copy(fragment[fragmentSizeLength:], shard)
+		fragments[i] = fragment
+	}
+	return fragments, nil
+}
+
+// decodeFragments rebuilds the data from the fragments, missing fragments are nil.
+func (node *Node) decodeFragments(fragments [][]byte) ([]byte, error) {
+	size := -1
+	shards := make([][]byte, len(fragments))
+	for i, fragment := range fragments {
+		if len(fragment) <= fragmentSizeLength {
+			continue
+		}
+		size = int(binary.BigEndian.Uint64(fragment))
+		shards[i] = fragment[fragmentSizeLength:]
+	}
+	if size == -1 {
+		return nil, fmt.Errorf("no fragment")
+	}
+	if err := node.encoder.Reconstruct(shards); err != nil {
+		return nil, err
+	}
+	return node.encoder.Join(shards, size)
+}
+
+// storeFragments encodes the file and sends fragment i to successors[i] (or keeps it if it is the node itself).
+// Every fragment carries the version of the file.
+// It returns an error if fewer than k fragments are stored, as the file could not be rebuilt.
+func (node *Node) storeFragments(file *storage.File) error {
+	fragments, err := node.encodeFragments(file.Value)
+	if err != nil {
+		return err
+	}
+
+	stored := 0
+	successors := node.GetSuccessors()
+	for i, fragment := range fragments {
+		fileList := storage.FileList{{
+			Key:      fragmentKey(file.Key, i),
+			Value:    fragment,
+			Version:  file.Version,
+			ExpireAt: file.ExpireAt,
+			Owner:    node.info.Address(),
+		}}
+		if node.sendFragments(successors[i], fileList) == nil {
+			stored++
+		}
+	}
+	if stored < node.encoder.DataShards() {
+		return fmt.Errorf("too few fragments stored: %d of %d", stored, node.encoder.DataShards())
+	}
+	return nil
+}
+
+// pushFragments sends the index-th fragment of every local file to the successor.
+func (node *Node) pushFragments(successor *NodeInfo, fileList storage.FileList, index int) error {
+	if index >= node.encoder.TotalShards() {
+		return nil
+	}
+	var fragmentList storage.FileList
+	for _, file := range fileList {
+		fragments, err := node.encodeFragments(file.Value)
+		if err != nil {
+			return err
+		}
+		fragmentList = append(fragmentList, &storage.File{
+			Key:      fragmentKey(file.Key, index),
+			Value:    fragments[index],
+			Version:  file.Version,
+			ExpireAt: file.ExpireAt,
+			Owner:    node.info.Address(),
+		})
+	}
+	return node.sendFragments(successor, fragmentList)
+}
+
+// sendFragments stores the fragments on the node (nodeInfo), locally if it is the node itself.
+func (node *Node) sendFragments(nodeInfo *NodeInfo, fragmentList storage.FileList) error {
+	if nodeInfo.Empty() {
+		return fmt.Errorf("no node to keep the fragments")
+	}
+	if InfoEqual(nodeInfo, &node.info) {
+		return node.StoreFragments(fragmentList)
+	}
+	reply, err := nodeInfo.StoreFragments(fragmentList)
+	if err != nil {
+		return err
+	}
+	if !reply.Success {
+		return fmt.Errorf("failed to store the fragments on %v", nodeInfo)
+	}
+	return nil
+}
+
+// reconstructFile rebuilds the file from the fragments kept by the node and its successors,
+// and stores it in the local storage, so it is served (and its fragments are pushed) as a local file from now on.
+// Only the fragments of the same version can be combined, the newest version with enough fragments is rebuilt.
+func (node *Node) reconstructFile(filename string) (*storage.File, error) {
+	fragmentsByVersion := make(map[storage.Version][][]byte)
+	expireAtByVersion := make(map[storage.Version]time.Time)
+	collect := func(fragmentList storage.FileList) {
+		for _, fragment := range fragmentList {
+			_, index, err := parseFragmentKey(fragment.Key)
+			if err != nil || index >= node.encoder.TotalShards() || fragment.Verify() != nil {
+				continue
+			}
+			fragments, found := fragmentsByVersion[fragment.Version]
+			if !found {
+				fragments = make([][]byte, node.encoder.TotalShards())
+				fragmentsByVersion[fragment.Version] = fragments
+			}
+			fragments[index] = fragment.Value
+			expireAtByVersion[fragment.Version] = fragment.ExpireAt
+		}
+	}
+
+	collect(node.GetFragments(filename))
+	for _, successor := range node.GetSuccessors() {
+		if successor.Empty() || InfoEqual(successor, &node.info) {
+			continue
+		}
+		reply, err := successor.GetFragments(filename)
+		if err != nil || !reply.Success {
+			continue
+		}
+		collect(reply.FileList)
+	}
+
+	var file *storage.File
+	for version, fragments := range fragmentsByVersion {
+		if file != nil && !version.After(file.Version) {
+			continue
+		}
+		if data, err := node.decodeFragments(fragments); err == nil {
+			file = &storage.File{Key: filename, Value: data, Version: version, ExpireAt: expireAtByVersion[version]}
+		}
+	}
+	if file == nil {
+		return nil, fmt.Errorf("failed to reconstruct %s: too few fragments", filename)
+	}
+
+	if err := node.StoreFiles(storage.FileList{file}); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// reconstructOrphans rebuilds the files of the dead predecessors whose range the node takes over.
+// Fragment 0 is kept by the owner's first successor, so the files to rebuild are the ones whose fragment 0 is kept
+// by the node, which are not in the local storage, whose key is in the node's range (newPredecessor, node] (any key
+// if the new predecessor is not known yet), and whose owner is dead. A live owner (e.g. a node that just joined
+// before the node) keeps its files, and so does a fragment without owner unless the range is known.
+func (node *Node) reconstructOrphans(newPredecessor *NodeInfo) {
+	alive := make(map[string]bool)
+	ownerAlive := func(owner string) bool {
+		if owner == "" {
+			return newPredecessor.Empty()
+		}
+		if _, found := alive[owner]; !found {
+			host, port, err := net.SplitHostPort(owner)
+			alive[owner] = err == nil && NewNodeInfoWithAddress(host, port).Ping() == nil
+		}
+		return alive[owner]
+	}
+
+	for _, key := range node.fragmentStorage.GetFilesName() {
+		filename, index, err := parseFragmentKey(key)
+		if err != nil || index != 0 {
+			continue
+		}
+		if !newPredecessor.Empty() {
+			identifier := tools.GenerateIdentifier(filename)
+			if !tools.ModIntervalCheck(identifier, newPredecessor.Identifier, node.info.Identifier, false, true) {
+				continue
+			}
+		}
+		if _, err := node.localStorage.Stat(filename); err == nil {
+			continue
+		}
+		info, err := node.fragmentStorage.Stat(key)
+		if err != nil || ownerAlive(info.Owner) {
+			continue
+		}
+		_, _ = node.reconstructFile(filename)
+	}
+}
+
+// StoreFragments stores the fragments in the node's fragment storage, a fragment of an older version is skipped.
+// The fragments of the same files kept for another owner are pruned, as the files changed owner.
+func (node *Node) StoreFragments(fragmentList storage.FileList) error {
+	if err := storage.MergeFiles(node.fragmentStorage, fragmentList); err != nil {
+		return err
+	}
+	for _, fragment := range fragmentList {
+		filename, _, err := parseFragmentKey(fragment.Key)
+		if err != nil || fragment.Owner == "" {
+			continue
+		}
+		owner := fragment.Owner
+		if err := node.removeFragments(filename, fragment.Version, func(o string) bool { return o != owner }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteFragments removes the fragments the node keeps for the owner of the files, used by the owner when it deletes
+// or hands off them. A fragment newer than the version of its file is kept, and so are the fragments of other owners.
+func (node *Node) DeleteFragments(owner *NodeInfo, versions map[string]storage.Version) error {
+	address := owner.Address()
+	for filename, version := range versions {
+		if err := node.removeFragments(filename, version, func(o string) bool { return o == address || o == "" }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFragments removes the fragments of the file kept by the node whose owner matches,
+// unless they are newer than the version.
+func (node *Node) removeFragments(filename string, version storage.Version, match func(owner string) bool) error {
+	if node.encoder == nil {
+		return nil
+	}
+	for i := 0; i < node.encoder.TotalShards(); i++ {
+		key := fragmentKey(filename, i)
+		info, err := node.fragmentStorage.Stat(key)
+		if err != nil || info.Version.After(version) || !match(info.Owner) {
+			continue
+		}
+		_, err = node.fragmentStorage.DeleteIfVersion(key, info.Version)
+		if err != nil && !errors.Is(err, storage.ErrVersionMismatch) && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteFragments asks the holders of the fragments of the files (the first TotalShards successors) to remove them,
+// versions maps every file to the version it is removed at. It is done in the background, a holder which doesn't
+// get it keeps the fragments, they are only rebuilt if the node dies (see reconstructOrphans).
+func (node *Node) deleteFragments(versions map[string]storage.Version) {
+	if node.encoder == nil || len(versions) == 0 {
+		return
+	}
+	holders := make(map[string]*NodeInfo)
+	for _, successor := range node.GetSuccessors()[:node.encoder.TotalShards()] {
+		if !successor.Empty() {
+			holders[successor.Address()] = successor
+		}
+	}
+	for _, holder := range holders {
+		if InfoEqual(holder, &node.info) {
+			_ = node.DeleteFragments(&node.info, versions)
+			continue
+		}
+		go func(holder *NodeInfo) {
+			_, _ = holder.DeleteFragments(&node.info, versions)
+		}(holder)
+	}
+}
+
+// GetFragments gets all the fragments of the file kept by the node.
+func (node *Node) GetFragments(filename string) storage.FileList {
+	var fragmentList storage.FileList
+	if node.encoder == nil {
+		return fragmentList
+	}
+	for i := 0; i < node.encoder.TotalShards(); i++ {
+		key := fragmentKey(filename, i)
+		if fragment, err := node.fragmentStorage.GetFile(key); err == nil {
+			fragmentList = append(fragmentList, fragment)
+		}
+	}
+	return fragmentList
+}
+
+/*                             RPC Part                             */
+
+// StoreFragments is a wrap of StoreFragmentsRPC method
+func (nodeInfo *NodeInfo) StoreFragments(fragmentList storage.FileList) (*BoolReply, error) {
+	args := &StoreFileListArgs{
+		FileList: fragmentList,
+	}
+	reply := &BoolReply{}
+	err := nodeInfo.callRPC("StoreFragmentsRPC", args, reply)
+	return reply, err
+}
+
+// StoreFragmentsRPC : Store the fragments in the node's fragment storage
+func (handler *RPCHandler) StoreFragmentsRPC(args *StoreFileListArgs, reply *BoolReply) error {
+	reply.Success = localNode.StoreFragments(args.FileList) == nil
+	return nil
+}
+
+// DeleteFragments is a wrap of DeleteFragmentsRPC method
+func (nodeInfo *NodeInfo) DeleteFragments(owner *NodeInfo, versions map[string]storage.Version) (*BoolReply, error) {
+	args := &DeleteFragmentsArgs{
+		Owner:    *owner,
+		Versions: versions,
+	}
+	reply := &BoolReply{}
+	err := nodeInfo.callRPC("DeleteFragmentsRPC", args, reply)
+	return reply, err
+}
+
+// DeleteFragmentsRPC : Remove the fragments the node keeps for the owner of the files
+func (handler *RPCHandler) DeleteFragmentsRPC(args *DeleteFragmentsArgs, reply *BoolReply) error {
+	reply.Success = localNode.DeleteFragments(&args.Owner, args.Versions) == nil
+	return nil
+}
+
+// GetFragments is a wrap of GetFragmentsRPC method
+func (nodeInfo *NodeInfo) GetFragments(filename string) (*GetFileListReply, error) {
+	args := &GetFileArgs{
+		Filename: filename,
+	}
+	reply := &GetFileListReply{}
+	err := nodeInfo.callRPC("GetFragmentsRPC", args, reply)
+	return reply, err
+}
+
+// GetFragmentsRPC : Get all the fragments of the file kept by the node
+func (handler *RPCHandler) GetFragmentsRPC(args *GetFileArgs, reply *GetFileListReply) error {
+	reply.Success = true
+	reply.FileList = localNode.GetFragments(args.Filename)
+	return nil
+}
+
+/*                             RPC Part                             */
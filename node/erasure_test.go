@@ -0,0 +1,212 @@
+package node
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// newErasureNode creates a node with 2 data and 1 parity fragments per file,
+// its successors are recording nodes, which keep the fragments they are given.
+func newErasureNode(t *testing.T) (*Node, []*recordingHandler) {
+	t.Helper()
+	node := newTestNode(t, "100")
+	if err := node.SetErasureCoding(2, 1); err != nil {
+		t.Fatalf("Failed to set erasure coding: %v", err)
+	}
+	var successors NodeInfoList
+	var handlers []*recordingHandler
+	for _, identifier := range []int64{110, 120, 130} {
+		successor, handler := recordingNodeInfo(t, identifier)
+		successors = append(successors, successor)
+		handlers = append(handlers, handler)
+	}
+	node.SetSuccessors(successors)
+	return node, handlers
+}
+
+// spreadFragments encodes the file of the owner, the node keeps fragment 0 and the handler fragment 1,
+// as the first two successors of the owner.
+func spreadFragments(t *testing.T, node *Node, handler *recordingHandler, owner *NodeInfo, file *storage.File) {
+	t.Helper()
+	fragments, err := node.encodeFragments(file.Value)
+	if err != nil {
+		t.Fatalf("Failed to encode %s: %v", file.Key, err)
+	}
+	fragment := func(index int) *storage.File {
+		return &storage.File{
+			Key:     fragmentKey(file.Key, index),
+			Value:   fragments[index],
+			Version: file.Version,
+			Owner:   owner.Address(),
+		}
+	}
+	if err := node.StoreFragments(storage.FileList{fragment(0)}); err != nil {
+		t.Fatalf("Failed to store fragment: %v", err)
+	}
+	handler.mu.Lock()
+	handler.fragments[fragment(1).Key] = fragment(1)
+	handler.mu.Unlock()
+}
+
+// expectLocal checks which files are in the local storage of the node.
+func expectLocal(t *testing.T, node *Node, filenames []string, local bool) {
+	t.Helper()
+	for _, filename := range filenames {
+		if _, err := node.localStorage.Stat(filename); (err == nil) != local {
+			t.Fatalf("Expected %s in the local storage: %v, got %v", filename, local, err)
+		}
+	}
+}
+
+// expectFragmentsDeleted waits until every handler is asked to delete the fragments of the files of the owner.
+func expectFragmentsDeleted(t *testing.T, handlers []*recordingHandler, owner *NodeInfo, versions map[string]storage.Version) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, handler := range handlers {
+		for {
+			handler.mu.Lock()
+			var deleted []DeleteFragmentsArgs
+			deleted = append(deleted, handler.deleted...)
+			handler.mu.Unlock()
+
+			received := make(map[string]storage.Version)
+			for _, args := range deleted {
+				if InfoEqual(&args.Owner, owner) {
+					for filename, version := range args.Versions {
+						received[filename] = version
+					}
+				}
+			}
+			missing := 0
+			for filename, version := range versions {
+				if received[filename] != version {
+					missing++
+				}
+			}
+			if missing == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the fragments of %v to be deleted, got %v", versions, deleted)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestErasureReconstructDeadOwner(t *testing.T) {
+	node, handlers := newErasureNode(t)
+	dead := deadNodeInfo(t, 90)
+	live := liveNodeInfo(t, 80)
+
+	orphan := &storage.File{Key: "orphan", Value: []byte("orphan data"), Version: storage.Version{WallTime: 1, NodeID: "dead"}}
+	owned := &storage.File{Key: "owned", Value: []byte("owned data"), Version: storage.Version{WallTime: 1, NodeID: "live"}}
+	spreadFragments(t, node, handlers[0], dead, orphan)
+	spreadFragments(t, node, handlers[0], live, owned)
+	node.SetPredecessor(dead)
+
+	node.checkPredecessor()
+
+	// only the file of the dead owner is rebuilt, the fragments kept for it are pruned
+	value, err := node.GetFile("orphan")
+	if err != nil || !bytes.Equal(value, orphan.Value) {
+		t.Fatalf("Expected the orphan to be rebuilt, got %s, %v", value, err)
+	}
+	expectLocal(t, node, []string{"owned"}, false)
+	if _, err := node.fragmentStorage.Stat(fragmentKey("orphan", 0)); err == nil {
+		t.Fatal("Expected the fragment of the previous owner to be pruned")
+	}
+	if _, err := node.fragmentStorage.Stat(fragmentKey("owned", 0)); err != nil {
+		t.Fatalf("Expected the fragment of the live owner to be kept, got %v", err)
+	}
+}
+
+func TestErasureJoin(t *testing.T) {
+	node, handlers := newErasureNode(t)
+	oldPredecessor := liveNodeInfo(t, 10)
+	node.SetPredecessor(oldPredecessor)
+	joiner, joinerHandler := recordingNodeInfo(t, 50)
+
+	// the node keeps fragment 0 of a file of its live predecessor, and files of its own on both sides of the joiner
+	kept := &storage.File{Key: ownedKeys(t, big.NewInt(900), oldPredecessor.Identifier, 1)[0], Value: []byte("kept data"),
+		Version: storage.Version{WallTime: 1, NodeID: "old"}}
+	spreadFragments(t, node, handlers[0], oldPredecessor, kept)
+	moved := ownedKeys(t, oldPredecessor.Identifier, joiner.Identifier, 2)
+	stay := ownedKeys(t, joiner.Identifier, node.info.Identifier, 1)
+	versions := make(map[string]storage.Version)
+	for _, filename := range append(append([]string(nil), moved...), stay...) {
+		file := node.newFile(filename, []byte(filename))
+		if err := node.localStorage.PutFile(file); err != nil {
+			t.Fatalf("Failed to put %s: %v", filename, err)
+		}
+		versions[filename] = file.Version
+	}
+
+	node.Notify(joiner)
+
+	// the files of the live predecessor are not rebuilt, the files in (oldPredecessor, joiner] are handed off,
+	// and their holders remove the fragments of the node
+	expectLocal(t, node, []string{kept.Key}, false)
+	expectBatches(t, joinerHandler, []string{"StoreFiles"}, moved)
+	expectLocal(t, node, moved, false)
+	expectLocal(t, node, stay, true)
+	delete(versions, stay[0])
+	expectFragmentsDeleted(t, handlers, &node.info, versions)
+}
+
+func TestErasureDelete(t *testing.T) {
+	node, handlers := newErasureNode(t)
+
+	// the owner asks the holders to remove the fragments of its deleted file
+	file := node.newFile("deleted", []byte("deleted data"))
+	if err := node.localStorage.PutFile(file); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	if err := node.DeleteFile("deleted"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	expectFragmentsDeleted(t, handlers, &node.info, map[string]storage.Version{"deleted": file.Version})
+
+	// a holder removes the fragments of the owner, unless they are newer than the delete
+	dead := deadNodeInfo(t, 90)
+	older := storage.Version{WallTime: 1, NodeID: "dead"}
+	newer := storage.Version{WallTime: 2, NodeID: "dead"}
+	spreadFragments(t, node, handlers[0], dead, &storage.File{Key: "gone", Value: []byte("gone data"), Version: older})
+	spreadFragments(t, node, handlers[0], dead, &storage.File{Key: "rewritten", Value: []byte("rewritten data"), Version: newer})
+	if err := node.DeleteFragments(dead, map[string]storage.Version{"gone": older, "rewritten": older}); err != nil {
+		t.Fatalf("Failed to delete fragments: %v", err)
+	}
+	if _, err := node.fragmentStorage.Stat(fragmentKey("gone", 0)); err == nil {
+		t.Fatal("Expected the fragment of the deleted file to be removed")
+	}
+
+	// so the deleted file doesn't come back when its owner dies
+	node.SetPredecessor(dead)
+	node.checkPredecessor()
+	expectLocal(t, node, []string{"gone"}, false)
+	expectLocal(t, node, []string{"rewritten"}, true)
+}
+
+func TestStoreFragmentsPrunesPreviousOwner(t *testing.T) {
+	node, _ := newErasureNode(t)
+	version := storage.Version{WallTime: 1, NodeID: "owner"}
+	previous := &storage.File{Key: fragmentKey("moved", 1), Value: []byte("fragment"), Version: version, Owner: "127.0.0.1:1"}
+	current := &storage.File{Key: fragmentKey("moved", 0), Value: []byte("fragment"), Version: version, Owner: "127.0.0.1:2"}
+	if err := node.StoreFragments(storage.FileList{previous}); err != nil {
+		t.Fatalf("Failed to store fragments: %v", err)
+	}
+	if err := node.StoreFragments(storage.FileList{current}); err != nil {
+		t.Fatalf("Failed to store fragments: %v", err)
+	}
+
+	if _, err := node.fragmentStorage.Stat(previous.Key); err == nil {
+		t.Fatal("Expected the fragment of the previous owner to be pruned")
+	}
+	if _, err := node.fragmentStorage.Stat(current.Key); err != nil {
+		t.Fatalf("Expected the fragment of the new owner to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package node
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chord-dht/chord-core/tools"
+)
+
+// identifierFileName is the file (under statePath) that keeps the node's identifier across restarts.
+const identifierFileName = "identifier"
+
+// resolveIdentifier decides the identifier of the node, in the following order:
+//  1. identifier is not empty: if it is a decimal number, use it directly (it must be in [0, 2^m)),
+//     otherwise use it as a seed and hash it.
+//  2. statePath contains a persisted identifier: use it, so the node keeps its position in the ring after a restart.
+//  3. otherwise, hash the network address, which is the original behaviour.
+//
+// The result is persisted under statePath (if statePath is not empty), so the next start will find it.
+func resolveIdentifier(identifier string, networkAddress string, statePath string) (*big.Int, error) {
+	var result *big.Int
+	var err error
+
+	if identifier != "" {
+		if result, err = parseIdentifier(identifier); err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = tools.GenerateIdentifier(identifier)
+		}
+	} else if result, err = loadIdentifier(statePath); err != nil {
+		return nil, err
+	} else if result == nil {
+		result = tools.GenerateIdentifier(networkAddress)
+	}
+
+	if err := storeIdentifier(statePath, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parseIdentifier parses a decimal identifier, returns (nil, nil) if str is not a decimal number,
+// and an error if it is a number outside [0, 2^m).
+func parseIdentifier(str string) (*big.Int, error) {
+	identifier, success := new(big.Int).SetString(strings.TrimSpace(str), 10)
+	if !success {
+		return nil, nil
+	}
+	if !tools.InInterval(identifier, big.NewInt(0), tools.TwoM, true, false) {
+		return nil, fmt.Errorf("identifier %v is out of range [0, %v)", identifier, tools.TwoM)
+	}
+	return identifier, nil
+}
+
+// loadIdentifier loads the persisted identifier, returns (nil, nil) if there is none.
+func loadIdentifier(statePath string) (*big.Int, error) {
+	if statePath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(statePath, identifierFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading identifier: %w", err)
+	}
+	identifier, err := parseIdentifier(string(data))
+	if err != nil || identifier == nil {
+		return nil, fmt.Errorf("invalid persisted identifier: %q", strings.TrimSpace(string(data)))
+	}
+	return identifier, nil
+}
+
+// storeIdentifier persists the identifier under statePath, do nothing if statePath is empty.
+func storeIdentifier(statePath string, identifier *big.Int) error {
+	if statePath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(statePath, os.ModePerm); err != nil {
+		return fmt.Errorf("error creating state directory: %w", err)
+	}
+	filePath := filepath.Join(statePath, identifierFileName)
+	if err := os.WriteFile(filePath, []byte(identifier.String()+"\n"), 0644); err != nil {
+		return fmt.Errorf("error writing identifier: %w", err)
+	}
+	return nil
+}
+
+// IdentifierCollision checks if two NodeInfo have the same identifier but different network addresses.
+// Such two nodes can't live in the same ring, as InfoEqual would treat them as the same node.
+func IdentifierCollision(nodeInfo1 *NodeInfo, nodeInfo2 *NodeInfo) bool {
+	idBool := nodeInfo1.Identifier.Cmp(nodeInfo2.Identifier) == 0
+	addressBool := nodeInfo1.IpAddress == nodeInfo2.IpAddress && nodeInfo1.Port == nodeInfo2.Port
+	return idBool && !addressBool
+}
@@ -0,0 +1,49 @@
+package node
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/chord-dht/chord-core/tools"
+)
+
+func TestResolveIdentifier(t *testing.T) {
+	last := new(big.Int).Sub(tools.TwoM, big.NewInt(1))
+
+	tests := []struct {
+		identifier string
+		expected   *big.Int
+		fail       bool
+	}{
+		{"0", big.NewInt(0), false},
+		{last.String(), last, false},
+		{tools.TwoM.String(), nil, true},
+		{"-1", nil, true},
+		{"seed", tools.GenerateIdentifier("seed"), false},
+		{"", tools.GenerateIdentifier("127.0.0.1:8000"), false},
+	}
+	for _, tt := range tests {
+		identifier, err := resolveIdentifier(tt.identifier, "127.0.0.1:8000", "")
+		if tt.fail {
+			if err == nil {
+				t.Errorf("resolveIdentifier(%q) = %v, expected an error", tt.identifier, identifier)
+			}
+			continue
+		}
+		if err != nil || identifier.Cmp(tt.expected) != 0 {
+			t.Errorf("resolveIdentifier(%q) = %v, %v, expected %v", tt.identifier, identifier, err, tt.expected)
+		}
+	}
+}
+
+func TestResolveIdentifierPersisted(t *testing.T) {
+	statePath := t.TempDir()
+
+	if _, err := resolveIdentifier("42", "127.0.0.1:8000", statePath); err != nil {
+		t.Fatalf("Failed to resolve identifier: %v", err)
+	}
+	identifier, err := resolveIdentifier("", "127.0.0.1:8000", statePath)
+	if err != nil || identifier.Cmp(big.NewInt(42)) != 0 {
+		t.Fatalf("Expected the persisted identifier 42, got %v, %v", identifier, err)
+	}
+}
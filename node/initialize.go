@@ -2,18 +2,43 @@ package node
 
 import (
 	"fmt"
+	"net"
 	"time"
+
+	"github.com/chord-dht/chord-core/discovery"
 )
 
-// Initialize begins the node, create or join
+// Initialize begins the node, create, join or rejoin.
+// It is a shortcut of InitializeWithSeeds with a single seed joinAddress:joinPort (ignored if joinAddress is empty).
 func (node *Node) Initialize(mode, joinAddress, joinPort string) error {
+	var seeds []string
+	if joinAddress != "" {
+		seeds = []string{net.JoinHostPort(joinAddress, joinPort)}
+	}
+	return node.InitializeWithSeeds(mode, seeds)
+}
+
+// InitializeWithSeeds begins the node, create, join or rejoin.
+// In "join" mode, the seeds ("host:port") are pinged in parallel and the live ones are tried in order,
+// the discoverers are only consulted when none of the seeds works.
+// In "rejoin" mode, the node tries the nodes it knew before the restart (persisted in statePath) first,
+// and falls back to the seeds and the discoverers when none of them is reachable.
+func (node *Node) InitializeWithSeeds(mode string, seeds []string, discoverers ...discovery.Discoverer) error {
 	switch mode {
 	case "create":
 		node.create()
 	case "join":
-		if err := node.joinRing(joinAddress, joinPort); err != nil {
+		if err := node.joinSeeds(seeds, discoverers); err != nil {
 			return fmt.Errorf("joinRing failed, error: %v", err)
 		}
+	case "rejoin":
+		if err := node.rejoinRing(); err != nil {
+			if err := node.joinSeeds(seeds, discoverers); err != nil {
+				return fmt.Errorf("rejoinRing failed, error: %v", err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown mode: %s", mode)
 	}
 
 	// register it in rpc and start the server
@@ -24,6 +49,15 @@ func (node *Node) Initialize(mode, joinAddress, joinPort string) error {
 	// start the periodic tasks
 	node.StartPeriodicTasks()
 
+	// the transfers interrupted by a crash are resumed,
+	// then the files found on disk at startup may belong to other nodes now
+	go func() {
+		node.recoverTransfers()
+		if mode != "create" {
+			node.reconcileAfterJoin()
+		}
+	}()
+
 	return nil
 }
 
@@ -42,7 +76,7 @@ func (node *Node) joinRing(joinAddress, joinPort string) error {
 		return fmt.Errorf("try to get join node Info failed, error: %v", err)
 	}
 
-	// They should have the same IdentifierLength and SuccessorsLength
+	// They should have the same IdentifierLength, SuccessorsLength and ReplicationMode
 	// Otherwise, the join operation will fail
 	reply, err := joinNode.GetLength()
 	if err != nil {
@@ -51,6 +85,12 @@ func (node *Node) joinRing(joinAddress, joinPort string) error {
 	if reply.IdentifierLength != node.identifierLength || reply.SuccessorsLength != node.successorsLength {
 		return fmt.Errorf("the join node has different IdentifierLength or SuccessorsLength")
 	}
+	if reply.ReplicationMode != node.replicationMode {
+		return fmt.Errorf("the join node has different ReplicationMode: %s", reply.ReplicationMode)
+	}
+	if node.encoder != nil && (reply.TotalShards != node.encoder.TotalShards() || reply.DataShards != node.encoder.DataShards()) {
+		return fmt.Errorf("the join node has different erasure coding: %d of %d fragments", reply.DataShards, reply.TotalShards)
+	}
 
 	// join the chord ring
 	if err := node.join(joinNode); err != nil {
@@ -71,6 +111,11 @@ func (node *Node) join(joinNode *NodeInfo) error {
 	if err := nodeInfo.LiveCheck(); err != nil {
 		return fmt.Errorf("%v.find_successor(%v) has bad result: %v", joinNode, node.info, err)
 	}
+	// the successor of our identifier is the node holding the same identifier (if any),
+	// if it is another live node, we can't join, otherwise both of us will be treated as the same node
+	if IdentifierCollision(nodeInfo, &node.info) {
+		return fmt.Errorf("identifier %v collides with the live node %v:%v", node.info.Identifier, nodeInfo.IpAddress, nodeInfo.Port)
+	}
 
 	node.SetFirstSuccessor(nodeInfo)
 	return nil
@@ -80,6 +125,9 @@ func (node *Node) StartPeriodicTasks() {
 	go node.periodicStabilize(node.stabilizeTime)
 	go node.periodicFixFingers(node.fixFingersTime)
 	go node.periodicCheckPredecessor(node.checkPredecessorTime)
+	go node.periodicSaveRoutingState(node.saveRoutingStateTime)
+	go node.periodicReapExpired(reapExpiredTime)
+	go node.periodicScrub(scrubTime)
 
 	// Sleep for a duration to allow periodic tasks to stabilize
 	time.Sleep(5 * time.Second) // Adjust the duration as needed
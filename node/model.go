@@ -4,11 +4,13 @@ import (
 	"crypto/tls"
 	"fmt"
 	"math/big"
+	"net"
 	"path/filepath"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/chord-dht/chord-core/erasure"
 	"github.com/chord-dht/chord-core/storage"
 	"github.com/chord-dht/chord-core/tools"
 )
@@ -47,6 +49,11 @@ func (nodeInfo *NodeInfo) Empty() bool {
 	return b1 || b2 || b3
 }
 
+// Address returns the network address (ip:port, [ip]:port for IPv6) of the node.
+func (nodeInfo *NodeInfo) Address() string {
+	return net.JoinHostPort(nodeInfo.IpAddress, nodeInfo.Port)
+}
+
 // Check if two NodeInfo are equal, the equality is defined by the identifier or the network address
 // If the identifier is equal, then the two NodeInfo are equal
 // If the network address is equal, then the two NodeInfo are equal
@@ -67,6 +74,8 @@ type Node struct {
 	identifierLength int // Important
 	successorsLength int // Important
 
+	statePath string // directory for the node's own state, empty means no persistence
+
 	info        NodeInfo
 	predecessor *NodeInfo
 	successors  NodeInfoList
@@ -77,12 +86,29 @@ type Node struct {
 	muSuc sync.RWMutex
 	muFin sync.RWMutex
 
-	localStorage   storage.Storage   // Storage for this node
-	backupStorages []storage.Storage // Storages for successor nodes
+	localStorage    storage.Storage   // Storage for this node
+	backupStorages  []storage.Storage // Storages for successor nodes
+	fragmentStorage storage.Storage   // Storage for the fragments of other nodes' files, only used in ReplicationErasure
+
+	clock *storage.Clock // hybrid logical clock, versions the writes of the node
+
+	replicationMode  string           // replica placement, ReplicationPull, ReplicationPush or ReplicationErasure
+	encoder          *erasure.Encoder // only used in ReplicationErasure
+	pushedSuccessors NodeInfoList     // successors which have got the full file list, only used in ReplicationPush
+	replicasDirty    bool             // the local files changed in bulk since the last push, only used in ReplicationPush
+	muPush           sync.Mutex
+	replicaOwners    NodeInfoList // owners of the replicas in backupStorages, only used in ReplicationPush
+	muReplicaOwners  sync.Mutex
+
+	replicationN int // number of copies, the node itself and N-1 replica holders
+	replicationW int // write quorum
+	replicationR int // read quorum
+	muQuorum     sync.RWMutex
 
 	stabilizeTime        time.Duration
 	fixFingersTime       time.Duration
 	checkPredecessorTime time.Duration
+	saveRoutingStateTime time.Duration
 
 	shutdownCh chan struct{} // channel for shutdown
 
@@ -91,6 +117,19 @@ type Node struct {
 	clientTLSConfig *tls.Config
 }
 
+// NodeOptions are the optional settings of a node, the zero value gives the node of NewNode.
+type NodeOptions struct {
+	// Identifier can be a decimal identifier in [0, 2^m) or a seed to be hashed,
+	// if it is empty, the identifier persisted in StatePath is used, or the hash of ip:port for a fresh node.
+	Identifier string
+	// StatePath is the directory for the node's own state (e.g. the identifier), it can be empty to persist nothing.
+	StatePath string
+	// SaveRoutingStateTime is the interval of the routing state persistence in StatePath, in milliseconds as the other
+	// intervals, zero for the default.
+	SaveRoutingStateTime time.Duration
+}
+
+// NewNode creates a new chord node, with the identifier hashed from ip:port and no persisted state.
 func NewNode(
 	identifierLength int,
 	successorsLength int,
@@ -105,15 +144,39 @@ func NewNode(
 	tlsBool bool,
 	serverTLSConfig *tls.Config,
 	clientTLSConfig *tls.Config,
+) (*Node, error) {
+	return NewNodeWithOptions(identifierLength, successorsLength, ipAddress, port, storageFactory, storagePath, backupPath,
+		stabilizeTime, fixFingersTime, checkPredecessorTime, tlsBool, serverTLSConfig, clientTLSConfig, NodeOptions{})
+}
+
+// NewNodeWithOptions creates a new chord node with the optional settings, see NodeOptions.
+func NewNodeWithOptions(
+	identifierLength int,
+	successorsLength int,
+	ipAddress string,
+	port string,
+	storageFactory func(string) (storage.Storage, error),
+	storagePath string,
+	backupPath string,
+	stabilizeTime time.Duration,
+	fixFingersTime time.Duration,
+	checkPredecessorTime time.Duration,
+	tlsBool bool,
+	serverTLSConfig *tls.Config,
+	clientTLSConfig *tls.Config,
+	options NodeOptions,
 ) (*Node, error) {
 	// you have to set the identifier length for the tools package first
 	tools.SetIdentifierLength(identifierLength)
 
-	networkAddress := ipAddress + ":" + port
-	identifier := tools.GenerateIdentifier(networkAddress)
+	networkAddress := net.JoinHostPort(ipAddress, port)
+	nodeIdentifier, err := resolveIdentifier(options.Identifier, networkAddress, options.StatePath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving identifier: %w", err)
+	}
 
 	nodeInfo := NodeInfo{
-		Identifier: identifier,
+		Identifier: nodeIdentifier,
 		IpAddress:  ipAddress,
 		Port:       port,
 	}
@@ -132,9 +195,15 @@ func NewNode(
 		}
 	}
 
+	fragmentStorage, err := storageFactory(filepath.Join(backupPath, "fragments"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating fragment storage: %w", err)
+	}
+
 	node := &Node{
 		identifierLength:     identifierLength,
 		successorsLength:     successorsLength,
+		statePath:            options.StatePath,
 		info:                 nodeInfo,
 		predecessor:          NewNodeInfo(),
 		successors:           make(NodeInfoList, successorsLength), // fixed size, should not use append later, but use index
@@ -142,18 +211,33 @@ func NewNode(
 		fingerIndex:          make([]*big.Int, identifierLength),
 		localStorage:         localStorage,
 		backupStorages:       backupStorages,
+		fragmentStorage:      fragmentStorage,
+		clock:                storage.NewClock(networkAddress),
+		replicationMode:      ReplicationPull,
+		pushedSuccessors:     make(NodeInfoList, successorsLength),
+		replicaOwners:        make(NodeInfoList, successorsLength),
+		replicationN:         1,
+		replicationW:         1,
+		replicationR:         1,
 		stabilizeTime:        stabilizeTime,
 		fixFingersTime:       fixFingersTime,
 		checkPredecessorTime: checkPredecessorTime,
+		saveRoutingStateTime: options.SaveRoutingStateTime,
 		shutdownCh:           make(chan struct{}),
 		tlsBool:              tlsBool,
 		serverTLSConfig:      serverTLSConfig,
 		clientTLSConfig:      clientTLSConfig,
 	}
 
+	if node.saveRoutingStateTime == 0 {
+		node.saveRoutingStateTime = defaultSaveRoutingStateTime
+	}
+
 	// Initialize each NodeInfo
 	for i := 0; i < successorsLength; i++ {
 		node.successors[i] = NewNodeInfo()
+		node.pushedSuccessors[i] = NewNodeInfo()
+		node.replicaOwners[i] = NewNodeInfo()
 	}
 	for i := 0; i < identifierLength; i++ {
 		node.fingerTable[i] = NewNodeInfo()
@@ -0,0 +1,22 @@
+package node
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		ipAddress, port, expected string
+	}{
+		{"127.0.0.1", "8000", "127.0.0.1:8000"},
+		{"::1", "8000", "[::1]:8000"},
+		{"fe80::1", "8000", "[fe80::1]:8000"},
+	}
+	for _, tt := range tests {
+		nodeInfo := &NodeInfo{Identifier: big.NewInt(0), IpAddress: tt.ipAddress, Port: tt.port}
+		if address := nodeInfo.Address(); address != tt.expected {
+			t.Errorf("Address() = %s, expected %s", address, tt.expected)
+		}
+	}
+}
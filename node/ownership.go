@@ -0,0 +1,62 @@
+package node
+
+import (
+	"math/big"
+
+	"github.com/chord-dht/chord-core/storage"
+	"github.com/chord-dht/chord-core/tools"
+)
+
+// isResponsible checks if the node is responsible for the identifier, that is, identifier in (predecessor, node].
+// If the predecessor is empty or dead, the node is responsible for everything before it,
+// as it will take over the predecessor's range after checkPredecessor anyway.
+func (node *Node) isResponsible(identifier *big.Int) bool {
+	predecessor := node.GetPredecessor()
+	if inRange(predecessor, &node.info, identifier) {
+		return true
+	}
+	return predecessor.LiveCheck() != nil
+}
+
+// inRange checks if the identifier is in (predecessor, nodeInfo], an empty predecessor means the whole ring.
+func inRange(predecessor *NodeInfo, nodeInfo *NodeInfo, identifier *big.Int) bool {
+	if predecessor.Empty() || InfoEqual(predecessor, nodeInfo) {
+		return true
+	}
+	return tools.ModIntervalCheck(identifier, predecessor.Identifier, nodeInfo.Identifier, false, true)
+}
+
+// misroutedFiles returns the keys of the files that the node is not responsible for.
+// The predecessor is checked (at most once) only if some of the keys are out of the range.
+func (node *Node) misroutedFiles(fileList storage.FileList) []string {
+	predecessor := node.GetPredecessor()
+
+	var misrouted []string
+	for _, file := range fileList {
+		if !inRange(predecessor, &node.info, tools.GenerateIdentifier(file.Key)) {
+			misrouted = append(misrouted, file.Key)
+		}
+	}
+	if len(misrouted) > 0 && predecessor.LiveCheck() != nil {
+		return nil
+	}
+	return misrouted
+}
+
+// findOwner finds the node responsible for the identifier, starting from the node itself.
+func (node *Node) findOwner(identifier *big.Int) (*NodeInfo, error) {
+	found, nodeInfo := node.FindSuccessor(identifier)
+	if found {
+		return nodeInfo, nil
+	}
+	return nodeInfo.FindSuccessorIter(identifier)
+}
+
+// ownerHint finds the owner of the key for a misrouted request, returns an empty NodeInfo if it can't be found.
+func (node *Node) ownerHint(key string) NodeInfo {
+	owner, err := node.findOwner(tools.GenerateIdentifier(key))
+	if err != nil {
+		return *NewNodeInfo()
+	}
+	return *owner
+}
@@ -27,7 +27,7 @@ func (nodeInfo *NodeInfo) LiveCheck() error {
 
 // Ping checks if the remote node can be connected.
 func (nodeInfo *NodeInfo) Ping() error {
-	address := nodeInfo.IpAddress + ":" + nodeInfo.Port
+	address := nodeInfo.Address()
 
 	var conn net.Conn = nil
 	var err error = nil
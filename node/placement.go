@@ -0,0 +1,332 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chord-dht/chord-core/storage"
+	"github.com/chord-dht/chord-core/tools"
+)
+
+/*
+ * Replica placement.
+ *
+ * ReplicationPull (default): every node pulls the files of its successors, successors[i]'s files are kept in
+ * backupStorages[i], so the replicas of a node's files live in its predecessors. They are regenerated every stabilize.
+ *
+ * ReplicationPush (classic Chord/DHash): the owner pushes its files to its successors, successors[i] keeps them in
+ * backupStorages[i], so the replicas of a node's files live in its successors. A successor gets the full file list
+ * only when it becomes a new successor or when the owner's files change in bulk (handoff), single writes are pushed
+ * as they come, and so are the deletes. When predecessors leave or die, the node promotes the replicas of the ones
+ * whose range it takes over to its own.
+ *
+ * ReplicationErasure: see erasure.go.
+ *
+ * All the nodes of a ring should use the same placement, it is checked when joining.
+ */
+
+const (
+	ReplicationPull = "pull"
+	ReplicationPush = "push"
+)
+
+// SetReplicationMode sets the replica placement of the node, it should be called before Initialize.
+// ReplicationErasure needs the number of fragments, so it is set by SetErasureCoding.
+func (node *Node) SetReplicationMode(mode string) error {
+	switch mode {
+	case ReplicationPull, ReplicationPush:
+		node.replicationMode = mode
+		return nil
+	default:
+		return fmt.Errorf("unknown replication mode: %s", mode)
+	}
+}
+
+// GetReplicationMode returns the replica placement of the node.
+func (node *Node) GetReplicationMode() string {
+	return node.replicationMode
+}
+
+// markReplicasDirty records that the local files changed in bulk, so the next pushReplicas sends the full list again.
+func (node *Node) markReplicasDirty() {
+	if node.replicationMode == ReplicationPull {
+		return
+	}
+	node.muPush.Lock()
+	defer node.muPush.Unlock()
+	node.replicasDirty = true
+}
+
+// pushReplicas sends the full local file list (or its fragments in ReplicationErasure) to every successor
+// that hasn't got it yet: a new successor, or all of them if the local files changed in bulk since the last push.
+// The local files are walked once, in batches of about transferBatchBytes (see walkFiles), every batch is sent to
+// all those successors: the first one replaces their replicas, the next ones are appended to them.
+func (node *Node) pushReplicas() error {
+	node.muPush.Lock()
+	defer node.muPush.Unlock()
+
+	var targets []int
+	successors := node.GetSuccessors()
+	for i, successor := range successors {
+		if successor.Empty() || InfoEqual(successor, &node.info) {
+			node.pushedSuccessors[i] = NewNodeInfo()
+			continue
+		}
+		if !node.replicasDirty && InfoEqual(node.pushedSuccessors[i], successor) {
+			continue
+		}
+		targets = append(targets, i)
+	}
+
+	failed := make(map[int]bool)
+	first := true
+	push := func(fileList storage.FileList) error {
+		for _, i := range targets {
+			if !failed[i] && node.pushTo(successors[i], fileList, i, !first) != nil {
+				failed[i] = true
+			}
+		}
+		first = false
+		if len(failed) == len(targets) {
+			return storage.ErrStop
+		}
+		return nil
+	}
+	if len(targets) > 0 {
+		all := func(string) bool { return true }
+		if err := walkFiles(node.localStorage, all, push); err != nil {
+			for _, i := range targets {
+				node.pushedSuccessors[i] = NewNodeInfo()
+			}
+			return err
+		}
+		if first {
+			// no local file, the replicas are replaced by an empty list
+			_ = push(nil)
+		}
+	}
+
+	var finalErr error
+	for _, i := range targets {
+		if failed[i] {
+			node.pushedSuccessors[i] = NewNodeInfo()
+			finalErr = fmt.Errorf("failed to push replicas to %v", successors[i])
+			continue
+		}
+		node.pushedSuccessors[i] = successors[i]
+	}
+	if finalErr == nil {
+		node.replicasDirty = false
+	}
+	return finalErr
+}
+
+// pushTo sends the file list to successors[index], or its fragments in ReplicationErasure.
+// The file list replaces the replicas of the successor, or is appended to them if appending.
+func (node *Node) pushTo(successor *NodeInfo, fileList storage.FileList, index int, appending bool) error {
+	if node.replicationMode == ReplicationErasure {
+		return node.pushFragments(successor, fileList, index)
+	}
+	var reply *BoolReply
+	var err error
+	if appending {
+		reply, err = successor.AppendReplicas(&node.info, fileList, index)
+	} else {
+		reply, err = successor.ReplaceReplicas(&node.info, fileList, index)
+	}
+	if err != nil {
+		return err
+	}
+	if !reply.Success {
+		return fmt.Errorf("failed to store the replicas on %v", successor)
+	}
+	return nil
+}
+
+// ReplaceReplicas replaces the files in backupStorages[index] with the owner's full file list.
+// If backupStorages[0] still keeps the replicas of a dead predecessor, they are promoted before being replaced.
+func (node *Node) ReplaceReplicas(owner *NodeInfo, fileList storage.FileList, index int) error {
+	if index < 0 || index >= node.successorsLength {
+		return fmt.Errorf("index out of range: %d", index)
+	}
+
+	node.muReplicaOwners.Lock()
+	defer node.muReplicaOwners.Unlock()
+
+	oldOwner := node.replicaOwners[index]
+	if index == 0 && !oldOwner.Empty() && !InfoEqual(oldOwner, owner) && oldOwner.LiveCheck() != nil {
+		if err := node.promoteReplicasLocked(0); err != nil {
+			return err
+		}
+	}
+
+	if err := node.backupStorages[index].Clear(); err != nil {
+		return err
+	}
+	if err := node.backupStorages[index].PutFiles(fileList); err != nil {
+		node.replicaOwners[index] = NewNodeInfo()
+		return err
+	}
+	node.replicaOwners[index] = owner
+	return nil
+}
+
+// AppendReplicas adds the files to backupStorages[index], used by the owner pushing its file list in batches after
+// the first one, sent with ReplaceReplicas. It fails if the backup storage doesn't keep the owner's replicas (anymore),
+// so the owner pushes its file list again from the start.
+func (node *Node) AppendReplicas(owner *NodeInfo, fileList storage.FileList, index int) error {
+	if index < 0 || index >= node.successorsLength {
+		return fmt.Errorf("index out of range: %d", index)
+	}
+
+	node.muReplicaOwners.Lock()
+	defer node.muReplicaOwners.Unlock()
+
+	if !InfoEqual(node.replicaOwners[index], owner) {
+		return fmt.Errorf("backup storage %d doesn't keep the replicas of %v", index, owner)
+	}
+	if err := node.backupStorages[index].PutFiles(fileList); err != nil {
+		node.replicaOwners[index] = NewNodeInfo()
+		return err
+	}
+	return nil
+}
+
+// DeleteReplica removes the file from backupStorages[index], used by the owner of the file when it deletes it.
+// A replica with another version (e.g. written after the delete) is kept, and so is a missing replica.
+func (node *Node) DeleteReplica(filename string, version storage.Version, index int) error {
+	if index < 0 || index >= node.successorsLength {
+		return fmt.Errorf("index out of range: %d", index)
+	}
+	_, err := node.backupStorages[index].DeleteIfVersion(filename, version)
+	if err != nil && !errors.Is(err, storage.ErrVersionMismatch) && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// promoteReplicas takes over the files of the predecessors that are leaving or dead (only in ReplicationPush):
+// the backup storages whose owner is now in (newPredecessor, node) keep files of the node's range,
+// they are moved into the local storage. If the new predecessor is not known yet (it is empty),
+// the backup storages of the dead owners are promoted, from backupStorages[0] until the first live owner,
+// so several adjacent predecessors dying together are all taken over.
+// In ReplicationErasure, the files of the dead owners in the node's range are rebuilt from the fragments instead.
+func (node *Node) promoteReplicas(newPredecessor *NodeInfo) {
+	if node.replicationMode == ReplicationErasure {
+		node.reconstructOrphans(newPredecessor)
+		return
+	}
+	if node.replicationMode != ReplicationPush {
+		return
+	}
+
+	node.muReplicaOwners.Lock()
+	defer node.muReplicaOwners.Unlock()
+
+	for i, owner := range node.replicaOwners {
+		if newPredecessor.Empty() {
+			if owner.Empty() || owner.LiveCheck() == nil {
+				return
+			}
+		} else if owner.Empty() || !tools.ModIntervalCheck(owner.Identifier, newPredecessor.Identifier, node.info.Identifier, false, false) {
+			continue
+		}
+		_ = node.promoteReplicasLocked(i)
+	}
+}
+
+// promoteReplicasLocked moves the files in backupStorages[index] into the local storage.
+// The caller should hold muReplicaOwners.
+func (node *Node) promoteReplicasLocked(index int) error {
+	fileList, err := node.backupStorages[index].GetAllFiles()
+	if err != nil {
+		return err
+	}
+	if len(fileList) > 0 {
+		if err := node.StoreFiles(fileList); err != nil {
+			return err
+		}
+	}
+	if err := node.backupStorages[index].Clear(); err != nil {
+		return err
+	}
+	node.replicaOwners[index] = NewNodeInfo()
+	return nil
+}
+
+// deleteReplicas removes the replicas of a file deleted from the node at the version, in ReplicationPush.
+// A successor which doesn't get the delete gets the full file list in the next push.
+// In ReplicationErasure, the holders of the fragments remove them.
+func (node *Node) deleteReplicas(filename string, version storage.Version) {
+	switch node.replicationMode {
+	case ReplicationPush:
+		for _, holder := range node.replicaHolders(node.successorsLength) {
+			go func(holder replicaHolder) {
+				reply, err := holder.nodeInfo.DeleteReplica(filename, version, holder.index)
+				if err != nil || !reply.Success {
+					node.markReplicasDirty()
+				}
+			}(holder)
+		}
+	case ReplicationErasure:
+		node.deleteFragments(map[string]storage.Version{filename: version})
+	}
+}
+
+/*                             RPC Part                             */
+
+// ReplaceReplicas is a wrap of ReplaceReplicasRPC method
+func (nodeInfo *NodeInfo) ReplaceReplicas(owner *NodeInfo, fileList storage.FileList, index int) (*BoolReply, error) {
+	args := &ReplaceReplicasArgs{
+		Owner:    *owner,
+		FileList: fileList,
+		Index:    index,
+	}
+	reply := &BoolReply{}
+	err := nodeInfo.callRPC("ReplaceReplicasRPC", args, reply)
+	return reply, err
+}
+
+// ReplaceReplicasRPC : Replace the files in the node's backup storage with the owner's file list
+func (handler *RPCHandler) ReplaceReplicasRPC(args *ReplaceReplicasArgs, reply *BoolReply) error {
+	reply.Success = localNode.ReplaceReplicas(&args.Owner, args.FileList, args.Index) == nil
+	return nil
+}
+
+// AppendReplicas is a wrap of AppendReplicasRPC method
+func (nodeInfo *NodeInfo) AppendReplicas(owner *NodeInfo, fileList storage.FileList, index int) (*BoolReply, error) {
+	args := &ReplaceReplicasArgs{
+		Owner:    *owner,
+		FileList: fileList,
+		Index:    index,
+	}
+	reply := &BoolReply{}
+	err := nodeInfo.callRPC("AppendReplicasRPC", args, reply)
+	return reply, err
+}
+
+// AppendReplicasRPC : Add the owner's files to the node's backup storage, after ReplaceReplicasRPC
+func (handler *RPCHandler) AppendReplicasRPC(args *ReplaceReplicasArgs, reply *BoolReply) error {
+	reply.Success = localNode.AppendReplicas(&args.Owner, args.FileList, args.Index) == nil
+	return nil
+}
+
+// DeleteReplica is a wrap of DeleteReplicaRPC method
+func (nodeInfo *NodeInfo) DeleteReplica(filename string, version storage.Version, index int) (*BoolReply, error) {
+	args := &DeleteReplicaArgs{
+		Filename: filename,
+		Version:  version,
+		Index:    index,
+	}
+	reply := &BoolReply{}
+	err := nodeInfo.callRPC("DeleteReplicaRPC", args, reply)
+	return reply, err
+}
+
+// DeleteReplicaRPC : Remove the file from the node's backup storage
+func (handler *RPCHandler) DeleteReplicaRPC(args *DeleteReplicaArgs, reply *BoolReply) error {
+	reply.Success = localNode.DeleteReplica(args.Filename, args.Version, args.Index) == nil
+	return nil
+}
+
+/*                             RPC Part                             */
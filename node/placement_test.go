@@ -0,0 +1,170 @@
+package node
+
+import (
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chord-dht/chord-core/memory"
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// newTestNode creates a node with the identifier in a ring of 2^8 identifiers, keeping its files in memory.
+func newTestNode(t *testing.T, identifier string) *Node {
+	t.Helper()
+	return newTestNodeWithStorage(t, identifier, memory.MemoryStorageFactory)
+}
+
+// newTestNodeWithStorage creates a node with the identifier in a ring of 2^8 identifiers, keeping its files in the
+// storages created by the factory.
+func newTestNodeWithStorage(t *testing.T, identifier string, factory func(string) (storage.Storage, error)) *Node {
+	t.Helper()
+	node, err := NewNodeWithOptions(8, 3, "127.0.0.1", "0", factory, t.TempDir(), t.TempDir(),
+		time.Second, time.Second, time.Second, false, nil, nil, NodeOptions{Identifier: identifier})
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	t.Cleanup(func() { localNode = nil })
+	return node
+}
+
+// liveNodeInfo returns a node answering the pings, until the end of the test.
+func liveNodeInfo(t *testing.T, identifier int64) *NodeInfo {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return &NodeInfo{Identifier: big.NewInt(identifier), IpAddress: "127.0.0.1", Port: port}
+}
+
+// deadNodeInfo returns a node which doesn't answer the pings.
+func deadNodeInfo(t *testing.T, identifier int64) *NodeInfo {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+	return &NodeInfo{Identifier: big.NewInt(identifier), IpAddress: "127.0.0.1", Port: port}
+}
+
+// setupReplicas gives the node the replicas of its three predecessors p1, p2 and p3, one file each.
+func setupReplicas(t *testing.T, node *Node, owners ...*NodeInfo) {
+	t.Helper()
+	for i, owner := range owners {
+		files := storage.FileList{{Key: owner.Port, Value: []byte(owner.Port), Version: node.clock.Now()}}
+		if err := node.ReplaceReplicas(owner, files, i); err != nil {
+			t.Fatalf("Failed to replace replicas %d: %v", i, err)
+		}
+	}
+}
+
+// expectPromoted checks which replicas were moved into the local storage of the node.
+func expectPromoted(t *testing.T, node *Node, owners []*NodeInfo, promoted []bool) {
+	t.Helper()
+	for i, owner := range owners {
+		_, err := node.localStorage.Get(owner.Port)
+		if (err == nil) != promoted[i] {
+			t.Fatalf("Expected the replicas of %v promoted: %v, got %v", owner, promoted[i], err)
+		}
+		if promoted[i] != node.replicaOwners[i].Empty() {
+			t.Fatalf("Expected the owner of backup storage %d to be cleared: %v, got %v", i, promoted[i], node.replicaOwners[i])
+		}
+	}
+}
+
+func TestPromoteReplicasAdjacentDead(t *testing.T) {
+	node := newTestNode(t, "100")
+	node.SetReplicationMode(ReplicationPush)
+
+	// p1 and p2 die together, p3 is still alive
+	owners := []*NodeInfo{deadNodeInfo(t, 90), deadNodeInfo(t, 80), liveNodeInfo(t, 70)}
+	setupReplicas(t, node, owners...)
+	node.SetPredecessor(owners[0])
+
+	node.checkPredecessor()
+
+	if !node.GetPredecessor().Empty() {
+		t.Fatalf("Expected the dead predecessor to be removed, got %v", node.GetPredecessor())
+	}
+	expectPromoted(t, node, owners, []bool{true, true, false})
+}
+
+func TestPromoteReplicasNewPredecessor(t *testing.T) {
+	node := newTestNode(t, "100")
+	node.SetReplicationMode(ReplicationPush)
+
+	// the replicas of p1 and p2 are still there when p3 becomes the predecessor
+	owners := []*NodeInfo{deadNodeInfo(t, 90), deadNodeInfo(t, 80), liveNodeInfo(t, 70)}
+	setupReplicas(t, node, owners...)
+
+	node.Notify(owners[2])
+
+	if !InfoEqual(node.GetPredecessor(), owners[2]) {
+		t.Fatalf("Expected %v as predecessor, got %v", owners[2], node.GetPredecessor())
+	}
+	expectPromoted(t, node, owners, []bool{true, true, false})
+}
+
+func TestDeleteReplica(t *testing.T) {
+	node := newTestNode(t, "100")
+
+	older := storage.Version{WallTime: 1, NodeID: "owner"}
+	newer := storage.Version{WallTime: 2, NodeID: "owner"}
+	node.StoreReplica(&storage.File{Key: "deleted", Value: []byte("deleted"), Version: older}, 0)
+	node.StoreReplica(&storage.File{Key: "rewritten", Value: []byte("rewritten"), Version: newer}, 0)
+
+	for _, key := range []string{"deleted", "rewritten", "missing"} {
+		if err := node.DeleteReplica(key, older, 0); err != nil {
+			t.Fatalf("Failed to delete replica %s: %v", key, err)
+		}
+	}
+	if _, err := node.GetReplica("deleted", 0); err == nil {
+		t.Fatal("Expected the replica to be deleted")
+	}
+	if file, err := node.GetReplica("rewritten", 0); err != nil || file.Version != newer {
+		t.Fatalf("Expected the newer replica to be kept, got %v, %v", file, err)
+	}
+	if err := node.DeleteReplica("deleted", older, 3); err == nil {
+		t.Fatal("Expected an error for an index out of range")
+	}
+}
+
+func TestPushReplicasInBatches(t *testing.T) {
+	node := newTestNodeWithStorage(t, "100", streamOnlyFactory(t))
+	node.SetReplicationMode(ReplicationPush)
+	successor, handler := recordingNodeInfo(t, 110)
+	node.SetSuccessor(0, successor)
+
+	keys := ownedKeys(t, big.NewInt(0), big.NewInt(0), 12)
+	putLargeFiles(t, node, keys)
+	node.markReplicasDirty()
+
+	if err := node.pushReplicas(); err != nil {
+		t.Fatalf("Failed to push replicas: %v", err)
+	}
+	expectBatches(t, handler, []string{"ReplaceReplicas", "AppendReplicas", "AppendReplicas"}, keys)
+
+	// without local file, the replicas are replaced by an empty list
+	node.localStorage.Clear()
+	node.markReplicasDirty()
+	handler.methods, handler.batches = nil, nil
+	if err := node.pushReplicas(); err != nil {
+		t.Fatalf("Failed to push replicas: %v", err)
+	}
+	expectBatches(t, handler, []string{"ReplaceReplicas"}, nil)
+}
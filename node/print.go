@@ -3,29 +3,42 @@ package node
 import (
 	"fmt"
 	"math/big"
+	"time"
 
+	"github.com/chord-dht/chord-core/storage"
 	"github.com/chord-dht/chord-core/tools"
 )
 
 type NodeState struct {
-	Info               NodeInfo     `json:"info"`
-	Predecessor        *NodeInfo    `json:"predecessor"`
-	Successors         NodeInfoList `json:"successors"`
-	FingerTable        NodeInfoList `json:"fingerTable"`
-	FingerIndex        []*big.Int   `json:"fingerIndex"`
-	LocalStorageName   []string     `json:"localStorageName"`
-	BackupStoragesName [][]string   `json:"backupStoragesName"`
+	Info               NodeInfo            `json:"info"`
+	Predecessor        *NodeInfo           `json:"predecessor"`
+	Successors         NodeInfoList        `json:"successors"`
+	FingerTable        NodeInfoList        `json:"fingerTable"`
+	FingerIndex        []*big.Int          `json:"fingerIndex"`
+	LocalStorageName   []string            `json:"localStorageName"`
+	LocalStorageInfo   []*storage.FileInfo `json:"localStorageInfo"`
+	BackupStoragesName [][]string          `json:"backupStoragesName"`
+	ReplicationMode    string              `json:"replicationMode"`
 }
 
 func (node *Node) GetState() *NodeState {
+	filesName := node.GetFilesName()
+	filesInfo := make([]*storage.FileInfo, 0, len(filesName))
+	for _, filename := range filesName {
+		if info, err := node.Stat(filename); err == nil {
+			filesInfo = append(filesInfo, info)
+		}
+	}
 	return &NodeState{
 		Info:               node.info,
 		Predecessor:        node.GetPredecessor(),
 		Successors:         node.GetSuccessors(),
 		FingerTable:        node.GetFingerTable(),
 		FingerIndex:        node.fingerIndex,
-		LocalStorageName:   node.GetFilesName(),
+		LocalStorageName:   filesName,
+		LocalStorageInfo:   filesInfo,
 		BackupStoragesName: node.GetAllBackupFilesName(),
+		ReplicationMode:    node.replicationMode,
 	}
 }
 
@@ -48,6 +61,19 @@ func printFile(filename string) {
 	fmt.Printf("Identifier: %s, filename: %s\n", tools.GenerateIdentifier(filename).String(), filename)
 }
 
+func printFileInfo(info *storage.FileInfo) {
+	fmt.Printf(
+		"Identifier: %s, filename: %s, size: %d, type: %s, sha256: %s, modified: %s, owner: %s\n",
+		tools.GenerateIdentifier(info.Key).String(),
+		info.Key,
+		info.Size,
+		info.ContentType,
+		info.Checksum,
+		info.ModifiedAt.Format(time.RFC3339),
+		info.Owner,
+	)
+}
+
 // PrintState prints the state (all information) of the node.
 func (nodeState *NodeState) PrintState() {
 	fmt.Println("Self:")
@@ -71,12 +97,12 @@ func (nodeState *NodeState) PrintState() {
 	}
 
 	fmt.Println("Files:")
-	if len(nodeState.LocalStorageName) == 0 {
+	if len(nodeState.LocalStorageInfo) == 0 {
 		fmt.Println("  No file in the storage")
 	}
-	for _, filename := range nodeState.LocalStorageName {
+	for _, info := range nodeState.LocalStorageInfo {
 		fmt.Printf("  ")
-		printFile(filename)
+		printFileInfo(info)
 	}
 
 	fmt.Println("Backup Files:")
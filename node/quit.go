@@ -10,7 +10,10 @@ func (node *Node) Quit() {
 	// because we have the backup mechanism,
 	// the node's predecessor will send the files to the node's successors
 
-	// 3. Set the localNode to nil
+	// 3. persist the routing state, so the node can rejoin through its old neighbours
+	_ = node.saveRoutingState()
+
+	// 4. Set the localNode to nil
 	localNode = nil
 }
 
@@ -64,6 +67,9 @@ func (node *Node) NotifyPredecessorLeave(predecessor *NodeInfo) {
 	// for the node, its predecessor is leaving, this predecessor views the node as its successor
 	// this predecessor will give its predecessor to the node, so the node can update its predecessor
 
+	// the node takes over the range of the leaving predecessor, together with its replicas (only in ReplicationPush)
+	node.promoteReplicas(predecessor)
+
 	// and we need to check the predecessor
 	if predecessor.LiveCheck() != nil {
 		return
@@ -0,0 +1,286 @@
+package node
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+/*
+ * Quorum replication.
+ * In ReplicationPull, the replicas of the node's files live in its predecessors: the i-th predecessor keeps them in
+ * backupStorages[i-1], and they are pulled in updateBackupFiles, which leaves a window where a new file only lives
+ * on the node. In ReplicationPush, they live in its successors: successors[i] keeps them in backupStorages[i].
+ * With a quorum (N, W, R), a write is pushed to the N-1 replica holders synchronously and succeeds only
+ * when W copies (including the node's own) are written, and a read consults R copies and returns the newest version.
+ */
+
+// WriteQuorumError is returned by a write which didn't reach its write quorum.
+// The write is not rolled back: the Written copies (the node's own first) keep the file, and the next writes or
+// the replication bring the missing copies, so a client should treat the file as possibly stored.
+type WriteQuorumError struct {
+	Written  int // the copies written
+	Required int // the write quorum W
+}
+
+func (err *WriteQuorumError) Error() string {
+	return fmt.Sprintf("write quorum not reached: %d of %d copies written", err.Written, err.Required)
+}
+
+// replicaHolder is a node keeping our replicas in its backupStorages[index].
+type replicaHolder struct {
+	nodeInfo *NodeInfo
+	index    int
+}
+
+// SetReplicationQuorum sets the quorum of the node: N copies (the node itself and N-1 replica holders),
+// a write succeeds with W copies written, and a read consults R copies.
+// It requires 1 <= W, R <= N <= SuccessorsLength+1, the default (1, 1, 1) means no synchronous replication.
+func (node *Node) SetReplicationQuorum(n, w, r int) error {
+	if n < 1 || n > node.successorsLength+1 {
+		return fmt.Errorf("N should be in [1, %d]", node.successorsLength+1)
+	}
+	if w < 1 || w > n || r < 1 || r > n {
+		return fmt.Errorf("W and R should be in [1, N]")
+	}
+	node.muQuorum.Lock()
+	defer node.muQuorum.Unlock()
+	node.replicationN, node.replicationW, node.replicationR = n, w, r
+	return nil
+}
+
+// GetReplicationQuorum returns the quorum (N, W, R) of the node.
+func (node *Node) GetReplicationQuorum() (int, int, int) {
+	node.muQuorum.RLock()
+	defer node.muQuorum.RUnlock()
+	return node.replicationN, node.replicationW, node.replicationR
+}
+
+// replicaHolders finds (at most) count replica holders.
+// In ReplicationPush, they are the successors.
+// In ReplicationPull, they are found by walking the predecessors,
+// the walk stops at the first empty or unreachable predecessor, or when it comes back to the node itself.
+func (node *Node) replicaHolders(count int) []replicaHolder {
+	var holders []replicaHolder
+	if node.replicationMode == ReplicationPush {
+		for i, successor := range node.GetSuccessors() {
+			if i == count {
+				break
+			}
+			if successor.Empty() || InfoEqual(successor, &node.info) {
+				continue
+			}
+			holders = append(holders, replicaHolder{nodeInfo: successor, index: i})
+		}
+		return holders
+	}
+
+	current := node.GetPredecessor()
+	for i := 0; i < count; i++ {
+		if current.Empty() || InfoEqual(current, &node.info) {
+			break
+		}
+		holders = append(holders, replicaHolder{nodeInfo: current, index: i})
+		if i+1 == count {
+			break
+		}
+		next, err := current.GetPredecessor()
+		if err != nil {
+			break
+		}
+		current = next
+	}
+	return holders
+}
+
+// QuorumStoreFile stores the file in the node and pushes it to N-1 replica holders in parallel.
+// A file without version gets a new one, and the replicas carry the same version.
+// It returns a *WriteQuorumError if fewer than W copies are written, the written copies are kept anyway.
+// In ReplicationPush, the rest of the successors get the file asynchronously.
+// In ReplicationErasure, the quorum is not used, the fragments are sent to the successors instead.
+func (node *Node) QuorumStoreFile(file *storage.File) error {
+	if err := node.StoreVersionedFile(file); err != nil {
+		return err
+	}
+	return node.replicateFile(file)
+}
+
+// replicateFile pushes the file (already stored in the node) to the replica holders, see QuorumStoreFile.
+func (node *Node) replicateFile(file *storage.File) error {
+	if node.replicationMode == ReplicationErasure {
+		return node.storeFragments(file)
+	}
+
+	n, w, _ := node.GetReplicationQuorum()
+	holders := node.replicaHolders(n - 1)
+	if node.replicationMode == ReplicationPush {
+		allHolders := node.replicaHolders(node.successorsLength)
+		holders = allHolders[:min(n-1, len(allHolders))]
+		for _, holder := range allHolders[len(holders):] {
+			go func(holder replicaHolder) {
+				_, _ = holder.nodeInfo.StoreReplica(file, holder.index)
+			}(holder)
+		}
+	}
+	if n == 1 {
+		return nil
+	}
+
+	results := make([]bool, len(holders))
+	var wg sync.WaitGroup
+	for i, holder := range holders {
+		wg.Add(1)
+		go func(i int, holder replicaHolder) {
+			defer wg.Done()
+			reply, err := holder.nodeInfo.StoreReplica(file, holder.index)
+			results[i] = err == nil && reply.Success
+		}(i, holder)
+	}
+	wg.Wait()
+
+	acks := 1
+	for _, success := range results {
+		if success {
+			acks++
+		}
+	}
+	if acks < w {
+		return &WriteQuorumError{Written: acks, Required: w}
+	}
+	return nil
+}
+
+// QuorumGetFile reads the file from the node and R-1 replica holders in parallel,
+// and returns the copy with the newest version.
+// It returns an error if fewer than R copies can be read.
+// In ReplicationErasure, the file is rebuilt from the fragments if the node doesn't have it.
+func (node *Node) QuorumGetFile(filename string) (*storage.File, error) {
+	if node.replicationMode == ReplicationErasure {
+		if file, err := node.localStorage.GetFile(filename); err == nil {
+			return file, nil
+		}
+		return node.reconstructFile(filename)
+	}
+
+	_, _, r := node.GetReplicationQuorum()
+	if r == 1 {
+		return node.getLocalFile(filename)
+	}
+
+	holders := node.replicaHolders(r - 1)
+	copies := make([]*storage.File, len(holders)+1)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if file, err := node.getLocalFile(filename); err == nil {
+			copies[0] = file
+		}
+	}()
+	for i, holder := range holders {
+		wg.Add(1)
+		go func(i int, holder replicaHolder) {
+			defer wg.Done()
+			reply, err := holder.nodeInfo.GetReplica(filename, holder.index)
+			if err != nil || !reply.Success {
+				return
+			}
+			file := &storage.File{
+				Key:      filename,
+				Value:    reply.FileContent,
+				Version:  reply.Version,
+				ExpireAt: reply.ExpireAt,
+				Checksum: reply.Checksum,
+			}
+			// a copy corrupted on the way is not counted
+			if file.Verify() == nil {
+				copies[i+1] = file
+			}
+		}(i, holder)
+	}
+	wg.Wait()
+
+	var newest *storage.File
+	read := 0
+	for _, file := range copies {
+		if file == nil {
+			continue
+		}
+		read++
+		if newest == nil || file.Version.After(newest.Version) {
+			newest = file
+		}
+	}
+	if read < r {
+		return nil, fmt.Errorf("read quorum not reached: %d of %d copies read", read, r)
+	}
+	return newest, nil
+}
+
+// StoreReplica stores the file in the node's backupStorages[index], used by the owner of the file.
+// The replica is skipped if the backup storage has a newer version.
+func (node *Node) StoreReplica(file *storage.File, index int) error {
+	if index < 0 || index >= node.successorsLength {
+		return fmt.Errorf("index out of range: %d", index)
+	}
+	node.clock.Update(file.Version)
+	return storage.MergeFiles(node.backupStorages[index], storage.FileList{file})
+}
+
+// GetReplica gets the file from the node's backupStorages[index].
+func (node *Node) GetReplica(filename string, index int) (*storage.File, error) {
+	if index < 0 || index >= node.successorsLength {
+		return nil, fmt.Errorf("index out of range: %d", index)
+	}
+	return node.backupStorages[index].GetFile(filename)
+}
+
+/*                             RPC Part                             */
+
+// StoreReplica is a wrap of StoreReplicaRPC method
+func (nodeInfo *NodeInfo) StoreReplica(file *storage.File, index int) (*BoolReply, error) {
+	args := &StoreReplicaArgs{
+		File:  *file,
+		Index: index,
+	}
+	reply := &BoolReply{}
+	err := nodeInfo.callRPC("StoreReplicaRPC", args, reply)
+	return reply, err
+}
+
+// StoreReplicaRPC : Store the file in the node's backup storage
+func (handler *RPCHandler) StoreReplicaRPC(args *StoreReplicaArgs, reply *BoolReply) error {
+	reply.Success = localNode.StoreReplica(&args.File, args.Index) == nil
+	return nil
+}
+
+// GetReplica is a wrap of GetReplicaRPC method
+func (nodeInfo *NodeInfo) GetReplica(filename string, index int) (*GetFileReply, error) {
+	args := &GetReplicaArgs{
+		Filename: filename,
+		Index:    index,
+	}
+	reply := &GetFileReply{}
+	err := nodeInfo.callRPC("GetReplicaRPC", args, reply)
+	return reply, err
+}
+
+// GetReplicaRPC : Get the file from the node's backup storage
+func (handler *RPCHandler) GetReplicaRPC(args *GetReplicaArgs, reply *GetFileReply) error {
+	file, err := localNode.GetReplica(args.Filename, args.Index)
+	if err != nil {
+		reply.Success = false
+		reply.FileContent = nil
+	} else {
+		reply.Success = true
+		reply.FileContent = file.Value
+		reply.Version = file.Version
+		reply.ExpireAt = file.ExpireAt
+		reply.Checksum = file.Checksum
+	}
+	return nil
+}
+
+/*                             RPC Part                             */
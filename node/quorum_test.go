@@ -0,0 +1,63 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+func TestQuorumStoreFilePartial(t *testing.T) {
+	node := newTestNode(t, "100")
+	node.SetReplicationMode(ReplicationPush)
+	node.SetSuccessor(0, deadNodeInfo(t, 110))
+	node.SetSuccessor(1, deadNodeInfo(t, 120))
+	if err := node.SetReplicationQuorum(3, 2, 1); err != nil {
+		t.Fatalf("Failed to set quorum: %v", err)
+	}
+
+	err := node.QuorumStoreFile(&storage.File{Key: "testfile", Value: []byte("testdata")})
+	var quorumErr *WriteQuorumError
+	if !errors.As(err, &quorumErr) || quorumErr.Written != 1 || quorumErr.Required != 2 {
+		t.Fatalf("Expected 1 of 2 copies written, got %v", err)
+	}
+
+	// the node's own copy is kept
+	value, err := node.GetFile("testfile")
+	if err != nil || !bytes.Equal(value, []byte("testdata")) {
+		t.Fatalf("Expected the partial write to be kept, got %s, %v", value, err)
+	}
+}
+
+func TestConditionalWriteQuorumPartial(t *testing.T) {
+	node := newTestNode(t, "100")
+	node.SetReplicationMode(ReplicationPush)
+	node.SetSuccessor(0, deadNodeInfo(t, 110))
+	node.SetSuccessor(1, deadNodeInfo(t, 120))
+	if err := node.SetReplicationQuorum(3, 2, 1); err != nil {
+		t.Fatalf("Failed to set quorum: %v", err)
+	}
+
+	var handler RPCHandler
+	args := &ConditionalArgs{File: storage.File{Key: "testfile", Value: []byte("testdata")}}
+	reply := &ConditionalReply{}
+	handler.PutIfAbsentRPC(args, reply)
+	if reply.Success || reply.Conflict || reply.Written != 1 || reply.Version.IsZero() {
+		t.Fatalf("Expected 1 copy written with its version, got %+v", reply)
+	}
+
+	// the retry conflicts with the version the client committed
+	retry := &ConditionalReply{}
+	handler.PutIfAbsentRPC(args, retry)
+	if !retry.Conflict || retry.Version != reply.Version {
+		t.Fatalf("Expected a conflict with version %v, got %+v", reply.Version, retry)
+	}
+
+	args = &ConditionalArgs{File: storage.File{Key: "testfile", Value: []byte("testdata2")}, Expected: reply.Version}
+	swapped := &ConditionalReply{}
+	handler.CompareAndSwapRPC(args, swapped)
+	if swapped.Success || swapped.Written != 1 || !swapped.Version.After(reply.Version) {
+		t.Fatalf("Expected 1 copy written with a newer version, got %+v", swapped)
+	}
+}
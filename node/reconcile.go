@@ -0,0 +1,134 @@
+package node
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/chord-dht/chord-core/storage"
+	"github.com/chord-dht/chord-core/tools"
+)
+
+/*
+ * Ownership reconciliation.
+ * A node restarting with the files found on disk may keep files it is no longer responsible for (the ring changed
+ * while it was away), and its successor may keep the files written in the node's range while it was away.
+ * Once the node knows its range after joining, it hands off the files out of its range to their owners,
+ * and asks its successor to do the same, so every file ends up on its owner, where the newer version wins.
+ */
+
+// reconcileWaitTime bounds the wait for the node's predecessor after joining.
+const reconcileWaitTime = 30 * time.Second
+
+// reconcileOwnership hands off the local files the node is not responsible for to their owners.
+// It does nothing if the predecessor is unknown or dead, as the node's range is not known.
+// The files are handed off batch by batch (see transferFiles), only the ones stored by their owners are removed,
+// the others are kept and will be tried at the next reconciliation.
+func (node *Node) reconcileOwnership() error {
+	predecessor := node.GetPredecessor()
+	if predecessor.Empty() || InfoEqual(predecessor, &node.info) || predecessor.LiveCheck() != nil {
+		return nil
+	}
+
+	// the files out of (predecessor, node] are the ones in (node, predecessor]
+	outOfRange := func(filename string) bool {
+		identifier := tools.GenerateIdentifier(filename)
+		return tools.ModIntervalCheck(identifier, node.info.Identifier, predecessor.Identifier, false, true)
+	}
+	transferred, delivered, err := node.transferFiles(outOfRange, "", node.handOff)
+	if err != nil {
+		return err
+	}
+	if delivered < transferred {
+		return fmt.Errorf("failed to hand off %d files", transferred-delivered)
+	}
+	return nil
+}
+
+// handOff stores the files in their owners, and returns the keys of the delivered files.
+// The files owned by the node itself, or whose owner can't be found, are not delivered.
+func (node *Node) handOff(fileList storage.FileList) []string {
+	owners := make(map[string]*NodeInfo)
+	fileLists := make(map[string]storage.FileList)
+	for _, file := range fileList {
+		owner, err := node.findOwner(tools.GenerateIdentifier(file.Key))
+		if err != nil || InfoEqual(owner, &node.info) {
+			continue
+		}
+		owners[owner.Address()] = owner
+		fileLists[owner.Address()] = append(fileLists[owner.Address()], file)
+	}
+
+	var delivered []string
+	for address, files := range fileLists {
+		delivered = append(delivered, sendFiles(owners[address], files)...)
+	}
+	return delivered
+}
+
+// recoverTransfers resumes the transfers left pending by a crash: their files were kept in the node,
+// they are sent again to the recorded target (or to their owners), and the transfer is committed with the
+// delivered ones. The files which can't be delivered are kept, they are handed off by the next notify or
+// reconciliation.
+func (node *Node) recoverTransfers() {
+	transfers := node.localStorage.PendingTransfers()
+	if len(transfers) == 0 {
+		return
+	}
+	defer node.markReplicasDirty()
+
+	for _, transfer := range transfers {
+		var files storage.FileList
+		for key := range transfer.Versions {
+			if file, err := node.localStorage.GetFile(key); err == nil {
+				files = append(files, file)
+			}
+		}
+
+		var delivered []string
+		if transfer.Target == "" {
+			delivered = node.handOff(files)
+		} else if host, port, err := net.SplitHostPort(transfer.Target); err == nil {
+			delivered = sendFiles(NewNodeInfoWithAddress(host, port), files)
+		}
+		_ = node.localStorage.CommitTransfer(transfer.ID, delivered)
+	}
+}
+
+// reconcileAfterJoin waits until the node knows its predecessor, then reconciles the ownership of its files,
+// and asks its successor to do the same.
+func (node *Node) reconcileAfterJoin() {
+	deadline := time.After(reconcileWaitTime)
+	for node.GetPredecessor().Empty() {
+		select {
+		case <-time.After(node.stabilizeTime * time.Millisecond):
+		case <-deadline:
+			return
+		case <-node.shutdownCh:
+			return
+		}
+	}
+
+	_ = node.reconcileOwnership()
+	successor := node.GetFirstSuccessor()
+	if !successor.Empty() && !InfoEqual(successor, &node.info) {
+		_, _ = successor.ReconcileOwnership()
+	}
+}
+
+/*                             RPC Part                             */
+
+// ReconcileOwnership is a wrap of ReconcileOwnershipRPC method
+func (nodeInfo *NodeInfo) ReconcileOwnership() (*BoolReply, error) {
+	reply := &BoolReply{}
+	err := nodeInfo.callRPC("ReconcileOwnershipRPC", &Empty{}, reply)
+	return reply, err
+}
+
+// ReconcileOwnershipRPC : Hand off the node's files it is not responsible for to their owners
+func (handler *RPCHandler) ReconcileOwnershipRPC(args *Empty, reply *BoolReply) error {
+	reply.Success = localNode.reconcileOwnership() == nil
+	return nil
+}
+
+/*                             RPC Part                             */
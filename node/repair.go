@@ -0,0 +1,93 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+/*
+ * Corruption detection and repair.
+ * The storage keeps a checksum with every file and verifies it when the file is read, a corrupted file is moved to
+ * the quarantine, so it is neither served nor replicated. The files carry their checksum when they are transferred,
+ * and the receiver rejects a file that doesn't match it.
+ * A corrupted local file is repaired from a healthy replica (or rebuilt from the fragments in ReplicationErasure),
+ * at once when it is read, and by the periodic scrub otherwise. Corrupted replicas and fragments are only quarantined,
+ * they are sent again by their owner.
+ */
+
+// scrubTime is the interval of the periodic scrub, which reads every file from disk.
+const scrubTime = 10 * time.Minute
+
+// getLocalFile gets the file from the local storage, a corrupted file is repaired from a healthy replica.
+func (node *Node) getLocalFile(filename string) (*storage.File, error) {
+	file, err := node.localStorage.GetFile(filename)
+	if storage.IsCorrupted(err) {
+		return node.RepairFile(filename)
+	}
+	return file, err
+}
+
+// RepairFile fetches the file from the replica holders, and stores the newest healthy copy in the local storage.
+// In ReplicationErasure, the file is rebuilt from the fragments instead.
+func (node *Node) RepairFile(filename string) (*storage.File, error) {
+	if node.replicationMode == ReplicationErasure {
+		return node.reconstructFile(filename)
+	}
+
+	var healthy *storage.File
+	for _, holder := range node.replicaHolders(node.successorsLength) {
+		reply, err := holder.nodeInfo.GetReplica(filename, holder.index)
+		if err != nil || !reply.Success {
+			continue
+		}
+		file := &storage.File{
+			Key:      filename,
+			Value:    reply.FileContent,
+			Version:  reply.Version,
+			ExpireAt: reply.ExpireAt,
+			Checksum: reply.Checksum,
+		}
+		if file.Verify() != nil {
+			continue
+		}
+		if healthy == nil || file.Version.After(healthy.Version) {
+			healthy = file
+		}
+	}
+	if healthy == nil {
+		return nil, fmt.Errorf("failed to repair %s: no healthy replica", filename)
+	}
+
+	if err := node.StoreFiles(storage.FileList{healthy}); err != nil {
+		return nil, err
+	}
+	return healthy, nil
+}
+
+// scrub verifies all the files kept by the node, and repairs the quarantined local files.
+func (node *Node) scrub() {
+	_, _ = node.localStorage.Scrub()
+	for _, backupStorage := range node.backupStorages {
+		_, _ = backupStorage.Scrub()
+	}
+	_, _ = node.fragmentStorage.Scrub()
+
+	for _, filename := range node.localStorage.Quarantined() {
+		_, _ = node.RepairFile(filename)
+	}
+}
+
+func (node *Node) periodicScrub(scrubTime time.Duration) {
+	ticker := time.NewTicker(scrubTime)
+	for {
+		select {
+		case <-ticker.C:
+			node.scrub()
+		case <-node.shutdownCh:
+			ticker.Stop()
+			return
+		}
+	}
+}
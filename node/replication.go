@@ -168,7 +168,20 @@ func (node *Node) sendBackupFiles(oldBackupFileList storage.FileList) error {
 }
 
 // Update both successors and backup files of the node.
+// In ReplicationPush and ReplicationErasure, the node pushes its files to the successors instead of pulling theirs,
+// and if some successors are lost, everything is pushed again to repair the replicas (or fragments).
 func (node *Node) updateReplica(indexOfFirstLiveSuccessor int) error {
+	if node.replicationMode != ReplicationPull {
+		if indexOfFirstLiveSuccessor != 0 {
+			node.markReplicasDirty()
+		}
+		node.handleX()
+		if err := node.updateSuccessors(); err != nil {
+			return err
+		}
+		return node.pushReplicas()
+	}
+
 	firstSuccessorIsDead := indexOfFirstLiveSuccessor != 0
 
 	var oldBackupFileList storage.FileList
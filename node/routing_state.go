@@ -0,0 +1,149 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// routingStateFileName is the file (under statePath) that keeps the last known routing state.
+const routingStateFileName = "routing.json"
+
+// defaultSaveRoutingStateTime is the interval of the periodic routing state persistence (in milliseconds),
+// if NodeOptions doesn't set one.
+const defaultSaveRoutingStateTime = 5000
+
+// routingState is the persisted part of the node's routing information.
+type routingState struct {
+	Predecessor *NodeInfo    `json:"predecessor"`
+	Successors  NodeInfoList `json:"successors"`
+	FingerTable NodeInfoList `json:"fingerTable"`
+}
+
+// saveRoutingState writes the node's predecessor, successors and finger table to statePath.
+// The file is written to a temporary file first and then renamed, so a crash never leaves a broken file.
+// Do nothing if statePath is empty.
+func (node *Node) saveRoutingState() error {
+	if node.statePath == "" {
+		return nil
+	}
+
+	// the lists are copied under the locks, the periodic tasks keep setting their entries meanwhile
+	node.muSuc.RLock()
+	successors := append(NodeInfoList(nil), node.successors...)
+	node.muSuc.RUnlock()
+	node.muFin.RLock()
+	fingerTable := append(NodeInfoList(nil), node.fingerTable...)
+	node.muFin.RUnlock()
+
+	state := routingState{
+		Predecessor: node.GetPredecessor(),
+		Successors:  successors,
+		FingerTable: fingerTable,
+	}
+	data, err := json.Marshal(&state)
+	if err != nil {
+		return fmt.Errorf("error encoding routing state: %w", err)
+	}
+
+	if err := os.MkdirAll(node.statePath, os.ModePerm); err != nil {
+		return fmt.Errorf("error creating state directory: %w", err)
+	}
+	filePath := filepath.Join(node.statePath, routingStateFileName)
+	tempPath := filePath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("error writing routing state: %w", err)
+	}
+	if err := os.Rename(tempPath, filePath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("error renaming routing state: %w", err)
+	}
+	return nil
+}
+
+// loadRoutingState reads the last persisted routing state, returns (nil, nil) if there is none.
+func (node *Node) loadRoutingState() (*routingState, error) {
+	if node.statePath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(node.statePath, routingStateFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading routing state: %w", err)
+	}
+	state := &routingState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("error decoding routing state: %w", err)
+	}
+	return state, nil
+}
+
+// rejoinCandidates lists the nodes we knew before the restart, in the order we should try them:
+// successors first (they are the closest to us), then the finger table, and the predecessor at last.
+// Empty entries, the node itself and duplicates are skipped.
+func (node *Node) rejoinCandidates(state *routingState) NodeInfoList {
+	var candidates NodeInfoList
+	seen := make(map[string]struct{})
+
+	lists := []NodeInfoList{state.Successors, state.FingerTable, {state.Predecessor}}
+	for _, list := range lists {
+		for _, nodeInfo := range list {
+			if nodeInfo.Empty() || InfoEqual(nodeInfo, &node.info) {
+				continue
+			}
+			address := nodeInfo.Address()
+			if _, found := seen[address]; found {
+				continue
+			}
+			seen[address] = struct{}{}
+			candidates = append(candidates, nodeInfo)
+		}
+	}
+	return candidates
+}
+
+// rejoinRing tries to join the ring through the last known nodes.
+// On success, the live entries of the old finger table are restored, so routing works before fixFingers catches up.
+func (node *Node) rejoinRing() error {
+	state, err := node.loadRoutingState()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("no persisted routing state")
+	}
+
+	for _, candidate := range node.rejoinCandidates(state) {
+		if candidate.LiveCheck() != nil {
+			continue
+		}
+		if err := node.joinRing(candidate.IpAddress, candidate.Port); err != nil {
+			continue
+		}
+		for i, finger := range state.FingerTable {
+			if i >= node.identifierLength || finger.LiveCheck() != nil {
+				continue
+			}
+			node.SetFingerEntry(i, finger)
+		}
+		return nil
+	}
+	return fmt.Errorf("none of the last known nodes is reachable")
+}
+
+func (node *Node) periodicSaveRoutingState(saveTime time.Duration) {
+	ticker := time.NewTicker(saveTime * time.Millisecond)
+	for {
+		select {
+		case <-ticker.C:
+			_ = node.saveRoutingState()
+		case <-node.shutdownCh:
+			ticker.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package node
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chord-dht/chord-core/memory"
+)
+
+func TestSaveRoutingStateConcurrent(t *testing.T) {
+	node, err := NewNodeWithOptions(8, 3, "127.0.0.1", "8000", memory.MemoryStorageFactory, t.TempDir(), t.TempDir(),
+		time.Second, time.Second, time.Second, false, nil, nil, NodeOptions{Identifier: "100", StatePath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	t.Cleanup(func() { localNode = nil })
+
+	// the periodic tasks set the entries while the state is saved
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			entry := &NodeInfo{Identifier: big.NewInt(int64(i)), IpAddress: "127.0.0.1", Port: "9000"}
+			node.SetFingerEntry(i%8, entry)
+			node.SetSuccessor(i%3, entry)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if err := node.saveRoutingState(); err != nil {
+			t.Fatalf("Failed to save routing state: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if err := node.saveRoutingState(); err != nil {
+		t.Fatalf("Failed to save routing state: %v", err)
+	}
+	state, err := node.loadRoutingState()
+	if err != nil || state == nil {
+		t.Fatalf("Failed to load routing state: %v", err)
+	}
+	if len(state.Successors) != 3 || state.Successors[0].Identifier.Cmp(big.NewInt(99)) != 0 {
+		t.Fatalf("Expected the last successors, got %v", state.Successors)
+	}
+	if len(state.FingerTable) != 8 || state.FingerTable[3].Identifier.Cmp(big.NewInt(99)) != 0 {
+		t.Fatalf("Expected the last finger table, got %v", state.FingerTable)
+	}
+}
+
+func TestSaveRoutingStateTime(t *testing.T) {
+	node := newTestNode(t, "100")
+	if node.saveRoutingStateTime != defaultSaveRoutingStateTime {
+		t.Fatalf("Expected the default interval, got %v", node.saveRoutingStateTime)
+	}
+
+	node, err := NewNodeWithOptions(8, 3, "127.0.0.1", "8000", memory.MemoryStorageFactory, t.TempDir(), t.TempDir(),
+		time.Second, time.Second, time.Second, false, nil, nil, NodeOptions{SaveRoutingStateTime: 200})
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	if node.saveRoutingStateTime != 200 {
+		t.Fatalf("Expected the interval of the options, got %v", node.saveRoutingStateTime)
+	}
+}
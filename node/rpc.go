@@ -71,7 +71,7 @@ func (node *Node) startServer() error {
 // callRPC makes an RPC call to the node.
 func (nodeInfo *NodeInfo) callRPC(method string, args interface{}, reply interface{}) error {
 	rpcMethod := RPCHandlerPrefix + method
-	address := nodeInfo.IpAddress + ":" + nodeInfo.Port
+	address := nodeInfo.Address()
 
 	var conn net.Conn = nil
 	var err error = nil
@@ -1,6 +1,8 @@
 package node
 
 import (
+	"time"
+
 	"github.com/chord-dht/chord-core/storage"
 )
 
@@ -30,13 +32,28 @@ type StoreFileArgs struct {
 	File storage.File
 }
 
-type StoreFileReply = BoolReply
+// StoreFileReply is the reply of a store request.
+// If the node is not responsible for the key, Misrouted is true and Owner is the hint of the correct owner
+// (empty if the node can't find it), so the caller can retry on it.
+// If the write quorum is not reached, Success is false and Written is the number of copies kept (see WriteQuorumError),
+// the file may be read from them.
+type StoreFileReply struct {
+	Success   bool
+	Misrouted bool
+	Owner     NodeInfo
+	Written   int // the copies written when the write quorum is not reached, the node's own included
+}
 
 type StoreFileListArgs struct {
 	FileList storage.FileList
 }
 
-type StoreFileListReply = BoolReply
+// StoreFileListReply is the reply of a store request with a file list.
+// If the node is not responsible for some of the keys, the whole list is rejected and Misrouted lists these keys.
+type StoreFileListReply struct {
+	Success   bool
+	Misrouted []string
+}
 
 /*                             store part                             */
 
@@ -49,6 +66,14 @@ type GetFileArgs struct {
 type GetFileReply struct {
 	Success     bool
 	FileContent []byte
+	Version     storage.Version
+	ExpireAt    time.Time
+	Checksum    string
+}
+
+type StatReply struct {
+	Success bool
+	Info    storage.FileInfo
 }
 
 type GetFileListReply struct {
@@ -63,11 +88,68 @@ type GetFileListsReply struct {
 
 /*                             get part                             */
 
+/*                             conditional part                             */
+
+type ConditionalArgs struct {
+	File     storage.File
+	Expected storage.Version // ignored by PutIfAbsent
+}
+
+// ConditionalReply is the reply of a conditional write.
+// On conflict, Version is the current version of the file, otherwise it is the new version.
+// Misrouted, Owner and Written have the same meaning as in StoreFileReply: if the write quorum is not reached,
+// the write is kept and Version is its version, so a retry conflicting with it conflicts with the client's own write.
+type ConditionalReply struct {
+	Success   bool
+	Conflict  bool
+	NotFound  bool
+	Version   storage.Version
+	Misrouted bool
+	Owner     NodeInfo
+	Written   int
+}
+
+/*                             conditional part                             */
+
+/*                             replica part                             */
+
+type StoreReplicaArgs struct {
+	File  storage.File
+	Index int // index of the backup storage
+}
+
+type ReplaceReplicasArgs struct {
+	Owner    NodeInfo
+	FileList storage.FileList
+	Index    int // index of the backup storage
+}
+
+type GetReplicaArgs struct {
+	Filename string
+	Index    int // index of the backup storage
+}
+
+type DeleteReplicaArgs struct {
+	Filename string
+	Version  storage.Version // the version deleted by the owner, a newer replica is kept
+	Index    int             // index of the backup storage
+}
+
+type DeleteFragmentsArgs struct {
+	Owner    NodeInfo
+	Versions map[string]storage.Version // the files removed by the owner, at their version, newer fragments are kept
+}
+
+/*                             replica part                             */
+
 /*                             other                             */
 
 type GetLengthReply struct {
 	IdentifierLength int
 	SuccessorsLength int
+	ReplicationMode  string
+	TotalShards      int // data + parity fragments, only used in ReplicationErasure
+	DataShards       int // data fragments, only used in ReplicationErasure
 }
 
 /*                             other                             */
@@ -11,6 +11,11 @@ func (nodeInfo *NodeInfo) GetLength() (*GetLengthReply, error) {
 func (handler *RPCHandler) GetLengthRPC(args *Empty, reply *GetLengthReply) error {
 	reply.IdentifierLength = localNode.identifierLength
 	reply.SuccessorsLength = localNode.successorsLength
+	reply.ReplicationMode = localNode.replicationMode
+	if localNode.encoder != nil {
+		reply.TotalShards = localNode.encoder.TotalShards()
+		reply.DataShards = localNode.encoder.DataShards()
+	}
 	return nil
 }
 
@@ -52,3 +57,16 @@ func (handler *RPCHandler) GetSuccessorsRPC(args *Empty, reply *NodeInfoList) er
 	*reply = localNode.GetSuccessors()
 	return nil
 }
+
+// GetState A wrap of GetStateRPC method, call it and return the reply and error originally
+func (nodeInfo *NodeInfo) GetState() (*NodeState, error) {
+	reply := &NodeState{}
+	err := nodeInfo.callRPC("GetStateRPC", &Empty{}, reply)
+	return reply, err
+}
+
+// GetStateRPC : get the node's state (all information)
+func (handler *RPCHandler) GetStateRPC(args *Empty, reply *NodeState) error {
+	*reply = *localNode.GetState()
+	return nil
+}
@@ -1,7 +1,11 @@
 package node
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/chord-dht/chord-core/storage"
+	"github.com/chord-dht/chord-core/tools"
 )
 
 /*                             single file part                             */
@@ -9,8 +13,9 @@ import (
 // StoreFile is a wrap of StoreFileRPC method
 func (nodeInfo *NodeInfo) StoreFile(filename string, fileContent []byte) (*StoreFileReply, error) {
 	file := storage.File{
-		Key:   filename,
-		Value: fileContent,
+		Key:      filename,
+		Value:    fileContent,
+		Checksum: storage.Checksum(fileContent),
 	}
 	args := &StoreFileArgs{
 		File: file,
@@ -20,39 +25,101 @@ func (nodeInfo *NodeInfo) StoreFile(filename string, fileContent []byte) (*Store
 	return reply, err
 }
 
-// StoreFileRPC : Store the file in the node's storage
+// StoreFileRouted stores the file on the node (nodeInfo),
+// if the node is not responsible for the file, it follows the owner hint and retries, within maxSteps steps.
+func (nodeInfo *NodeInfo) StoreFileRouted(filename string, fileContent []byte) (*StoreFileReply, error) {
+	target := nodeInfo
+	for i := 0; i < maxSteps; i++ {
+		reply, err := target.StoreFile(filename, fileContent)
+		if err != nil || !reply.Misrouted {
+			return reply, err
+		}
+		if reply.Owner.Empty() {
+			return reply, fmt.Errorf("%v is not responsible for %s and has no owner hint", target, filename)
+		}
+		owner := reply.Owner
+		target = &owner
+	}
+	return nil, fmt.Errorf("failed to find the owner of %s within maxSteps", filename)
+}
+
+// StoreFileRPC : Store the file in the node's storage.
+// The file is rejected if the node is not responsible for it, with the hint of the correct owner.
+// If a write quorum is set, the file is also pushed to the replica holders before replying.
 func (handler *RPCHandler) StoreFileRPC(args *StoreFileArgs, reply *StoreFileReply) error {
 	file := args.File
 
-	err := localNode.StoreFile(file.Key, file.Value)
-	if err != nil {
+	if !localNode.isResponsible(tools.GenerateIdentifier(file.Key)) {
 		reply.Success = false
-	} else {
+		reply.Misrouted = true
+		reply.Owner = localNode.ownerHint(file.Key)
+		return nil
+	}
+
+	err := localNode.QuorumStoreFile(&file)
+	var quorumErr *WriteQuorumError
+	switch {
+	case err == nil:
 		reply.Success = true
+	case errors.As(err, &quorumErr):
+		// the copies written are kept, the client learns the file may be stored
+		reply.Success = false
+		reply.Written = quorumErr.Written
+	default:
+		reply.Success = false
 	}
 	return nil
 }
 
 // GetFile is a wrap of GetFileRPC method
-// get the file from the node (nodeInfo)
+// get the file from the node (nodeInfo), a file corrupted on the way returns ErrCorrupted
 func (nodeInfo *NodeInfo) GetFile(filename string) (*GetFileReply, error) {
 	args := &GetFileArgs{
 		Filename: filename,
 	}
 	reply := &GetFileReply{}
 	err := nodeInfo.callRPC("GetFileRPC", args, reply)
+	if err == nil && reply.Success && reply.Checksum != "" && reply.Checksum != storage.Checksum(reply.FileContent) {
+		return reply, fmt.Errorf("%w: %s", storage.ErrCorrupted, filename)
+	}
 	return reply, err
 }
 
-// GetFileRPC : Get the file from the node
+// GetFileRPC : Get the file from the node, consulting the replicas if a read quorum is set
 func (handler *RPCHandler) GetFileRPC(args *GetFileArgs, reply *GetFileReply) error {
-	fileContent, err := localNode.GetFile(args.Filename)
+	file, err := localNode.QuorumGetFile(args.Filename)
 	if err != nil {
 		reply.Success = false
 		reply.FileContent = nil
 	} else {
 		reply.Success = true
-		reply.FileContent = fileContent
+		reply.FileContent = file.Value
+		reply.Version = file.Version
+		reply.ExpireAt = file.ExpireAt
+		reply.Checksum = file.Checksum
+	}
+	return nil
+}
+
+// Stat is a wrap of StatRPC method
+// get the metadata of the file from the node (nodeInfo), without its content
+func (nodeInfo *NodeInfo) Stat(filename string) (*StatReply, error) {
+	args := &GetFileArgs{
+		Filename: filename,
+	}
+	reply := &StatReply{}
+	err := nodeInfo.callRPC("StatRPC", args, reply)
+	return reply, err
+}
+
+// StatRPC : Get the metadata of the file from the node
+func (handler *RPCHandler) StatRPC(args *GetFileArgs, reply *StatReply) error {
+	info, err := localNode.Stat(args.Filename)
+	if err != nil {
+		reply.Success = false
+	} else {
+		reply.Success = true
+		reply.Info = *info
 	}
 	return nil
 }
@@ -114,8 +181,14 @@ func (nodeInfo *NodeInfo) StoreFiles(fileList storage.FileList) (*StoreFileListR
 	return reply, err
 }
 
-// StoreFilesRPC : Store the file list on the node's storage
+// StoreFilesRPC : Store the file list on the node's storage.
+// The whole list is rejected if the node is not responsible for some of the files.
 func (handler *RPCHandler) StoreFilesRPC(args *StoreFileListArgs, reply *StoreFileListReply) error {
+	if misrouted := localNode.misroutedFiles(args.FileList); len(misrouted) > 0 {
+		reply.Success = false
+		reply.Misrouted = misrouted
+		return nil
+	}
 	if err := localNode.StoreFiles(args.FileList); err != nil {
 		reply.Success = false
 	} else {
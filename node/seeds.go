@@ -0,0 +1,98 @@
+package node
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/chord-dht/chord-core/discovery"
+)
+
+// joinSeeds joins the ring through the first seed that works.
+// The given seeds are tried first, and the discoverers are only consulted when none of them works.
+func (node *Node) joinSeeds(seeds []string, discoverers []discovery.Discoverer) error {
+	err := node.joinAnySeed(seeds)
+	if err == nil {
+		return nil
+	}
+
+	for _, discoverer := range discoverers {
+		discovered, discoverErr := discoverer.Discover()
+		if discoverErr != nil {
+			err = discoverErr
+			continue
+		}
+		if err = node.joinAnySeed(discovered); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// joinAnySeed pings all the seeds in parallel, and then tries to join through the live ones in order.
+func (node *Node) joinAnySeed(seeds []string) error {
+	candidates := node.seedCandidates(seeds)
+	if len(candidates) == 0 {
+		return fmt.Errorf("no seed available")
+	}
+
+	alive := make([]bool, len(candidates))
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		wg.Add(1)
+		go func(i int, candidate *NodeInfo) {
+			defer wg.Done()
+			alive[i] = candidate.Ping() == nil
+		}(i, candidate)
+	}
+	wg.Wait()
+
+	err := fmt.Errorf("none of the seeds is alive")
+	for i, candidate := range candidates {
+		if !alive[i] {
+			continue
+		}
+		if err = node.joinRing(candidate.IpAddress, candidate.Port); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// seedCandidates converts the "host:port" seeds into NodeInfo,
+// skipping the invalid ones, the duplicated ones and the node itself.
+func (node *Node) seedCandidates(seeds []string) NodeInfoList {
+	var candidates NodeInfoList
+	seen := make(map[string]struct{})
+	for _, seed := range seeds {
+		host, port, err := net.SplitHostPort(seed)
+		if err != nil {
+			continue
+		}
+		if host == node.info.IpAddress && port == node.info.Port {
+			continue
+		}
+		if _, found := seen[seed]; found {
+			continue
+		}
+		seen[seed] = struct{}{}
+		candidates = append(candidates, NewNodeInfoWithAddress(host, port))
+	}
+	return candidates
+}
+
+// StartDiscoveryResponder answers the multicast discovery probes on the group with the node's address,
+// so other nodes on the LAN can find it through discovery.Multicast.
+// The responder is closed when the node is closed.
+func (node *Node) StartDiscoveryResponder(group string) error {
+	responder, err := discovery.NewResponder(group, net.JoinHostPort(node.info.IpAddress, node.info.Port))
+	if err != nil {
+		return err
+	}
+	go responder.Serve()
+	go func() {
+		<-node.shutdownCh
+		responder.Close()
+	}()
+	return nil
+}
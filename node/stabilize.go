@@ -1,6 +1,10 @@
 package node
 
 import (
+	"errors"
+	"io"
+
+	"github.com/chord-dht/chord-core/storage"
 	"github.com/chord-dht/chord-core/tools"
 )
 
@@ -44,6 +48,9 @@ func (node *Node) checkPredecessor() {
 	oldPredecessor := node.GetPredecessor()
 
 	if oldPredecessor.LiveCheck() != nil {
+		// the node takes over the range of the dead predecessor, together with its replicas (only in ReplicationPush),
+		// the new predecessor is not known yet
+		node.promoteReplicas(NewNodeInfo())
 		node.SetPredecessor(NewNodeInfo())
 		return
 	}
@@ -51,6 +58,10 @@ func (node *Node) checkPredecessor() {
 
 // Notify : node n is notified by n' (nodeInfo) to check if n' should be its predecessor
 func (node *Node) Notify(nodeInfo *NodeInfo) {
+	// a node with the same identifier but another address is not allowed in the ring
+	if IdentifierCollision(nodeInfo, &node.info) {
+		return
+	}
 	oldPredecessor := node.GetPredecessor()
 	// if oldPredecessor is nil or n' in (oldPredecessor, n)
 	if oldPredecessor.Empty() || tools.ModIntervalCheck(nodeInfo.Identifier, oldPredecessor.Identifier, node.info.Identifier, false, false) {
@@ -59,15 +70,24 @@ func (node *Node) Notify(nodeInfo *NodeInfo) {
 			return
 		}
 		node.SetPredecessor(nodeInfo)
+		// the replicas of the predecessors that died before n' are the node's own now (only in ReplicationPush)
+		node.promoteReplicas(nodeInfo)
 		// now the predecessor is set, the node should check its files, try to find the files that should be transferred to the new predecessor
 		node.transferFilesToPredecessor(oldPredecessor)
 	}
 	// in this case, the predecessor is not changed, so we don't need to transfer files
 }
 
+// transferBatchBytes is the size of the file batches sent by transferFilesToPredecessor.
+const transferBatchBytes = 4 * 1024 * 1024
+
 // Helper function for Notify
 // Transfer the chosen files.
 // Only invoked by the Notify function.
+// The files in (oldPredecessor, predecessor] are handed off batch by batch (see transferFiles): a batch is kept
+// in the node until it is stored in the predecessor, then its transfer is committed with the delivered files, which
+// are removed unless they changed meanwhile. The files not delivered stay in the node for the next notify, and
+// a crash in between leaves a pending transfer, resumed at the next start (see recoverTransfers).
 func (node *Node) transferFilesToPredecessor(oldPredecessor *NodeInfo) {
 	predecessor := node.GetPredecessor()
 	// self check: if the predecessor is itself, then do nothing
@@ -80,20 +100,121 @@ func (node *Node) transferFilesToPredecessor(oldPredecessor *NodeInfo) {
 		return
 	}
 
-	// first extract the chosen files
-	extractFileList, _ := node.ExtractFilesByFilter(func(filename string) bool {
-		// if oldPredecessor is not nil, we select filename ID with (oldPredecessor, predecessor]
-		return tools.ModIntervalCheck(tools.GenerateIdentifier(filename), oldPredecessor.Identifier, predecessor.Identifier, false, true)
+	inRange := func(filename string) bool {
+		identifier := tools.GenerateIdentifier(filename)
+		return tools.ModIntervalCheck(identifier, oldPredecessor.Identifier, predecessor.Identifier, false, true)
+	}
+	_, _, _ = node.transferFiles(inRange, predecessor.Address(), func(fileList storage.FileList) []string {
+		return sendFiles(predecessor, fileList)
 	})
+}
 
-	// finally, we send the file list to the predecessor
-	reply, err := predecessor.StoreFiles(extractFileList)
-	if err != nil || !reply.Success {
-		// for this error, we need to store these files back to the node's storage system again
-		// so that when another notify comes, the node can transfer these files
-		_ = node.StoreFiles(extractFileList)
-		return
+// transferFiles hands off the local files that satisfy the filter, one batch of walkFiles at a time: the batch
+// is recorded in a transfer, sent by send (which returns the keys of the delivered files), and the transfer is
+// committed with the delivered ones, so the files are never all held in memory. In ReplicationErasure, the fragments
+// of the delivered files are removed from their holders, the new owner pushes its own.
+// It stops at the first batch of which no file is delivered, and returns the number of files put in a transfer
+// and the number of the delivered ones.
+func (node *Node) transferFiles(filter func(string) bool, target string, send func(storage.FileList) []string) (int, int, error) {
+	transferred, delivered := 0, 0
+	err := walkFiles(node.localStorage, filter, func(batch storage.FileList) error {
+		id, fileList, err := node.localStorage.BeginTransferFiles(batch, target)
+		if err != nil || len(fileList) == 0 {
+			return err
+		}
+		keys := send(fileList)
+		transferred += len(fileList)
+		delivered += len(keys)
+		if err := node.localStorage.CommitTransfer(id, keys); err != nil {
+			return err
+		}
+		if node.replicationMode == ReplicationErasure {
+			node.deleteFragments(deliveredVersions(fileList, keys))
+		}
+		if len(keys) == 0 {
+			return storage.ErrStop
+		}
+		return nil
+	})
+	if transferred > 0 {
+		node.markReplicasDirty()
+	}
+	return transferred, delivered, err
+}
+
+// deliveredVersions returns the versions of the files of the list whose key is delivered.
+func deliveredVersions(fileList storage.FileList, delivered []string) map[string]storage.Version {
+	listed := make(map[string]storage.Version, len(fileList))
+	for _, file := range fileList {
+		listed[file.Key] = file.Version
+	}
+	versions := make(map[string]storage.Version, len(delivered))
+	for _, key := range delivered {
+		if version, found := listed[key]; found {
+			versions[key] = version
+		}
+	}
+	return versions
+}
+
+// walkFiles reads the files of the storage that satisfy the filter with ForEachFile, and passes them to flush
+// in batches of about transferBatchBytes, so only one batch is held in memory.
+// A corrupted file is skipped (the storage quarantines it). The walk stops at the first error returned by flush,
+// which is returned, except storage.ErrStop which stops it without error.
+func walkFiles(s storage.Storage, filter func(string) bool, flush func(storage.FileList) error) error {
+	var batch storage.FileList
+	size := 0
+	err := s.ForEachFile(filter, func(info *storage.FileInfo, value io.Reader) error {
+		file, err := storage.ReadFile(&storage.File{
+			Key:      info.Key,
+			Version:  info.Version,
+			ExpireAt: info.ExpireAt,
+			Owner:    info.Owner,
+			Checksum: info.Checksum,
+		}, value)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, file)
+		size += len(file.Value)
+		if size < transferBatchBytes {
+			return nil
+		}
+		full := batch
+		batch, size = nil, 0
+		return flush(full)
+	})
+	if err != nil || len(batch) == 0 {
+		return err
+	}
+	if err := flush(batch); !errors.Is(err, storage.ErrStop) {
+		return err
+	}
+	return nil
+}
+
+// sendFiles stores the files in the target, in batches of about transferBatchBytes,
+// and returns the keys of the delivered files. It stops at the first batch the target doesn't store.
+func sendFiles(target *NodeInfo, fileList storage.FileList) []string {
+	var delivered []string
+	for len(fileList) > 0 {
+		size, count := 0, 0
+		for count < len(fileList) && size < transferBatchBytes {
+			size += len(fileList[count].Value)
+			count++
+		}
+		batch := fileList[:count]
+		fileList = fileList[count:]
+
+		reply, err := target.StoreFiles(batch)
+		if err != nil || !reply.Success {
+			break
+		}
+		for _, file := range batch {
+			delivered = append(delivered, file.Key)
+		}
 	}
+	return delivered
 }
 
 /*                             RPC Part                             */
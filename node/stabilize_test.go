@@ -0,0 +1,209 @@
+package node
+
+import (
+	"bytes"
+	"math/big"
+	"net"
+	"net/rpc"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/chord-dht/chord-core/memory"
+	"github.com/chord-dht/chord-core/storage"
+)
+
+// streamOnlyStorage fails the test when the files are loaded all at once instead of being walked with ForEachFile.
+type streamOnlyStorage struct {
+	storage.Storage
+	t *testing.T
+}
+
+// streamOnlyFactory creates memory storages which only let the files be walked.
+func streamOnlyFactory(t *testing.T) func(string) (storage.Storage, error) {
+	return func(path string) (storage.Storage, error) {
+		s, err := memory.MemoryStorageFactory(path)
+		return &streamOnlyStorage{Storage: s, t: t}, err
+	}
+}
+
+func (s *streamOnlyStorage) GetAllFiles() (storage.FileList, error) {
+	s.t.Error("GetAllFiles loads all the files at once")
+	return s.Storage.GetAllFiles()
+}
+
+func (s *streamOnlyStorage) GetFilesByFilter(filter func(string) bool) (storage.FileList, error) {
+	s.t.Error("GetFilesByFilter loads all the files at once")
+	return s.Storage.GetFilesByFilter(filter)
+}
+
+func (s *streamOnlyStorage) GetRange(lo, hi *big.Int) (storage.FileList, error) {
+	s.t.Error("GetRange loads the whole range at once")
+	return s.Storage.GetRange(lo, hi)
+}
+
+func (s *streamOnlyStorage) BeginTransfer(lo, hi *big.Int, target string) (string, storage.FileList, error) {
+	s.t.Error("BeginTransfer loads the whole range at once")
+	return s.Storage.BeginTransfer(lo, hi, target)
+}
+
+// recordingHandler answers the RPCs storing files in a node, and records the batches it gets.
+// It keeps the fragments it is given, and records the fragments it is asked to delete.
+type recordingHandler struct {
+	mu        sync.Mutex
+	methods   []string
+	batches   []storage.FileList
+	fragments map[string]*storage.File
+	deleted   []DeleteFragmentsArgs
+}
+
+func (h *recordingHandler) record(method string, fileList storage.FileList) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.methods = append(h.methods, method)
+	h.batches = append(h.batches, fileList)
+}
+
+func (h *recordingHandler) StoreFilesRPC(args *StoreFileListArgs, reply *StoreFileListReply) error {
+	h.record("StoreFiles", args.FileList)
+	reply.Success = true
+	return nil
+}
+
+func (h *recordingHandler) ReplaceReplicasRPC(args *ReplaceReplicasArgs, reply *BoolReply) error {
+	h.record("ReplaceReplicas", args.FileList)
+	reply.Success = true
+	return nil
+}
+
+func (h *recordingHandler) AppendReplicasRPC(args *ReplaceReplicasArgs, reply *BoolReply) error {
+	h.record("AppendReplicas", args.FileList)
+	reply.Success = true
+	return nil
+}
+
+func (h *recordingHandler) StoreFragmentsRPC(args *StoreFileListArgs, reply *BoolReply) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, fragment := range args.FileList {
+		h.fragments[fragment.Key] = fragment
+	}
+	reply.Success = true
+	return nil
+}
+
+func (h *recordingHandler) GetFragmentsRPC(args *GetFileArgs, reply *GetFileListReply) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, fragment := range h.fragments {
+		if filename, _, err := parseFragmentKey(key); err == nil && filename == args.Filename {
+			reply.FileList = append(reply.FileList, fragment)
+		}
+	}
+	reply.Success = true
+	return nil
+}
+
+func (h *recordingHandler) DeleteFragmentsRPC(args *DeleteFragmentsArgs, reply *BoolReply) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.deleted = append(h.deleted, *args)
+	reply.Success = true
+	return nil
+}
+
+// recordingNodeInfo returns a node recording the files it is sent, until the end of the test.
+func recordingNodeInfo(t *testing.T, identifier int64) (*NodeInfo, *recordingHandler) {
+	t.Helper()
+	handler := &recordingHandler{fragments: make(map[string]*storage.File)}
+	server := rpc.NewServer()
+	if err := server.RegisterName("RPCHandler", handler); err != nil {
+		t.Fatalf("Failed to register handler: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return &NodeInfo{Identifier: big.NewInt(identifier), IpAddress: "127.0.0.1", Port: port}, handler
+}
+
+// putLargeFiles stores a file of 1MB for every key in the node.
+func putLargeFiles(t *testing.T, node *Node, keys []string) {
+	t.Helper()
+	for _, key := range keys {
+		file := &storage.File{Key: key, Value: bytes.Repeat([]byte(key[:1]), 1024*1024), Version: node.clock.Now()}
+		if err := node.localStorage.PutFile(file); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+}
+
+// expectBatches checks the recorded methods and that the batches are bounded and carry exactly the keys.
+func expectBatches(t *testing.T, handler *recordingHandler, methods []string, keys []string) {
+	t.Helper()
+	if len(handler.methods) != len(methods) {
+		t.Fatalf("Expected the calls %v, got %v", methods, handler.methods)
+	}
+	var received []string
+	for i, batch := range handler.batches {
+		if handler.methods[i] != methods[i] {
+			t.Fatalf("Expected the calls %v, got %v", methods, handler.methods)
+		}
+		size := 0
+		for _, file := range batch {
+			size += len(file.Value)
+			received = append(received, file.Key)
+		}
+		if size > transferBatchBytes+1024*1024 {
+			t.Fatalf("Expected batches of about %d bytes, got %d", transferBatchBytes, size)
+		}
+	}
+	sort.Strings(received)
+	expected := append([]string(nil), keys...)
+	sort.Strings(expected)
+	if len(received) != len(expected) {
+		t.Fatalf("Expected the files %v, got %v", expected, received)
+	}
+	for i := range expected {
+		if received[i] != expected[i] {
+			t.Fatalf("Expected the files %v, got %v", expected, received)
+		}
+	}
+}
+
+func TestTransferFilesToPredecessorInBatches(t *testing.T) {
+	node := newTestNodeWithStorage(t, "100", streamOnlyFactory(t))
+	oldPredecessor := liveNodeInfo(t, 10)
+	predecessor, handler := recordingNodeInfo(t, 50)
+
+	// 12MB in (oldPredecessor, predecessor] are sent in 3 batches, the files in (predecessor, node] stay
+	moved := ownedKeys(t, oldPredecessor.Identifier, predecessor.Identifier, 12)
+	kept := ownedKeys(t, predecessor.Identifier, node.info.Identifier, 2)
+	putLargeFiles(t, node, append(append([]string(nil), moved...), kept...))
+	node.SetPredecessor(predecessor)
+
+	node.transferFilesToPredecessor(oldPredecessor)
+
+	expectBatches(t, handler, []string{"StoreFiles", "StoreFiles", "StoreFiles"}, moved)
+	names := node.localStorage.GetFilesName()
+	sort.Strings(names)
+	sort.Strings(kept)
+	if len(names) != len(kept) || names[0] != kept[0] || names[1] != kept[1] {
+		t.Fatalf("Expected %v to be kept, got %v", kept, names)
+	}
+	if pending := node.localStorage.PendingTransfers(); len(pending) != 0 {
+		t.Fatalf("Expected no pending transfer, got %v", pending)
+	}
+}
@@ -1,7 +1,9 @@
 package node
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 
 	"github.com/chord-dht/chord-core/storage"
 )
@@ -19,9 +21,26 @@ func (node *Node) GetFilesName() []string {
 	return node.localStorage.GetFilesName()
 }
 
-// StoreFile stores the given data associated with the filename in the node.
+// newFile builds a file owned by the node, with a new version.
+func (node *Node) newFile(filename string, data []byte) *storage.File {
+	return &storage.File{Key: filename, Value: data, Version: node.clock.Now(), Owner: node.info.Address()}
+}
+
+// StoreFile stores the given data associated with the filename in the node, with a new version.
 func (node *Node) StoreFile(filename string, data []byte) error {
-	return node.localStorage.Put(filename, data)
+	return node.localStorage.PutFile(node.newFile(filename, data))
+}
+
+// StoreVersionedFile stores the file in the node unless the node has a newer version of it (last writer wins).
+// A file without version gets a new one, and the node becomes the owner of the file.
+func (node *Node) StoreVersionedFile(file *storage.File) error {
+	file.Owner = node.info.Address()
+	if file.Version.IsZero() {
+		file.Version = node.clock.Now()
+	} else {
+		node.clock.Update(file.Version)
+	}
+	return storage.MergeFiles(node.localStorage, storage.FileList{file})
 }
 
 // GetFile gets the data associated with the filename from the node.
@@ -29,19 +48,64 @@ func (node *Node) GetFile(filename string) ([]byte, error) {
 	return node.localStorage.Get(filename)
 }
 
-// DeleteFile removes the data associated with the filename from the node.
+// Stat gets the metadata of the file from the node, without reading its content.
+func (node *Node) Stat(filename string) (*storage.FileInfo, error) {
+	return node.localStorage.Stat(filename)
+}
+
+// DeleteFile removes the data associated with the filename from the node, and its replicas.
+// The version removed is the one seen just before, so a write in between is not removed by mistake.
 func (node *Node) DeleteFile(filename string) error {
-	return node.localStorage.Delete(filename)
+	for {
+		info, err := node.localStorage.Stat(filename)
+		if err != nil {
+			return err
+		}
+		_, err = node.localStorage.DeleteIfVersion(filename, info.Version)
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		node.deleteReplicas(filename, info.Version)
+		return nil
+	}
 }
 
-// UpdateFile updates the data associated with the filename in the node.
+// UpdateFile updates the data associated with the filename in the node, with a new version, and replicates it.
 func (node *Node) UpdateFile(filename string, data []byte) error {
-	return node.localStorage.Update(filename, data)
+	if _, err := node.localStorage.Stat(filename); err != nil {
+		return err
+	}
+	file := node.newFile(filename, data)
+	if err := node.localStorage.PutFile(file); err != nil {
+		return err
+	}
+	return node.replicateFile(file)
 }
 
-// StoreFiles stores the given files in the node.
+// StoreFiles stores the given files in the node, keeping the newer version if the node already has a file.
+// It is used for the key handoff and the promoted backups, so a stale copy never overwrites a newer one.
 func (node *Node) StoreFiles(files storage.FileList) error {
-	return node.localStorage.PutFiles(files)
+	defer node.markReplicasDirty()
+	for _, file := range files {
+		node.clock.Update(file.Version)
+		file.Owner = node.info.Address()
+	}
+	if err := storage.MergeFiles(node.localStorage, files); err != nil {
+		return err
+	}
+	if node.replicationMode == ReplicationErasure {
+		// the node is the owner of the files now, the fragments it kept for the previous one are pruned
+		notOwn := func(owner string) bool { return owner != node.info.Address() }
+		for _, file := range files {
+			if err := node.removeFragments(file.Key, file.Version, notOwn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // GetAllFiles gets all files from the node.
@@ -56,9 +120,16 @@ func (node *Node) GetFilesByFilter(filter func(string) bool) (storage.FileList,
 
 // ExtractFilesByFilter gets the files from the node that satisfy the filter and removes them from the node.
 func (node *Node) ExtractFilesByFilter(filter func(string) bool) (storage.FileList, error) {
+	defer node.markReplicasDirty()
 	return node.localStorage.ExtractFilesByFilter(filter)
 }
 
+// ExtractRange gets the files from the node with an identifier in (lo, hi] and removes them from the node.
+func (node *Node) ExtractRange(lo, hi *big.Int) (storage.FileList, error) {
+	defer node.markReplicasDirty()
+	return node.localStorage.ExtractRange(lo, hi)
+}
+
 /*                             Used for storage                             */
 
 /*                             Used for backupStorages                             */
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"time"
+
+	"github.com/chord-dht/chord-core/storage"
+)
+
+/*
+ * Per-key TTL.
+ * A file stored with a TTL carries its absolute expiry time (ExpireAt), which travels with the file to the replicas,
+ * the fragments and the handoff, so every copy expires at the same moment. Expired files are hidden by the storage
+ * at once, and removed from disk by the periodic reaper. The expiry time is set by the client's clock, so the clocks
+ * of the ring should be roughly in sync.
+ */
+
+// reapExpiredTime is the interval of the periodic removal of the expired files.
+const reapExpiredTime = 10 * time.Second
+
+// StoreFileWithTTL stores the given data associated with the filename in the node, with a new version,
+// the file expires after ttl.
+func (node *Node) StoreFileWithTTL(filename string, data []byte, ttl time.Duration) error {
+	file := node.newFile(filename, data)
+	file.ExpireAt = time.Now().Add(ttl)
+	return node.localStorage.PutFile(file)
+}
+
+// reapExpired removes the expired files from the local storage, the backup storages and the fragment storage.
+func (node *Node) reapExpired() {
+	if removed, _ := node.localStorage.RemoveExpired(); len(removed) > 0 {
+		node.markReplicasDirty()
+	}
+	for _, backupStorage := range node.backupStorages {
+		_, _ = backupStorage.RemoveExpired()
+	}
+	_, _ = node.fragmentStorage.RemoveExpired()
+}
+
+func (node *Node) periodicReapExpired(reapTime time.Duration) {
+	ticker := time.NewTicker(reapTime)
+	for {
+		select {
+		case <-ticker.C:
+			node.reapExpired()
+		case <-node.shutdownCh:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+/*                             RPC Part                             */
+
+// StoreFileWithTTL is a wrap of StoreFileRPC method, the file expires after ttl.
+func (nodeInfo *NodeInfo) StoreFileWithTTL(filename string, fileContent []byte, ttl time.Duration) (*StoreFileReply, error) {
+	file := storage.File{
+		Key:      filename,
+		Value:    fileContent,
+		ExpireAt: time.Now().Add(ttl),
+		Checksum: storage.Checksum(fileContent),
+	}
+	args := &StoreFileArgs{
+		File: file,
+	}
+	reply := &StoreFileReply{}
+	err := nodeInfo.callRPC("StoreFileRPC", args, reply)
+	return reply, err
+}
+
+/*                             RPC Part                             */
@@ -1,11 +1,110 @@
 package storage
 
+import (
+	"io"
+	"math/big"
+	"time"
+)
+
+// Versioned is the part of the storage carrying the versions of the files.
+// GetFile and PutFile (and the file lists) carry the version of the files, the unversioned writes store the zero
+// Version. The conditional writes (PutIfAbsent, CompareAndSwap, DeleteIfVersion) are atomic, on success they return
+// the new version (the zero Version for a delete), on conflict they return the current version with ErrExists or
+// ErrVersionMismatch, and ErrNotFound if the fileKey is not in the storage.
+// PutFilesIfNewer is PutFiles leaving out the files the storage has a newer version of, compared under the same
+// locks as the write, so two concurrent merges of the same key keep the newest version.
+type Versioned interface {
+	GetFile(fileKey string) (*File, error)
+	PutFile(file *File) error
+	PutIfAbsent(file *File) (Version, error)
+	CompareAndSwap(file *File, expected Version) (Version, error)
+	DeleteIfVersion(fileKey string, expected Version) (Version, error)
+	PutFilesIfNewer(files FileList) error
+}
+
+// Expirer is the part of the storage handling the expiry of the files.
+// A file with an ExpireAt (see PutWithTTL) is treated as absent once it has expired,
+// and it is removed from the storage by RemoveExpired, which returns the removed keys.
+type Expirer interface {
+	PutWithTTL(fileKey string, value []byte, ttl time.Duration) error
+	RemoveExpired() ([]string, error)
+}
+
+// Quarantiner is the part of the storage keeping the corrupted files apart.
+// A file read back with a wrong checksum is moved to the quarantine (it is treated as absent) and ErrCorrupted is
+// returned, the file lists skip it. Scrub verifies all the files and returns the newly quarantined keys,
+// Quarantined lists the quarantined keys until they are stored again.
+type Quarantiner interface {
+	Scrub() ([]string, error)
+	Quarantined() []string
+}
+
+// Streamer is the part of the storage reading and writing the files without holding them in memory.
+// ForEachKey and ForEachFile iterate over the files that satisfy the filter (the expired ones are skipped):
+// fn gets the key, or the metadata and a reader of the value, which is only valid during the call and reports
+// a corrupted value with ErrCorrupted at its end (the file is then quarantined, and the iteration goes on if fn
+// returns that error). fn is called without the locks of the storage, so it may use the storage, and a file removed
+// before it is reached is skipped. The iteration stops at the first error returned by fn, which is returned,
+// except ErrStop which stops it without error.
+// GetStream writes the value of the file to the writer and returns its metadata, a corrupted value is reported
+// with ErrCorrupted once it is written. PutStream stores the file with the value read from the reader
+// (the Value of the file is ignored), and rejects it with ErrCorrupted if the file has a Checksum which doesn't
+// match what was read.
+type Streamer interface {
+	ForEachKey(filter func(string) bool, fn func(fileKey string) error) error
+	ForEachFile(filter func(string) bool, fn func(info *FileInfo, value io.Reader) error) error
+	GetStream(fileKey string, w io.Writer) (*FileInfo, error)
+	PutStream(file *File, value io.Reader) error
+}
+
+// Ranger is the part of the storage finding the files by the identifier of their key.
+// GetRange and ExtractRange get (and remove) the files whose key has an identifier in the modular interval
+// (lo, hi], as tools.ModIntervalCheck, found with an index sorted by identifier instead of hashing every key,
+// they follow GetFilesByFilter and ExtractFilesByFilter otherwise.
+type Ranger interface {
+	GetRange(lo, hi *big.Int) (FileList, error)
+	ExtractRange(lo, hi *big.Int) (FileList, error)
+}
+
+// Transferer is the part of the storage handing off the files in (lo, hi] in two phases.
+// BeginTransfer returns the files (leaving out the ones already in a pending transfer) and records the transfer
+// with its target (no transfer is recorded without files), the files stay in the storage meanwhile.
+// BeginTransferFiles does the same with the files read by the caller, e.g. a batch walked with ForEachFile,
+// so a large range is handed off one batch at a time instead of being held in memory.
+// CommitTransfer removes the files delivered to the recipient, unless they changed since the transfer began,
+// and AbortTransfer keeps them all. The pending transfers are persisted, PendingTransfers lists them after a restart
+// so the caller can resume or abort them.
+type Transferer interface {
+	BeginTransfer(lo, hi *big.Int, target string) (string, FileList, error)
+	BeginTransferFiles(files FileList, target string) (string, FileList, error)
+	CommitTransfer(id string, delivered []string) error
+	AbortTransfer(id string) error
+	PendingTransfers() []*Transfer
+}
+
+// Storage is the storage of a node.
+// Put and Update are unversioned writes, they store the zero Version (see Versioned).
+// Stat returns the metadata of a file (see FileInfo) without reading its value.
+// Every file is stored with its checksum: a file whose Checksum doesn't match its value is rejected with ErrCorrupted
+// (see Quarantiner for the files corrupted once stored).
+// Any non-empty fileKey can be stored, a write with an invalid fileKey returns ErrInvalidKey.
+// PutFiles validates the whole list first, a list with an invalid fileKey or a wrong checksum is rejected as a whole.
+// The storage is safe for concurrent use, and the other calls never see a part of a PutFiles.
+// See the storagetest package for the behavior every implementation should have.
 type Storage interface {
+	Versioned
+	Expirer
+	Quarantiner
+	Streamer
+	Ranger
+	Transferer
+
 	CheckFiles()
 	GetFilesName() []string
 	Get(fileKey string) ([]byte, error)
 	Put(fileKey string, value []byte) error
 	Update(fileKey string, newValue []byte) error
+	Stat(fileKey string) (*FileInfo, error)
 	Delete(fileKey string) error
 	GetFilesByFilter(filter func(string) bool) (FileList, error)
 	PutFiles(files FileList) error
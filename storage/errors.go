@@ -0,0 +1,23 @@
+package storage
+
+import "errors"
+
+var (
+	// ErrNotFound is returned when the fileKey is not in the storage.
+	ErrNotFound = errors.New("fileKey not found")
+	// ErrExists is returned by PutIfAbsent when the fileKey is already in the storage.
+	ErrExists = errors.New("fileKey already exists")
+	// ErrVersionMismatch is returned by the conditional writes when the current version is not the expected one.
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrCorrupted is returned when the value of a file doesn't match its checksum.
+	ErrCorrupted = errors.New("file corrupted")
+	// ErrInvalidKey is returned when the fileKey can't be stored, e.g. it is empty.
+	ErrInvalidKey = errors.New("invalid fileKey")
+	// ErrNoTransfer is returned when a transfer id is not a pending transfer of the storage.
+	ErrNoTransfer = errors.New("transfer not found")
+)
+
+// IsCorrupted checks if the error is caused by a corrupted file.
+func IsCorrupted(err error) bool {
+	return errors.Is(err, ErrCorrupted)
+}
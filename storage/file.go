@@ -1,9 +1,31 @@
 package storage
 
-// File represents a file with its key and content.
+import (
+	"fmt"
+	"time"
+)
+
+// File represents a file with its key, content, version, expiry time, owner and checksum.
 type File struct {
-	Key   string
-	Value []byte
+	Key      string
+	Value    []byte
+	Version  Version
+	ExpireAt time.Time // the zero time means the file never expires
+	Owner    string    // the network address of the node that stored the file as its owner, kept in FileInfo
+	Checksum string    // the checksum of the value (see Checksum), empty means not checked
+}
+
+// Expired checks if the file has expired at the given time.
+func (file *File) Expired(now time.Time) bool {
+	return !file.ExpireAt.IsZero() && !now.Before(file.ExpireAt)
+}
+
+// Verify checks the value of the file against its checksum, a file without checksum is not checked.
+func (file *File) Verify() error {
+	if file.Checksum == "" || file.Checksum == Checksum(file.Value) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrCorrupted, file.Key)
 }
 
 // FileList represents a list of files.
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"math/big"
+	"math/rand/v2"
+
+	"github.com/chord-dht/chord-core/tools"
+)
+
+// indexMaxLevel bounds the levels of the skiplist, enough for 4^16 keys with indexLevelUp.
+const (
+	indexMaxLevel = 16
+	indexLevelUp  = 4 // a node gets one more level with a chance of 1/indexLevelUp
+)
+
+// KeyIndex keeps the keys of a storage sorted by their identifier on the ring, so the keys in an identifier
+// interval are found without hashing every key. It is a skiplist: adding and removing a key is O(log n),
+// and a range of k keys is found in O(log n + k). It is not safe for concurrent use: the storage guards it with
+// its own mutex, the one guarding its key set, as the locks of single keys don't keep two writers apart.
+type KeyIndex struct {
+	head   indexNode // sentinel before the first key, it has all the levels
+	level  int       // the number of levels in use
+	length int
+}
+
+type indexNode struct {
+	identifier *big.Int
+	key        string
+	next       []*indexNode
+}
+
+// NewKeyIndex creates an empty index.
+func NewKeyIndex() *KeyIndex {
+	index := &KeyIndex{}
+	index.Clear()
+	return index
+}
+
+// less checks if the node comes before the identifier and key, the nodes are sorted by identifier, then by key.
+func (node *indexNode) less(identifier *big.Int, key string) bool {
+	if c := node.identifier.Cmp(identifier); c != 0 {
+		return c < 0
+	}
+	return node.key < key
+}
+
+// predecessors returns, for every level, the last node before the identifier and key.
+func (index *KeyIndex) predecessors(identifier *big.Int, key string) [indexMaxLevel]*indexNode {
+	var update [indexMaxLevel]*indexNode
+	node := &index.head
+	for level := index.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].less(identifier, key) {
+			node = node.next[level]
+		}
+		update[level] = node
+	}
+	return update
+}
+
+func randomLevel() int {
+	level := 1
+	for level < indexMaxLevel && rand.IntN(indexLevelUp) == 0 {
+		level++
+	}
+	return level
+}
+
+// Add adds the key to the index, an indexed key is not added twice.
+func (index *KeyIndex) Add(key string) {
+	identifier := tools.GenerateIdentifier(key)
+	update := index.predecessors(identifier, key)
+	if next := update[0].next[0]; next != nil && next.key == key {
+		return
+	}
+
+	level := randomLevel()
+	for ; index.level < level; index.level++ {
+		update[index.level] = &index.head
+	}
+	node := &indexNode{identifier: identifier, key: key, next: make([]*indexNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	index.length++
+}
+
+// Remove removes the key from the index.
+func (index *KeyIndex) Remove(key string) {
+	update := index.predecessors(tools.GenerateIdentifier(key), key)
+	node := update[0].next[0]
+	if node == nil || node.key != key {
+		return
+	}
+	for i := 0; i < len(node.next); i++ {
+		update[i].next[i] = node.next[i]
+	}
+	for index.level > 1 && index.head.next[index.level-1] == nil {
+		index.level--
+	}
+	index.length--
+}
+
+// Clear removes all keys from the index.
+func (index *KeyIndex) Clear() {
+	index.head = indexNode{next: make([]*indexNode, indexMaxLevel)}
+	index.level = 1
+	index.length = 0
+}
+
+// Len returns the number of indexed keys.
+func (index *KeyIndex) Len() int {
+	return index.length
+}
+
+// after returns the first node with an identifier greater than id.
+func (index *KeyIndex) after(id *big.Int) *indexNode {
+	node := &index.head
+	for level := index.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].identifier.Cmp(id) <= 0 {
+			node = node.next[level]
+		}
+	}
+	return node.next[0]
+}
+
+// Range returns the keys with an identifier in the modular interval (lo, hi], in the order of the ring from lo.
+// As for tools.ModIntervalCheck, lo >= hi means the interval wraps around the ring, so lo == hi is the whole ring.
+func (index *KeyIndex) Range(lo, hi *big.Int) []string {
+	var keys []string
+	if lo.Cmp(hi) < 0 {
+		for node := index.after(lo); node != nil && node.identifier.Cmp(hi) <= 0; node = node.next[0] {
+			keys = append(keys, node.key)
+		}
+		return keys
+	}
+	for node := index.after(lo); node != nil; node = node.next[0] {
+		keys = append(keys, node.key)
+	}
+	for node := index.head.next[0]; node != nil && node.identifier.Cmp(hi) <= 0; node = node.next[0] {
+		keys = append(keys, node.key)
+	}
+	return keys
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/chord-dht/chord-core/tools"
+)
+
+func TestKeyIndexRange(t *testing.T) {
+	index := NewKeyIndex()
+	var keys []string
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("testfile%d", i)
+		keys = append(keys, key)
+		index.Add(key)
+	}
+	index.Add("testfile0") // added twice
+	for _, key := range keys[150:] {
+		index.Remove(key)
+	}
+	keys = keys[:150]
+	if index.Len() != 150 {
+		t.Fatalf("Expected 150 keys, got %d", index.Len())
+	}
+
+	bounds := []int64{0, 1, 100, 500, 1000, 1023}
+	for _, lo := range bounds {
+		for _, hi := range bounds {
+			a, b := big.NewInt(lo), big.NewInt(hi)
+			var expected []string
+			for _, key := range keys {
+				if tools.ModIntervalCheck(tools.GenerateIdentifier(key), a, b, false, true) {
+					expected = append(expected, key)
+				}
+			}
+			got := index.Range(a, b)
+
+			// the keys come in the order of the ring from lo, lo itself being the last one
+			distance := func(key string) *big.Int {
+				d := new(big.Int).Sub(tools.GenerateIdentifier(key), a)
+				if d.Mod(d, tools.TwoM).Sign() == 0 {
+					return tools.TwoM
+				}
+				return d
+			}
+			for i := 1; i < len(got); i++ {
+				if distance(got[i-1]).Cmp(distance(got[i])) > 0 {
+					t.Fatalf("Range(%d, %d) is not in ring order: %s before %s", lo, hi, got[i-1], got[i])
+				}
+			}
+
+			sort.Strings(expected)
+			sort.Strings(got)
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Fatalf("Range(%d, %d) = %v, expected %v", lo, hi, got, expected)
+			}
+		}
+	}
+
+	index.Clear()
+	if keys := index.Range(big.NewInt(0), big.NewInt(0)); len(keys) != 0 {
+		t.Fatalf("Expected no keys after Clear, got %v", keys)
+	}
+}
+
+func TestKeyIndexLarge(t *testing.T) {
+	index := NewKeyIndex()
+	for i := 0; i < 100000; i++ {
+		index.Add(fmt.Sprintf("testfile%d", i))
+	}
+	for i := 0; i < 100000; i += 2 {
+		index.Remove(fmt.Sprintf("testfile%d", i))
+	}
+	index.Remove("missing")
+	if index.Len() != 50000 {
+		t.Fatalf("Expected 50000 keys, got %d", index.Len())
+	}
+
+	keys := index.Range(big.NewInt(0), big.NewInt(0))
+	if len(keys) != 50000 {
+		t.Fatalf("Expected 50000 keys in the whole ring, got %d", len(keys))
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		var i int
+		fmt.Sscanf(key, "testfile%d", &i)
+		if i%2 == 0 || seen[key] {
+			t.Fatalf("Unexpected key %s", key)
+		}
+		seen[key] = true
+	}
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// FileInfo is the metadata of a file, it is kept by the storage next to the file, so it can be read without the body.
+type FileInfo struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum"` // hex encoded SHA-256 of the value
+	ContentType string    `json:"contentType"`
+	CreatedAt   time.Time `json:"createdAt"`  // the first time the key was stored in this storage
+	ModifiedAt  time.Time `json:"modifiedAt"` // the last time the value was written in this storage
+	Owner       string    `json:"owner"`      // the network address of the node that stored the file as its owner
+	Version     Version   `json:"version"`
+	ExpireAt    time.Time `json:"expireAt"`
+}
+
+// Checksum returns the hex encoded SHA-256 of the value.
+func Checksum(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// ContentType guesses the content type of the file from the extension of the key,
+// and from the first bytes of the value if the extension is unknown.
+func ContentType(fileKey string, value []byte) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(fileKey)); contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType(value)
+}
@@ -0,0 +1,31 @@
+package storage
+
+import "testing"
+
+func TestChecksum(t *testing.T) {
+	// SHA-256 of the empty input
+	expected := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if sum := Checksum(nil); sum != expected {
+		t.Fatalf("Expected %s, got %s", expected, sum)
+	}
+	if Checksum([]byte("a")) == Checksum([]byte("b")) {
+		t.Fatal("Expected different checksums for different values")
+	}
+}
+
+func TestContentType(t *testing.T) {
+	tests := []struct {
+		key      string
+		value    []byte
+		expected string
+	}{
+		{"data.json", []byte("{}"), "application/json"},
+		{"noext", []byte("plain text"), "text/plain; charset=utf-8"},
+		{"noext", []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}, "image/png"},
+	}
+	for _, test := range tests {
+		if contentType := ContentType(test.key, test.value); contentType != test.expected {
+			t.Errorf("ContentType(%s) = %s, expected %s", test.key, contentType, test.expected)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ErrStop can be returned by the callback of ForEachKey or ForEachFile to stop the iteration without error.
+var ErrStop = errors.New("stop iteration")
+
+// VerifyingReader reads a value and verifies it against its checksum once it is fully read:
+// the end of a value that doesn't match is reported with ErrCorrupted instead of io.EOF.
+type VerifyingReader struct {
+	reader    io.Reader
+	checksum  string
+	hash      hash.Hash
+	size      int64
+	corrupted bool
+}
+
+// NewVerifyingReader wraps the reader of a value with the checksum, an empty checksum is not verified.
+func NewVerifyingReader(reader io.Reader, checksum string) *VerifyingReader {
+	return &VerifyingReader{reader: reader, checksum: checksum, hash: sha256.New()}
+}
+
+func (r *VerifyingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hash.Write(p[:n])
+	r.size += int64(n)
+	if err == io.EOF && r.checksum != "" && r.Checksum() != r.checksum {
+		r.corrupted = true
+		return n, fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+	}
+	return n, err
+}
+
+// Checksum returns the checksum of the bytes read so far.
+func (r *VerifyingReader) Checksum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
+
+// Size returns the number of bytes read so far.
+func (r *VerifyingReader) Size() int64 {
+	return r.size
+}
+
+// Corrupted checks if the value was fully read and didn't match its checksum.
+func (r *VerifyingReader) Corrupted() bool {
+	return r.corrupted
+}
+
+// ReadFile reads the value of the file from the reader, and verifies it against the checksum of the file if it
+// has one. The value of the file is replaced, its other fields are kept. It is used by the storages without
+// a streaming write path.
+func ReadFile(file *File, value io.Reader) (*File, error) {
+	data, err := io.ReadAll(NewVerifyingReader(value, file.Checksum))
+	if err != nil {
+		return nil, fmt.Errorf("error reading value of %s: %w", file.Key, err)
+	}
+	read := *file
+	read.Value = data
+	return &read, nil
+}
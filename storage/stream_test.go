@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestVerifyingReader(t *testing.T) {
+	value := bytes.Repeat([]byte("testdata"), 1000)
+
+	reader := NewVerifyingReader(bytes.NewReader(value), Checksum(value))
+	data, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(data, value) {
+		t.Fatalf("Expected the value, got %d bytes, %v", len(data), err)
+	}
+	if reader.Size() != int64(len(value)) || reader.Checksum() != Checksum(value) || reader.Corrupted() {
+		t.Fatalf("Unexpected reader state: size %d, checksum %s", reader.Size(), reader.Checksum())
+	}
+
+	reader = NewVerifyingReader(bytes.NewReader(value), Checksum([]byte("other")))
+	if _, err := io.ReadAll(reader); !errors.Is(err, ErrCorrupted) || !reader.Corrupted() {
+		t.Fatalf("Expected ErrCorrupted, got %v", err)
+	}
+
+	// an empty checksum is not verified
+	if _, err := io.ReadAll(NewVerifyingReader(bytes.NewReader(value), "")); err != nil {
+		t.Fatalf("Expected no error without checksum, got %v", err)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	file := &File{Key: "testfile", Owner: "127.0.0.1:8000", Checksum: Checksum([]byte("testdata"))}
+	read, err := ReadFile(file, bytes.NewReader([]byte("testdata")))
+	if err != nil || string(read.Value) != "testdata" || read.Owner != file.Owner {
+		t.Fatalf("Unexpected file: %+v, %v", read, err)
+	}
+	if file.Value != nil {
+		t.Fatal("Expected the original file to be unchanged")
+	}
+	if _, err := ReadFile(file, bytes.NewReader([]byte("wrong"))); !IsCorrupted(err) {
+		t.Fatalf("Expected ErrCorrupted, got %v", err)
+	}
+}
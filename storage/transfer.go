@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Transfer is a pending handoff of files: the files are kept in the storage until the recipient acknowledges them.
+type Transfer struct {
+	ID       string             `json:"id"`
+	Target   string             `json:"target"`   // the address of the recipient, empty if the files go to their owners
+	Versions map[string]Version `json:"versions"` // the version of every file when the transfer began
+}
+
+// TransferLog keeps the pending transfers of a storage, persisted to a file so they are found again after a crash.
+// A file is in at most one pending transfer. It is safe for concurrent use.
+type TransferLog struct {
+	path      string               // The file keeping the log, empty to keep it in memory only
+	transfers map[string]*Transfer // The pending transfers by id
+	keys      map[string]string    // The id of the pending transfer of every file in one
+
+	mu sync.Mutex
+}
+
+// OpenTransferLog opens the log kept in the file at path, the transfers pending before a restart are loaded.
+// An empty path keeps the log in memory only.
+func OpenTransferLog(path string) (*TransferLog, error) {
+	log := &TransferLog{
+		path:      path,
+		transfers: make(map[string]*Transfer),
+		keys:      make(map[string]string),
+	}
+	if path == "" {
+		return log, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return log, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading transfer log: %w", err)
+	}
+	var transfers []*Transfer
+	if err := json.Unmarshal(data, &transfers); err != nil {
+		return nil, fmt.Errorf("error decoding transfer log: %w", err)
+	}
+	for _, transfer := range transfers {
+		log.add(transfer)
+	}
+	return log, nil
+}
+
+func (log *TransferLog) add(transfer *Transfer) {
+	log.transfers[transfer.ID] = transfer
+	for key := range transfer.Versions {
+		log.keys[key] = transfer.ID
+	}
+}
+
+func (log *TransferLog) remove(id string) {
+	for key := range log.transfers[id].Versions {
+		delete(log.keys, key)
+	}
+	delete(log.transfers, id)
+}
+
+// store writes the log to its file, through a synced temporary file and a rename.
+func (log *TransferLog) store() error {
+	if log.path == "" {
+		return nil
+	}
+
+	transfers := make([]*Transfer, 0, len(log.transfers))
+	for _, transfer := range log.transfers {
+		transfers = append(transfers, transfer)
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].ID < transfers[j].ID })
+	data, err := json.Marshal(transfers)
+	if err != nil {
+		return fmt.Errorf("error encoding transfer log: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(log.path), os.ModePerm); err != nil {
+		return fmt.Errorf("error creating transfer log directory: %w", err)
+	}
+	tempPath := log.path + ".tmp"
+	file, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("error writing transfer log: %w", err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempPath, log.path)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("error writing transfer log: %w", err)
+	}
+	return nil
+}
+
+// Begin records a new transfer of the files to the target, the files already in a pending transfer are left out.
+// It returns the id of the transfer and the files in it, a transfer without files is not recorded and has no id.
+func (log *TransferLog) Begin(files FileList, target string) (string, FileList, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("error generating transfer id: %w", err)
+	}
+	transfer := &Transfer{ID: hex.EncodeToString(buf), Target: target, Versions: make(map[string]Version)}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	var included FileList
+	for _, file := range files {
+		if _, pending := log.keys[file.Key]; pending {
+			continue
+		}
+		transfer.Versions[file.Key] = file.Version
+		included = append(included, file)
+	}
+	if len(included) == 0 {
+		return "", nil, nil
+	}
+
+	log.add(transfer)
+	if err := log.store(); err != nil {
+		log.remove(transfer.ID)
+		return "", nil, err
+	}
+	return transfer.ID, included, nil
+}
+
+// Get returns the pending transfer with the id, it must not be modified.
+func (log *TransferLog) Get(id string) (*Transfer, error) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	transfer, found := log.transfers[id]
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrNoTransfer, id)
+	}
+	return transfer, nil
+}
+
+// End removes the pending transfer with the id from the log.
+func (log *TransferLog) End(id string) error {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if _, found := log.transfers[id]; !found {
+		return fmt.Errorf("%w: %s", ErrNoTransfer, id)
+	}
+	log.remove(id)
+	return log.store()
+}
+
+// Pending returns a copy of the pending transfers, sorted by id.
+func (log *TransferLog) Pending() []*Transfer {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	transfers := make([]*Transfer, 0, len(log.transfers))
+	for _, transfer := range log.transfers {
+		versions := make(map[string]Version, len(transfer.Versions))
+		for key, version := range transfer.Versions {
+			versions[key] = version
+		}
+		transfers = append(transfers, &Transfer{ID: transfer.ID, Target: transfer.Target, Versions: versions})
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].ID < transfers[j].ID })
+	return transfers
+}
+
+// Clear removes all the pending transfers.
+func (log *TransferLog) Clear() error {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	log.transfers = make(map[string]*Transfer)
+	log.keys = make(map[string]string)
+	return log.store()
+}
+
+// BeginTransfer starts a transfer of the files of the storage in (lo, hi] to the target, see Transferer.
+func BeginTransfer(s Ranger, log *TransferLog, lo, hi *big.Int, target string) (string, FileList, error) {
+	files, err := s.GetRange(lo, hi)
+	if err != nil {
+		return "", nil, err
+	}
+	return log.Begin(files, target)
+}
+
+// CommitTransfer removes the delivered files of the transfer from the storage and ends it, see Transferer.
+// If a file can't be removed, the transfer stays pending, and the commit can be retried.
+func CommitTransfer(s Versioned, log *TransferLog, id string, delivered []string) error {
+	transfer, err := log.Get(id)
+	if err != nil {
+		return err
+	}
+	for _, key := range delivered {
+		version, found := transfer.Versions[key]
+		if !found {
+			continue
+		}
+		// a file changed or removed since the transfer began is kept as it is
+		_, err := s.DeleteIfVersion(key, version)
+		if err != nil && !errors.Is(err, ErrVersionMismatch) && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("error removing transferred file %s: %w", key, err)
+		}
+	}
+	return log.End(id)
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestTransferLogPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transfers", "transfers.json")
+	log, err := OpenTransferLog(path)
+	if err != nil {
+		t.Fatalf("Failed to open transfer log: %v", err)
+	}
+
+	version := Version{WallTime: 42, NodeID: "node"}
+	first, _, err := log.Begin(FileList{{Key: "testfile1", Version: version}, {Key: "testfile2"}}, "127.0.0.1:8000")
+	if err != nil {
+		t.Fatalf("Failed to begin transfer: %v", err)
+	}
+	second, files, _ := log.Begin(FileList{{Key: "testfile2"}, {Key: "testfile3"}}, "")
+	if len(files) != 1 || files[0].Key != "testfile3" {
+		t.Fatalf("Expected only testfile3 in the second transfer, got %v", files)
+	}
+	if err := log.End(second); err != nil {
+		t.Fatalf("Failed to end transfer: %v", err)
+	}
+
+	// the pending transfer is found again after a restart
+	reopened, err := OpenTransferLog(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen transfer log: %v", err)
+	}
+	if pending := reopened.Pending(); len(pending) != 1 || pending[0].ID != first || pending[0].Target != "127.0.0.1:8000" {
+		t.Fatalf("Expected the transfer %s, got %v", first, pending)
+	}
+	transfer, err := reopened.Get(first)
+	if err != nil || transfer.Versions["testfile1"] != version || len(transfer.Versions) != 2 {
+		t.Fatalf("Unexpected transfer: %+v, %v", transfer, err)
+	}
+	// testfile1 stays in its transfer, and an empty transfer is not recorded
+	id, files, _ := reopened.Begin(FileList{{Key: "testfile1"}}, "")
+	if id != "" || len(files) != 0 || len(reopened.Pending()) != 1 {
+		t.Fatalf("Expected no transfer, got %q, %v", id, files)
+	}
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is a hybrid logical clock timestamp, used to order the writes of a file (last writer wins).
+// The zero Version is older than any other version, it is used by the unversioned writes.
+type Version struct {
+	WallTime int64  // physical part, in nanoseconds
+	Logical  uint32 // logical part, orders the events with the same WallTime
+	NodeID   string // the node which made the write, breaks the ties
+}
+
+// IsZero checks if the version is the zero Version.
+func (version Version) IsZero() bool {
+	return version == Version{}
+}
+
+// Compare returns -1 if version < other, 0 if they are equal, and 1 if version > other.
+func (version Version) Compare(other Version) int {
+	switch {
+	case version.WallTime < other.WallTime:
+		return -1
+	case version.WallTime > other.WallTime:
+		return 1
+	case version.Logical < other.Logical:
+		return -1
+	case version.Logical > other.Logical:
+		return 1
+	default:
+		return strings.Compare(version.NodeID, other.NodeID)
+	}
+}
+
+// After checks if version is newer than other.
+func (version Version) After(other Version) bool {
+	return version.Compare(other) > 0
+}
+
+// Clock is a hybrid logical clock, it generates versions which are
+// close to the physical time and never go backwards, even if the physical clocks of the nodes are skewed.
+type Clock struct {
+	nodeID   string
+	wallTime int64
+	logical  uint32
+	mu       sync.Mutex
+}
+
+// NewClock creates a Clock for the node, nodeID should be unique in the ring.
+func NewClock(nodeID string) *Clock {
+	return &Clock{nodeID: nodeID}
+}
+
+// Now generates a version for a local write, it is newer than every version generated or seen before.
+func (clock *Clock) Now() Version {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	physical := time.Now().UnixNano()
+	if physical > clock.wallTime {
+		clock.wallTime = physical
+		clock.logical = 0
+	} else {
+		clock.logical++
+	}
+	return Version{WallTime: clock.wallTime, Logical: clock.logical, NodeID: clock.nodeID}
+}
+
+// Update merges a version seen from another node, so the next versions of the clock will be newer than it.
+func (clock *Clock) Update(remote Version) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	physical := time.Now().UnixNano()
+	switch {
+	case physical > clock.wallTime && physical > remote.WallTime:
+		clock.wallTime = physical
+		clock.logical = 0
+	case remote.WallTime > clock.wallTime:
+		clock.wallTime = remote.WallTime
+		clock.logical = remote.Logical + 1
+	case remote.WallTime == clock.wallTime:
+		clock.logical = max(clock.logical, remote.Logical) + 1
+	default:
+		clock.logical++
+	}
+}
+
+// MergeFiles stores the files into the storage, last writer wins:
+// a file is skipped if the storage already has a newer version of it, see Versioned.PutFilesIfNewer.
+func MergeFiles(storage Versioned, files FileList) error {
+	return storage.PutFilesIfNewer(files)
+}
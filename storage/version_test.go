@@ -0,0 +1,46 @@
+package storage
+
+import "testing"
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b     Version
+		expected int
+	}{
+		{Version{WallTime: 1}, Version{WallTime: 2}, -1},
+		{Version{WallTime: 2, Logical: 0}, Version{WallTime: 2, Logical: 1}, -1},
+		{Version{WallTime: 2, Logical: 1, NodeID: "b"}, Version{WallTime: 2, Logical: 1, NodeID: "a"}, 1},
+		{Version{WallTime: 2, Logical: 1, NodeID: "a"}, Version{WallTime: 2, Logical: 1, NodeID: "a"}, 0},
+		{Version{}, Version{WallTime: 1}, -1},
+	}
+	for _, test := range tests {
+		if result := test.a.Compare(test.b); result != test.expected {
+			t.Errorf("Compare(%v, %v): expected %d, got %d", test.a, test.b, test.expected, result)
+		}
+	}
+}
+
+func TestClockMonotonic(t *testing.T) {
+	clock := NewClock("node")
+
+	previous := clock.Now()
+	for i := 0; i < 1000; i++ {
+		current := clock.Now()
+		if !current.After(previous) {
+			t.Fatalf("Expected %v to be after %v", current, previous)
+		}
+		previous = current
+	}
+}
+
+func TestClockUpdate(t *testing.T) {
+	clock := NewClock("node")
+
+	// a version from a node whose clock is far ahead
+	remote := Version{WallTime: clock.Now().WallTime + int64(1e12), Logical: 5, NodeID: "remote"}
+	clock.Update(remote)
+
+	if current := clock.Now(); !current.After(remote) {
+		t.Fatalf("Expected %v to be after %v", current, remote)
+	}
+}
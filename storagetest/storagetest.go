@@ -0,0 +1,1226 @@
+// Package storagetest is a behavioral test suite for the implementations of storage.Storage.
+// A backend runs it from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, MyStorageFactory)
+//	}
+package storagetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chord-dht/chord-core/storage"
+	"github.com/chord-dht/chord-core/tools"
+)
+
+// Factory creates the storage under test at path, it has the signature of the storageFactory of NewNode.
+type Factory func(path string) (storage.Storage, error)
+
+// Options enables the parts of the suite which need help from the backend.
+type Options struct {
+	// Persistent enables the restart tests: the storage is closed and created again at the same path.
+	Persistent bool
+	// Corrupt damages the stored value of fileKey behind the storage's back, it enables the corruption tests.
+	Corrupt func(s storage.Storage, fileKey string) error
+}
+
+// Compactor is implemented by the storages which can be compacted, the corruption tests compact them.
+type Compactor interface {
+	Compact() error
+}
+
+// Run runs the whole suite against the storages created by factory.
+// Every test gets a new storage in its own temporary directory, it is closed at the end if it is an io.Closer.
+func Run(t *testing.T, factory Factory) {
+	RunWithOptions(t, factory, Options{})
+}
+
+// suiteTest is a test of the suite, run against a new storage.
+type suiteTest struct {
+	name string
+	test func(*testing.T, storage.Storage)
+}
+
+// RunWithOptions runs the whole suite, with the tests enabled by the options.
+func RunWithOptions(t *testing.T, factory Factory, options Options) {
+	tests := []suiteTest{
+		{"PutGet", testPutGet},
+		{"GetMissing", testGetMissing},
+		{"Overwrite", testOverwrite},
+		{"Update", testUpdate},
+		{"Delete", testDelete},
+		{"InvalidKey", testInvalidKey},
+		{"UnusualKeys", testUnusualKeys},
+		{"EmptyValue", testEmptyValue},
+		{"GetFilesName", testGetFilesName},
+		{"PutFileVersion", testPutFileVersion},
+		{"Stat", testStat},
+		{"GetFilesByFilter", testGetFilesByFilter},
+		{"ExtractFilesByFilter", testExtractFilesByFilter},
+		{"GetRange", testGetRange},
+		{"ExtractRange", testExtractRange},
+		{"Transfer", testTransfer},
+		{"TransferAbort", testTransferAbort},
+		{"TransferFiles", testTransferFiles},
+		{"PutFiles", testPutFiles},
+		{"PutFilesAtomic", testPutFilesAtomic},
+		{"Clear", testClear},
+		{"PutIfAbsent", testPutIfAbsent},
+		{"CompareAndSwap", testCompareAndSwap},
+		{"DeleteIfVersion", testDeleteIfVersion},
+		{"MergeFiles", testMergeFiles},
+		{"TTL", testTTL},
+		{"WrongChecksum", testWrongChecksum},
+		{"ForEachKey", testForEachKey},
+		{"ForEachFile", testForEachFile},
+		{"ForEachFileModify", testForEachFileModify},
+		{"GetStream", testGetStream},
+		{"PutStream", testPutStream},
+		{"Concurrent", testConcurrent},
+		{"ConcurrentPutFiles", testConcurrentPutFiles},
+		{"ConcurrentMergeFiles", testConcurrentMergeFiles},
+	}
+
+	if options.Corrupt != nil {
+		tests = append(tests, suiteTest{"RangeAfterCorruption", func(t *testing.T, s storage.Storage) {
+			testRangeAfterCorruption(t, s, options.Corrupt)
+		}})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t, factory))
+		})
+	}
+	if options.Persistent {
+		t.Run("TransferRestart", func(t *testing.T) { testTransferRestart(t, factory) })
+	}
+}
+
+// newStorage creates a storage in a temporary directory of the test.
+func newStorage(t *testing.T, factory Factory) storage.Storage {
+	t.Helper()
+	return openStorage(t, factory, t.TempDir())
+}
+
+// openStorage creates the storage at path, it is closed at the end of the test.
+func openStorage(t *testing.T, factory Factory, path string) storage.Storage {
+	t.Helper()
+	s, err := factory(path)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { closeStorage(s) })
+	return s
+}
+
+// closeStorage closes the storage if it is an io.Closer.
+func closeStorage(s storage.Storage) {
+	if closer, ok := s.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// mustPut stores the value, and fails the test on error.
+func mustPut(t *testing.T, s storage.Storage, fileKey string, value []byte) {
+	t.Helper()
+	if err := s.Put(fileKey, value); err != nil {
+		t.Fatalf("Failed to put %s: %v", fileKey, err)
+	}
+}
+
+// expectValue checks that the value of fileKey is expected.
+func expectValue(t *testing.T, s storage.Storage, fileKey string, expected []byte) {
+	t.Helper()
+	value, err := s.Get(fileKey)
+	if err != nil {
+		t.Fatalf("Failed to get %s: %v", fileKey, err)
+	}
+	if !bytes.Equal(value, expected) {
+		t.Fatalf("Expected %q for %s, got %q", expected, fileKey, value)
+	}
+}
+
+// expectNotFound checks that fileKey is not in the storage.
+func expectNotFound(t *testing.T, s storage.Storage, fileKey string) {
+	t.Helper()
+	if _, err := s.Get(fileKey); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for %s, got %v", fileKey, err)
+	}
+}
+
+// expectKeys checks that the storage lists exactly the keys.
+func expectKeys(t *testing.T, s storage.Storage, keys ...string) {
+	t.Helper()
+	names := s.GetFilesName()
+	sort.Strings(names)
+	sort.Strings(keys)
+	if strings.Join(names, "\n") != strings.Join(keys, "\n") || len(names) != len(keys) {
+		t.Fatalf("Expected keys %q, got %q", keys, names)
+	}
+}
+
+// fileKeys returns the sorted keys of the files.
+func fileKeys(files storage.FileList) []string {
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		keys = append(keys, file.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func testPutGet(t *testing.T, s storage.Storage) {
+	mustPut(t, s, "testfile", []byte("testdata"))
+	expectValue(t, s, "testfile", []byte("testdata"))
+
+	file, err := s.GetFile("testfile")
+	if err != nil {
+		t.Fatalf("Failed to get file: %v", err)
+	}
+	if file.Key != "testfile" || !bytes.Equal(file.Value, []byte("testdata")) || !file.Version.IsZero() {
+		t.Fatalf("Unexpected file: %+v", file)
+	}
+	if file.Checksum != storage.Checksum([]byte("testdata")) {
+		t.Fatalf("Expected the file to carry its checksum, got %q", file.Checksum)
+	}
+}
+
+func testGetMissing(t *testing.T, s storage.Storage) {
+	expectNotFound(t, s, "missing")
+	if _, err := s.GetFile("missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound from GetFile, got %v", err)
+	}
+	if _, err := s.Stat("missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound from Stat, got %v", err)
+	}
+}
+
+func testOverwrite(t *testing.T, s storage.Storage) {
+	mustPut(t, s, "testfile", []byte("a longer initial value"))
+	mustPut(t, s, "testfile", []byte("short"))
+	expectValue(t, s, "testfile", []byte("short"))
+	expectKeys(t, s, "testfile")
+}
+
+func testUpdate(t *testing.T, s storage.Storage) {
+	if err := s.Update("testfile", []byte("updated")); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound when updating a missing file, got %v", err)
+	}
+	expectNotFound(t, s, "testfile")
+
+	mustPut(t, s, "testfile", []byte("initial"))
+	if err := s.Update("testfile", []byte("updated")); err != nil {
+		t.Fatalf("Failed to update file: %v", err)
+	}
+	expectValue(t, s, "testfile", []byte("updated"))
+}
+
+func testDelete(t *testing.T, s storage.Storage) {
+	if err := s.Delete("testfile"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound when deleting a missing file, got %v", err)
+	}
+
+	mustPut(t, s, "testfile", []byte("testdata"))
+	mustPut(t, s, "other", []byte("other"))
+	if err := s.Delete("testfile"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	expectNotFound(t, s, "testfile")
+	expectKeys(t, s, "other")
+
+	// the key can be stored again
+	mustPut(t, s, "testfile", []byte("again"))
+	expectValue(t, s, "testfile", []byte("again"))
+}
+
+func testInvalidKey(t *testing.T, s storage.Storage) {
+	if err := s.Put("", []byte("testdata")); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey from Put, got %v", err)
+	}
+	if err := s.PutFile(&storage.File{Key: "", Value: []byte("testdata")}); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey from PutFile, got %v", err)
+	}
+	if _, err := s.PutIfAbsent(&storage.File{Key: ""}); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey from PutIfAbsent, got %v", err)
+	}
+	expectKeys(t, s)
+}
+
+func testUnusualKeys(t *testing.T, s storage.Storage) {
+	keys := []string{
+		"dir/file.txt",
+		"../../etc/passwd",
+		".hidden",
+		"with space",
+		"UPPER and lower",
+		"日本語.txt",
+		"percent%2f",
+		strings.Repeat("k", 300),
+	}
+	for _, key := range keys {
+		mustPut(t, s, key, []byte(key))
+	}
+	for _, key := range keys {
+		expectValue(t, s, key, []byte(key))
+	}
+	expectKeys(t, s, keys...)
+
+	files, err := s.GetAllFiles()
+	if err != nil {
+		t.Fatalf("Failed to get all files: %v", err)
+	}
+	for _, file := range files {
+		if !bytes.Equal(file.Value, []byte(file.Key)) {
+			t.Fatalf("Expected the file %q to keep its key, got value %q", file.Key, file.Value)
+		}
+	}
+}
+
+func testEmptyValue(t *testing.T, s storage.Storage) {
+	mustPut(t, s, "empty", []byte{})
+	value, err := s.Get("empty")
+	if err != nil {
+		t.Fatalf("Failed to get empty file: %v", err)
+	}
+	if len(value) != 0 {
+		t.Fatalf("Expected an empty value, got %q", value)
+	}
+}
+
+func testGetFilesName(t *testing.T, s storage.Storage) {
+	expectKeys(t, s)
+	mustPut(t, s, "testfile1", []byte("testdata1"))
+	mustPut(t, s, "testfile2", []byte("testdata2"))
+	expectKeys(t, s, "testfile1", "testfile2")
+}
+
+func testPutFileVersion(t *testing.T, s storage.Storage) {
+	version := storage.Version{WallTime: 42, Logical: 1, NodeID: "node"}
+	file := &storage.File{Key: "testfile", Value: []byte("testdata"), Version: version, Owner: "127.0.0.1:8000"}
+	if err := s.PutFile(file); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+
+	got, err := s.GetFile("testfile")
+	if err != nil {
+		t.Fatalf("Failed to get file: %v", err)
+	}
+	if got.Version != version || got.Owner != file.Owner {
+		t.Fatalf("Expected version %v and owner %s, got %v and %s", version, file.Owner, got.Version, got.Owner)
+	}
+
+	files, err := s.GetAllFiles()
+	if err != nil {
+		t.Fatalf("Failed to get all files: %v", err)
+	}
+	if len(files) != 1 || files[0].Version != version {
+		t.Fatalf("Expected the file list to carry version %v, got %v", version, files)
+	}
+
+	// Put stores the zero version
+	mustPut(t, s, "testfile", []byte("unversioned"))
+	if got, _ := s.GetFile("testfile"); !got.Version.IsZero() {
+		t.Fatalf("Expected the zero version after Put, got %v", got.Version)
+	}
+}
+
+func testStat(t *testing.T, s storage.Storage) {
+	value := []byte("some notes")
+	if err := s.PutFile(&storage.File{Key: "notes.txt", Value: value, Owner: "127.0.0.1:8000"}); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	info, err := s.Stat("notes.txt")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if info.Key != "notes.txt" || info.Size != int64(len(value)) || info.Checksum != storage.Checksum(value) {
+		t.Fatalf("Unexpected metadata: %+v", info)
+	}
+	if info.Owner != "127.0.0.1:8000" || info.ContentType != "text/plain; charset=utf-8" {
+		t.Fatalf("Unexpected metadata: %+v", info)
+	}
+	if info.CreatedAt.IsZero() || info.ModifiedAt.Before(info.CreatedAt) {
+		t.Fatalf("Unexpected times: %+v", info)
+	}
+
+	// an overwrite keeps the creation time
+	time.Sleep(10 * time.Millisecond)
+	mustPut(t, s, "notes.txt", []byte("more notes"))
+	updated, err := s.Stat("notes.txt")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if !updated.CreatedAt.Equal(info.CreatedAt) || !updated.ModifiedAt.After(info.ModifiedAt) {
+		t.Fatalf("Expected the creation time to be kept and the modification time to move, got %+v", updated)
+	}
+}
+
+func testGetFilesByFilter(t *testing.T, s storage.Storage) {
+	mustPut(t, s, "testfile1", []byte("testdata1"))
+	mustPut(t, s, "testfile2", []byte("testdata2"))
+	mustPut(t, s, "other", []byte("other"))
+
+	files, err := s.GetFilesByFilter(func(key string) bool { return strings.HasPrefix(key, "testfile") })
+	if err != nil {
+		t.Fatalf("Failed to get files by filter: %v", err)
+	}
+	if keys := fileKeys(files); len(keys) != 2 || keys[0] != "testfile1" || keys[1] != "testfile2" {
+		t.Fatalf("Expected [testfile1 testfile2], got %v", keys)
+	}
+	for _, file := range files {
+		if !bytes.Equal(file.Value, []byte("testdata"+file.Key[len("testfile"):])) {
+			t.Fatalf("Unexpected value for %s: %q", file.Key, file.Value)
+		}
+	}
+
+	// reading doesn't remove anything
+	expectKeys(t, s, "testfile1", "testfile2", "other")
+
+	files, err = s.GetFilesByFilter(func(string) bool { return false })
+	if err != nil || len(files) != 0 {
+		t.Fatalf("Expected no file, got %v, %v", files, err)
+	}
+}
+
+func testExtractFilesByFilter(t *testing.T, s storage.Storage) {
+	mustPut(t, s, "testfile1", []byte("testdata1"))
+	mustPut(t, s, "testfile2", []byte("testdata2"))
+
+	files, err := s.ExtractFilesByFilter(func(key string) bool { return key == "testfile1" })
+	if err != nil {
+		t.Fatalf("Failed to extract files by filter: %v", err)
+	}
+	if len(files) != 1 || files[0].Key != "testfile1" || !bytes.Equal(files[0].Value, []byte("testdata1")) {
+		t.Fatalf("Expected to extract testfile1, got %v", files)
+	}
+	expectNotFound(t, s, "testfile1")
+	expectValue(t, s, "testfile2", []byte("testdata2"))
+	expectKeys(t, s, "testfile2")
+
+	// the extracted files can be stored again
+	if err := s.PutFiles(files); err != nil {
+		t.Fatalf("Failed to put the extracted files back: %v", err)
+	}
+	expectValue(t, s, "testfile1", []byte("testdata1"))
+}
+
+func testPutFiles(t *testing.T, s storage.Storage) {
+	var files storage.FileList
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("testfile%d", i)
+		files = append(files, &storage.File{Key: key, Value: []byte(key)})
+	}
+	if err := s.PutFiles(files); err != nil {
+		t.Fatalf("Failed to put files: %v", err)
+	}
+	all, err := s.GetAllFiles()
+	if err != nil {
+		t.Fatalf("Failed to get all files: %v", err)
+	}
+	if len(all) != len(files) {
+		t.Fatalf("Expected %d files, got %d", len(files), len(all))
+	}
+	for _, file := range files {
+		expectValue(t, s, file.Key, file.Value)
+	}
+
+	if err := s.PutFiles(nil); err != nil {
+		t.Fatalf("Failed to put an empty list: %v", err)
+	}
+}
+
+func testPutFilesAtomic(t *testing.T, s storage.Storage) {
+	mustPut(t, s, "existing", []byte("old"))
+
+	corrupted := storage.FileList{
+		{Key: "existing", Value: []byte("new")},
+		{Key: "testfile1", Value: []byte("testdata1")},
+		{Key: "testfile2", Value: []byte("testdata2"), Checksum: storage.Checksum([]byte("other"))},
+		{Key: "testfile3", Value: []byte("testdata3")},
+	}
+	if err := s.PutFiles(corrupted); !errors.Is(err, storage.ErrCorrupted) {
+		t.Fatalf("Expected ErrCorrupted, got %v", err)
+	}
+	expectKeys(t, s, "existing")
+	expectValue(t, s, "existing", []byte("old"))
+
+	invalid := storage.FileList{
+		{Key: "testfile1", Value: []byte("testdata1")},
+		{Key: "", Value: []byte("testdata2")},
+	}
+	if err := s.PutFiles(invalid); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey, got %v", err)
+	}
+	expectKeys(t, s, "existing")
+}
+
+func testClear(t *testing.T, s storage.Storage) {
+	mustPut(t, s, "testfile1", []byte("testdata1"))
+	mustPut(t, s, "testfile2", []byte("testdata2"))
+
+	if err := s.Clear(); err != nil {
+		t.Fatalf("Failed to clear storage: %v", err)
+	}
+	expectKeys(t, s)
+	expectNotFound(t, s, "testfile1")
+	if files, err := s.GetAllFiles(); err != nil || len(files) != 0 {
+		t.Fatalf("Expected no file after clear, got %v, %v", files, err)
+	}
+
+	// the storage is still usable
+	mustPut(t, s, "testfile1", []byte("again"))
+	expectValue(t, s, "testfile1", []byte("again"))
+	if err := s.Clear(); err != nil {
+		t.Fatalf("Failed to clear storage twice: %v", err)
+	}
+}
+
+func testPutIfAbsent(t *testing.T, s storage.Storage) {
+	first := storage.Version{WallTime: 1, NodeID: "node"}
+	second := storage.Version{WallTime: 2, NodeID: "node"}
+
+	version, err := s.PutIfAbsent(&storage.File{Key: "testfile", Value: []byte("first"), Version: first})
+	if err != nil || version != first {
+		t.Fatalf("Expected version %v, got %v, %v", first, version, err)
+	}
+	version, err = s.PutIfAbsent(&storage.File{Key: "testfile", Value: []byte("second"), Version: second})
+	if !errors.Is(err, storage.ErrExists) || version != first {
+		t.Fatalf("Expected ErrExists with %v, got %v, %v", first, version, err)
+	}
+	expectValue(t, s, "testfile", []byte("first"))
+}
+
+func testCompareAndSwap(t *testing.T, s storage.Storage) {
+	first := storage.Version{WallTime: 1, NodeID: "node"}
+	second := storage.Version{WallTime: 2, NodeID: "node"}
+	third := storage.Version{WallTime: 3, NodeID: "node"}
+
+	if _, err := s.CompareAndSwap(&storage.File{Key: "testfile", Version: second}, first); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	expectNotFound(t, s, "testfile")
+
+	if err := s.PutFile(&storage.File{Key: "testfile", Value: []byte("first"), Version: first}); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	version, err := s.CompareAndSwap(&storage.File{Key: "testfile", Value: []byte("second"), Version: second}, first)
+	if err != nil || version != second {
+		t.Fatalf("Expected version %v, got %v, %v", second, version, err)
+	}
+	version, err = s.CompareAndSwap(&storage.File{Key: "testfile", Value: []byte("third"), Version: third}, first)
+	if !errors.Is(err, storage.ErrVersionMismatch) || version != second {
+		t.Fatalf("Expected ErrVersionMismatch with %v, got %v, %v", second, version, err)
+	}
+	expectValue(t, s, "testfile", []byte("second"))
+}
+
+func testDeleteIfVersion(t *testing.T, s storage.Storage) {
+	first := storage.Version{WallTime: 1, NodeID: "node"}
+	second := storage.Version{WallTime: 2, NodeID: "node"}
+
+	if _, err := s.DeleteIfVersion("testfile", first); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	if err := s.PutFile(&storage.File{Key: "testfile", Value: []byte("second"), Version: second}); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	version, err := s.DeleteIfVersion("testfile", first)
+	if !errors.Is(err, storage.ErrVersionMismatch) || version != second {
+		t.Fatalf("Expected ErrVersionMismatch with %v, got %v, %v", second, version, err)
+	}
+	expectValue(t, s, "testfile", []byte("second"))
+
+	version, err = s.DeleteIfVersion("testfile", second)
+	if err != nil || !version.IsZero() {
+		t.Fatalf("Expected the zero version, got %v, %v", version, err)
+	}
+	expectNotFound(t, s, "testfile")
+}
+
+func testMergeFiles(t *testing.T, s storage.Storage) {
+	older := storage.Version{WallTime: 1, NodeID: "node"}
+	newer := storage.Version{WallTime: 2, NodeID: "node"}
+
+	s.PutFile(&storage.File{Key: "testfile1", Value: []byte("newer"), Version: newer})
+	s.PutFile(&storage.File{Key: "testfile2", Value: []byte("older"), Version: older})
+
+	err := storage.MergeFiles(s, storage.FileList{
+		{Key: "testfile1", Value: []byte("older"), Version: older},
+		{Key: "testfile2", Value: []byte("newer"), Version: newer},
+		{Key: "testfile3", Value: []byte("newer"), Version: newer},
+	})
+	if err != nil {
+		t.Fatalf("Failed to merge files: %v", err)
+	}
+	for _, key := range []string{"testfile1", "testfile2", "testfile3"} {
+		expectValue(t, s, key, []byte("newer"))
+	}
+}
+
+func testTTL(t *testing.T, s storage.Storage) {
+	if err := s.PutWithTTL("short", []byte("short"), 500*time.Millisecond); err != nil {
+		t.Fatalf("Failed to put file with TTL: %v", err)
+	}
+	if err := s.PutWithTTL("long", []byte("long"), time.Hour); err != nil {
+		t.Fatalf("Failed to put file with TTL: %v", err)
+	}
+	mustPut(t, s, "forever", []byte("forever"))
+
+	file, err := s.GetFile("short")
+	if err != nil || file.ExpireAt.IsZero() {
+		t.Fatalf("Expected the file to carry its expiry time, got %v, %v", file, err)
+	}
+
+	time.Sleep(time.Until(file.ExpireAt) + 10*time.Millisecond)
+
+	expectNotFound(t, s, "short")
+	expectKeys(t, s, "long", "forever")
+	if _, err := s.Stat("short"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound from Stat, got %v", err)
+	}
+	if files, _ := s.GetAllFiles(); len(files) != 2 {
+		t.Fatalf("Expected the expired file to be skipped, got %v", fileKeys(files))
+	}
+	if _, err := s.PutIfAbsent(&storage.File{Key: "short", Value: []byte("again")}); err != nil {
+		t.Fatalf("Expected an expired file to be absent for PutIfAbsent, got %v", err)
+	}
+	s.PutWithTTL("expiring", []byte("expiring"), time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+
+	removed, err := s.RemoveExpired()
+	if err != nil {
+		t.Fatalf("Failed to remove expired files: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "expiring" {
+		t.Fatalf("Expected [expiring] to be removed, got %v", removed)
+	}
+	expectKeys(t, s, "short", "long", "forever")
+}
+
+func testWrongChecksum(t *testing.T, s storage.Storage) {
+	file := &storage.File{Key: "testfile", Value: []byte("testdata"), Checksum: storage.Checksum([]byte("other"))}
+	if err := s.PutFile(file); !errors.Is(err, storage.ErrCorrupted) {
+		t.Fatalf("Expected ErrCorrupted, got %v", err)
+	}
+	expectNotFound(t, s, "testfile")
+
+	file.Checksum = storage.Checksum(file.Value)
+	if err := s.PutFile(file); err != nil {
+		t.Fatalf("Failed to put file with the right checksum: %v", err)
+	}
+	expectValue(t, s, "testfile", []byte("testdata"))
+
+	corrupted, err := s.Scrub()
+	if err != nil || len(corrupted) != 0 {
+		t.Fatalf("Expected no corrupted file, got %v, %v", corrupted, err)
+	}
+	if quarantined := s.Quarantined(); len(quarantined) != 0 {
+		t.Fatalf("Expected empty quarantine, got %v", quarantined)
+	}
+}
+
+func testConcurrent(t *testing.T, s storage.Storage) {
+	const workers, rounds = 8, 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				key := fmt.Sprintf("worker%d-file%d", i, j)
+				if err := s.Put(key, []byte(key)); err != nil {
+					errs <- err
+					return
+				}
+				value, err := s.Get(key)
+				if err != nil || !bytes.Equal(value, []byte(key)) {
+					errs <- fmt.Errorf("read %s: %q, %v", key, value, err)
+					return
+				}
+				if j%2 == 1 {
+					if err := s.Delete(key); err != nil {
+						errs <- err
+						return
+					}
+				}
+				s.GetFilesName()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Concurrent access failed: %v", err)
+	}
+
+	if names := s.GetFilesName(); len(names) != workers*rounds/2 {
+		t.Fatalf("Expected %d files, got %d", workers*rounds/2, len(names))
+	}
+}
+
+func testConcurrentPutFiles(t *testing.T, s storage.Storage) {
+	const batches, batchSize = 10, 5
+
+	var wg sync.WaitGroup
+	for i := 0; i < batches; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var files storage.FileList
+			for j := 0; j < batchSize; j++ {
+				key := fmt.Sprintf("batch%d-file%d", i, j)
+				files = append(files, &storage.File{Key: key, Value: []byte(key)})
+			}
+			if err := s.PutFiles(files); err != nil {
+				t.Errorf("Failed to put batch %d: %v", i, err)
+			}
+		}(i)
+	}
+
+	// a reader sees every batch either whole or not at all
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		counts := make(map[string]int)
+		for _, name := range s.GetFilesName() {
+			counts[strings.SplitN(name, "-", 2)[0]]++
+		}
+		for batch, count := range counts {
+			if count != batchSize {
+				t.Fatalf("Expected %s to be whole, got %d of %d files", batch, count, batchSize)
+			}
+		}
+	}
+
+	if names := s.GetFilesName(); len(names) != batches*batchSize {
+		t.Fatalf("Expected %d files, got %d", batches*batchSize, len(names))
+	}
+}
+
+func testConcurrentMergeFiles(t *testing.T, s storage.Storage) {
+	const writers, rounds = 8, 20
+
+	// every writer merges its own versions of the same keys, the newest version must win whatever the order
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				version := storage.Version{WallTime: int64(j*writers + i + 1), NodeID: "node"}
+				value := []byte(fmt.Sprintf("writer%d-round%d", i, j))
+				files := storage.FileList{
+					{Key: "testfile1", Value: value, Version: version},
+					{Key: "testfile2", Value: value, Version: version},
+				}
+				if err := storage.MergeFiles(s, files); err != nil {
+					t.Errorf("Failed to merge files of writer %d: %v", i, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	newest := storage.Version{WallTime: int64(rounds * writers), NodeID: "node"}
+	for _, key := range []string{"testfile1", "testfile2"} {
+		file, err := s.GetFile(key)
+		if err != nil || file.Version != newest {
+			t.Fatalf("Expected %s at the newest version %v, got %v, %v", key, newest, file, err)
+		}
+		expectValue(t, s, key, []byte(fmt.Sprintf("writer%d-round%d", writers-1, rounds-1)))
+	}
+}
+
+func testForEachKey(t *testing.T, s storage.Storage) {
+	mustPut(t, s, "testfile1", []byte("testdata1"))
+	mustPut(t, s, "testfile2", []byte("testdata2"))
+	mustPut(t, s, "other", []byte("other"))
+	s.PutWithTTL("expired", []byte("expired"), time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+
+	var keys []string
+	err := s.ForEachKey(func(key string) bool { return strings.HasPrefix(key, "testfile") }, func(fileKey string) error {
+		keys = append(keys, fileKey)
+		return nil
+	})
+	sort.Strings(keys)
+	if err != nil || len(keys) != 2 || keys[0] != "testfile1" || keys[1] != "testfile2" {
+		t.Fatalf("Expected [testfile1 testfile2], got %v, %v", keys, err)
+	}
+
+	// the expired files are skipped
+	count := 0
+	s.ForEachKey(func(string) bool { return true }, func(string) error {
+		count++
+		return nil
+	})
+	if count != 3 {
+		t.Fatalf("Expected 3 keys, got %d", count)
+	}
+
+	// ErrStop stops without error, another error is returned
+	count = 0
+	err = s.ForEachKey(func(string) bool { return true }, func(string) error {
+		count++
+		return storage.ErrStop
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("Expected the iteration to stop after 1 key, got %d, %v", count, err)
+	}
+	failure := errors.New("failure")
+	if err := s.ForEachKey(func(string) bool { return true }, func(string) error { return failure }); !errors.Is(err, failure) {
+		t.Fatalf("Expected the error of the callback, got %v", err)
+	}
+}
+
+func testForEachFile(t *testing.T, s storage.Storage) {
+	version := storage.Version{WallTime: 42, NodeID: "node"}
+	s.PutFile(&storage.File{Key: "testfile1", Value: []byte("testdata1"), Version: version, Owner: "127.0.0.1:8000"})
+	mustPut(t, s, "testfile2", []byte("testdata2"))
+	mustPut(t, s, "other", []byte("other"))
+
+	values := make(map[string]string)
+	err := s.ForEachFile(func(key string) bool { return strings.HasPrefix(key, "testfile") }, func(info *storage.FileInfo, value io.Reader) error {
+		data, err := io.ReadAll(value)
+		if err != nil {
+			return err
+		}
+		if info.Size != int64(len(data)) || info.Checksum != storage.Checksum(data) {
+			t.Errorf("Unexpected metadata for %s: %+v", info.Key, info)
+		}
+		if info.Key == "testfile1" && (info.Version != version || info.Owner != "127.0.0.1:8000") {
+			t.Errorf("Expected the version and owner of testfile1, got %+v", info)
+		}
+		values[info.Key] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to iterate over the files: %v", err)
+	}
+	if len(values) != 2 || values["testfile1"] != "testdata1" || values["testfile2"] != "testdata2" {
+		t.Fatalf("Unexpected files: %v", values)
+	}
+
+	// the values don't have to be read
+	count := 0
+	err = s.ForEachFile(func(string) bool { return true }, func(*storage.FileInfo, io.Reader) error {
+		count++
+		return nil
+	})
+	if err != nil || count != 3 {
+		t.Fatalf("Expected 3 files, got %d, %v", count, err)
+	}
+
+	count = 0
+	err = s.ForEachFile(func(string) bool { return true }, func(*storage.FileInfo, io.Reader) error {
+		count++
+		return storage.ErrStop
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("Expected the iteration to stop after 1 file, got %d, %v", count, err)
+	}
+}
+
+func testForEachFileModify(t *testing.T, s storage.Storage) {
+	for i := 0; i < 10; i++ {
+		mustPut(t, s, fmt.Sprintf("testfile%d", i), []byte("testdata"))
+	}
+
+	// the callback may use the storage, e.g. to remove the files once they are sent
+	err := s.ForEachFile(func(string) bool { return true }, func(info *storage.FileInfo, value io.Reader) error {
+		if _, err := io.ReadAll(value); err != nil {
+			return err
+		}
+		if _, err := s.DeleteIfVersion(info.Key, info.Version); err != nil {
+			return err
+		}
+		return s.Put(info.Key+"-moved", []byte("moved"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to iterate over the files: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		expectNotFound(t, s, fmt.Sprintf("testfile%d", i))
+		expectValue(t, s, fmt.Sprintf("testfile%d-moved", i), []byte("moved"))
+	}
+}
+
+func testGetStream(t *testing.T, s storage.Storage) {
+	if _, err := s.GetStream("missing", io.Discard); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	value := bytes.Repeat([]byte("0123456789"), 200*1024) // 2MB, larger than the usual cache limits
+	version := storage.Version{WallTime: 42, NodeID: "node"}
+	if err := s.PutFile(&storage.File{Key: "large", Value: value, Version: version}); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	mustPut(t, s, "small", []byte("small"))
+
+	for _, key := range []string{"large", "small", "small"} {
+		var buf bytes.Buffer
+		info, err := s.GetStream(key, &buf)
+		if err != nil {
+			t.Fatalf("Failed to get stream of %s: %v", key, err)
+		}
+		expected, _ := s.Get(key)
+		if !bytes.Equal(buf.Bytes(), expected) || info.Size != int64(len(expected)) || info.Key != key {
+			t.Fatalf("Unexpected stream of %s: %d bytes, %+v", key, buf.Len(), info)
+		}
+		if key == "large" && info.Version != version {
+			t.Fatalf("Expected version %v, got %v", version, info.Version)
+		}
+	}
+}
+
+func testPutStream(t *testing.T, s storage.Storage) {
+	value := bytes.Repeat([]byte("0123456789"), 200*1024)
+	version := storage.Version{WallTime: 42, NodeID: "node"}
+	file := &storage.File{Key: "large.txt", Version: version, Owner: "127.0.0.1:8000", Checksum: storage.Checksum(value)}
+	if err := s.PutStream(file, bytes.NewReader(value)); err != nil {
+		t.Fatalf("Failed to put stream: %v", err)
+	}
+	got, err := s.GetFile("large.txt")
+	if err != nil {
+		t.Fatalf("Failed to get file: %v", err)
+	}
+	if !bytes.Equal(got.Value, value) || got.Version != version || got.Owner != file.Owner {
+		t.Fatalf("Unexpected file: %d bytes, version %v, owner %s", len(got.Value), got.Version, got.Owner)
+	}
+	info, err := s.Stat("large.txt")
+	if err != nil || info.Size != int64(len(value)) || info.Checksum != storage.Checksum(value) {
+		t.Fatalf("Unexpected metadata: %+v, %v", info, err)
+	}
+	if info.ContentType != "text/plain; charset=utf-8" {
+		t.Fatalf("Expected text/plain content type, got %s", info.ContentType)
+	}
+
+	// the value overwrites the cached one
+	mustPut(t, s, "small", []byte("old"))
+	s.Get("small")
+	if err := s.PutStream(&storage.File{Key: "small"}, strings.NewReader("new")); err != nil {
+		t.Fatalf("Failed to put stream: %v", err)
+	}
+	expectValue(t, s, "small", []byte("new"))
+
+	// a value not matching the checksum is rejected, and the old value is kept
+	err = s.PutStream(&storage.File{Key: "small", Checksum: storage.Checksum([]byte("other"))}, strings.NewReader("wrong"))
+	if !errors.Is(err, storage.ErrCorrupted) {
+		t.Fatalf("Expected ErrCorrupted, got %v", err)
+	}
+	expectValue(t, s, "small", []byte("new"))
+
+	if err := s.PutStream(&storage.File{Key: ""}, strings.NewReader("value")); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey, got %v", err)
+	}
+}
+
+// expectFileKeys checks the keys of the files, in any order.
+func expectFileKeys(t *testing.T, files storage.FileList, keys []string) {
+	t.Helper()
+	sort.Strings(keys)
+	if got := fileKeys(files); strings.Join(got, "\n") != strings.Join(keys, "\n") || len(got) != len(keys) {
+		t.Fatalf("Expected files %q, got %q", keys, got)
+	}
+}
+
+// rangeKeys returns the keys with an identifier in (lo, hi], checked key by key.
+func rangeKeys(keys []string, lo, hi *big.Int) []string {
+	var inRange []string
+	for _, key := range keys {
+		if tools.ModIntervalCheck(tools.GenerateIdentifier(key), lo, hi, false, true) {
+			inRange = append(inRange, key)
+		}
+	}
+	return inRange
+}
+
+func testGetRange(t *testing.T, s storage.Storage) {
+	var keys []string
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("testfile%d", i)
+		keys = append(keys, key)
+		mustPut(t, s, key, []byte(key))
+	}
+	s.PutWithTTL("expired", []byte("expired"), time.Millisecond)
+	s.Delete("testfile0")
+	keys = keys[1:]
+	time.Sleep(10 * time.Millisecond)
+
+	tests := []struct{ lo, hi int64 }{
+		{100, 600},  // normal interval
+		{600, 100},  // wraps around the ring
+		{300, 300},  // the whole ring
+		{1023, 0},   // only 0
+		{500, 1023}, // up to the end of the ring
+	}
+	for _, test := range tests {
+		lo, hi := big.NewInt(test.lo), big.NewInt(test.hi)
+		files, err := s.GetRange(lo, hi)
+		if err != nil {
+			t.Fatalf("Failed to get range (%d, %d]: %v", test.lo, test.hi, err)
+		}
+		for _, file := range files {
+			if string(file.Value) != file.Key {
+				t.Fatalf("Unexpected value of %s: %s", file.Key, file.Value)
+			}
+		}
+		expectFileKeys(t, files, rangeKeys(keys, lo, hi))
+	}
+
+	// the files are kept
+	expectValue(t, s, "testfile1", []byte("testfile1"))
+}
+
+func testExtractRange(t *testing.T, s storage.Storage) {
+	var keys []string
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("testfile%d", i)
+		keys = append(keys, key)
+		mustPut(t, s, key, []byte(key))
+	}
+
+	lo, hi := big.NewInt(700), big.NewInt(200)
+	files, err := s.ExtractRange(lo, hi)
+	if err != nil {
+		t.Fatalf("Failed to extract range: %v", err)
+	}
+	extracted := rangeKeys(keys, lo, hi)
+	expectFileKeys(t, files, extracted)
+
+	for _, key := range extracted {
+		expectNotFound(t, s, key)
+	}
+	expectKeys(t, s, rangeKeys(keys, hi, lo)...)
+
+	// the range is empty now
+	files, err = s.ExtractRange(lo, hi)
+	if err != nil || len(files) != 0 {
+		t.Fatalf("Expected an empty range, got %v, %v", fileKeys(files), err)
+	}
+
+	// the removed keys are removed from the index, the stored ones are added again
+	mustPut(t, s, extracted[0], []byte("again"))
+	files, _ = s.GetRange(lo, hi)
+	expectFileKeys(t, files, extracted[:1])
+
+	s.Clear()
+	if files, _ := s.GetRange(big.NewInt(0), big.NewInt(0)); len(files) != 0 {
+		t.Fatalf("Expected an empty range after Clear, got %v", fileKeys(files))
+	}
+}
+
+func testTransfer(t *testing.T, s storage.Storage) {
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("testfile%d", i)
+		keys = append(keys, key)
+		mustPut(t, s, key, []byte(key))
+	}
+	lo, hi := big.NewInt(0), big.NewInt(0) // the whole ring
+
+	id, files, err := s.BeginTransfer(lo, hi, "127.0.0.1:8000")
+	if err != nil {
+		t.Fatalf("Failed to begin transfer: %v", err)
+	}
+	expectFileKeys(t, files, keys)
+	pending := s.PendingTransfers()
+	if len(pending) != 1 || pending[0].ID != id || pending[0].Target != "127.0.0.1:8000" || len(pending[0].Versions) != len(keys) {
+		t.Fatalf("Expected the transfer %s pending, got %v", id, pending)
+	}
+
+	// all the files are in the transfer, so another one would be empty and is not recorded
+	empty, files, err := s.BeginTransfer(lo, hi, "")
+	if err != nil || empty != "" || len(files) != 0 || len(s.PendingTransfers()) != 1 {
+		t.Fatalf("Expected no transfer, got %q, %v, %v", empty, fileKeys(files), err)
+	}
+
+	// the files stay readable, and are not part of another transfer
+	expectValue(t, s, "testfile0", []byte("testfile0"))
+	mustPut(t, s, "other", []byte("other"))
+	other, files, err := s.BeginTransfer(lo, hi, "")
+	if err != nil {
+		t.Fatalf("Failed to begin transfer: %v", err)
+	}
+	expectFileKeys(t, files, []string{"other"})
+	if err := s.AbortTransfer(other); err != nil {
+		t.Fatalf("Failed to abort transfer: %v", err)
+	}
+
+	// testfile1 gets a new version meanwhile, testfile2 is not delivered
+	if err := s.PutFile(&storage.File{Key: "testfile1", Value: []byte("changed"), Version: storage.Version{WallTime: 1, NodeID: "node"}}); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	var delivered []string
+	for _, key := range keys {
+		if key != "testfile2" {
+			delivered = append(delivered, key)
+		}
+	}
+	if err := s.CommitTransfer(id, delivered); err != nil {
+		t.Fatalf("Failed to commit transfer: %v", err)
+	}
+	expectKeys(t, s, "testfile1", "testfile2", "other")
+	expectValue(t, s, "testfile1", []byte("changed"))
+	if pending := s.PendingTransfers(); len(pending) != 0 {
+		t.Fatalf("Expected no pending transfer, got %v", pending)
+	}
+
+	if err := s.CommitTransfer(id, nil); !errors.Is(err, storage.ErrNoTransfer) {
+		t.Fatalf("Expected ErrNoTransfer, got %v", err)
+	}
+	if err := s.AbortTransfer("missing"); !errors.Is(err, storage.ErrNoTransfer) {
+		t.Fatalf("Expected ErrNoTransfer, got %v", err)
+	}
+}
+
+func testTransferAbort(t *testing.T, s storage.Storage) {
+	mustPut(t, s, "testfile1", []byte("testdata1"))
+	mustPut(t, s, "testfile2", []byte("testdata2"))
+
+	id, files, err := s.BeginTransfer(big.NewInt(0), big.NewInt(0), "")
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Failed to begin transfer: %v, %v", fileKeys(files), err)
+	}
+	if err := s.AbortTransfer(id); err != nil {
+		t.Fatalf("Failed to abort transfer: %v", err)
+	}
+	expectKeys(t, s, "testfile1", "testfile2")
+
+	// the files can be transferred again
+	_, files, _ = s.BeginTransfer(big.NewInt(0), big.NewInt(0), "")
+	expectFileKeys(t, files, []string{"testfile1", "testfile2"})
+
+	// Clear drops the pending transfers with the files
+	s.Clear()
+	if pending := s.PendingTransfers(); len(pending) != 0 {
+		t.Fatalf("Expected no pending transfer after Clear, got %v", pending)
+	}
+}
+
+func testTransferFiles(t *testing.T, s storage.Storage) {
+	mustPut(t, s, "testfile1", []byte("testdata1"))
+	mustPut(t, s, "testfile2", []byte("testdata2"))
+	mustPut(t, s, "testfile3", []byte("testdata3"))
+
+	// the batches of a walk are transferred one by one
+	first, _ := s.GetFile("testfile1")
+	id, files, err := s.BeginTransferFiles(storage.FileList{first}, "127.0.0.1:8000")
+	if err != nil {
+		t.Fatalf("Failed to begin transfer: %v", err)
+	}
+	expectFileKeys(t, files, []string{"testfile1"})
+	second, _ := s.GetFile("testfile2")
+	other, files, err := s.BeginTransferFiles(storage.FileList{first, second}, "127.0.0.1:8000")
+	if err != nil {
+		t.Fatalf("Failed to begin transfer: %v", err)
+	}
+	expectFileKeys(t, files, []string{"testfile2"})
+	if pending := s.PendingTransfers(); len(pending) != 2 {
+		t.Fatalf("Expected 2 pending transfers, got %v", pending)
+	}
+
+	if err := s.CommitTransfer(id, []string{"testfile1"}); err != nil {
+		t.Fatalf("Failed to commit transfer: %v", err)
+	}
+	if err := s.CommitTransfer(other, []string{"testfile2"}); err != nil {
+		t.Fatalf("Failed to commit transfer: %v", err)
+	}
+	expectKeys(t, s, "testfile3")
+
+	if empty, files, err := s.BeginTransferFiles(nil, ""); err != nil || empty != "" || len(files) != 0 {
+		t.Fatalf("Expected no transfer, got %q, %v, %v", empty, fileKeys(files), err)
+	}
+}
+
+func testRangeAfterCorruption(t *testing.T, s storage.Storage, corrupt func(storage.Storage, string) error) {
+	var keys []string
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("testfile%d", i)
+		keys = append(keys, key)
+		mustPut(t, s, key, []byte(key))
+	}
+	if err := corrupt(s, "testfile3"); err != nil {
+		t.Fatalf("Failed to corrupt file: %v", err)
+	}
+	healthy := append(append([]string(nil), keys[:3]...), keys[4:]...)
+
+	// the compaction (or the first read) finds the corrupted file and quarantines it
+	if compactor, ok := s.(Compactor); ok {
+		if err := compactor.Compact(); err != nil {
+			t.Fatalf("Failed to compact: %v", err)
+		}
+	}
+	whole := big.NewInt(0)
+	for i := 0; i < 2; i++ {
+		files, err := s.GetRange(whole, whole)
+		if err != nil {
+			t.Fatalf("Failed to get range: %v", err)
+		}
+		expectFileKeys(t, files, healthy)
+	}
+	if quarantined := s.Quarantined(); len(quarantined) != 1 || quarantined[0] != "testfile3" {
+		t.Fatalf("Expected [testfile3] in quarantine, got %v", quarantined)
+	}
+
+	files, err := s.ExtractRange(whole, whole)
+	if err != nil {
+		t.Fatalf("Failed to extract range: %v", err)
+	}
+	expectFileKeys(t, files, healthy)
+	expectKeys(t, s)
+}
+
+func testTransferRestart(t *testing.T, factory Factory) {
+	path := t.TempDir()
+	s := openStorage(t, factory, path)
+	mustPut(t, s, "testfile1", []byte("testdata1"))
+	mustPut(t, s, "testfile2", []byte("testdata2"))
+	id, files, err := s.BeginTransfer(big.NewInt(0), big.NewInt(0), "127.0.0.1:8000")
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Failed to begin transfer: %v", err)
+	}
+
+	// the transfer is still pending after a restart, and the files are still there
+	closeStorage(s)
+	s = openStorage(t, factory, path)
+	pending := s.PendingTransfers()
+	if len(pending) != 1 || pending[0].ID != id || pending[0].Target != "127.0.0.1:8000" {
+		t.Fatalf("Expected the transfer %s pending, got %v", id, pending)
+	}
+	expectKeys(t, s, "testfile1", "testfile2")
+
+	if err := s.CommitTransfer(id, []string{"testfile1"}); err != nil {
+		t.Fatalf("Failed to commit transfer: %v", err)
+	}
+
+	// the commit is persisted too
+	closeStorage(s)
+	s = openStorage(t, factory, path)
+	expectKeys(t, s, "testfile2")
+	expectValue(t, s, "testfile2", []byte("testdata2"))
+	if pending := s.PendingTransfers(); len(pending) != 0 {
+		t.Fatalf("Expected no pending transfer, got %v", pending)
+	}
+}